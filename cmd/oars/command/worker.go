@@ -28,7 +28,7 @@ var workerCmd = &cobra.Command{
 			log.Error(err)
 			os.Exit(-1)
 		}
-		err = worker.Start(store, cfg.Node)
+		err = worker.Start(store, cfg.Node, cfg.Server.SecretKey)
 		if err != nil {
 			log.Error(err)
 			os.Exit(-1)
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	//HostnameLabelKey 节点主机名标签，每个节点都会自动带上
+	HostnameLabelKey = "oars.hashwing.cn/hostname"
+)
+
+const (
+	//SelectorOpIn 标签值在列表中
+	SelectorOpIn = "In"
+	//SelectorOpNotIn 标签值不在列表中
+	SelectorOpNotIn = "NotIn"
+	//SelectorOpExists 存在标签
+	SelectorOpExists = "Exists"
+	//SelectorOpDoesNotExist 不存在标签
+	SelectorOpDoesNotExist = "DoesNotExist"
+)
+
+//Affinity 亲和性
+type Affinity struct {
+	NodeAffinity        []NodeSelectorRequirement `json:"nodeAffinity,omitempty"`
+	ServiceAffinity     []ServiceAffinityTerm     `json:"serviceAffinity,omitempty"`
+	ServiceAntiAffinity []ServiceAffinityTerm     `json:"serviceAntiAffinity,omitempty"`
+}
+
+//NodeSelectorRequirement 节点标签要求
+type NodeSelectorRequirement struct {
+	Key      string   `json:"key"`
+	Operator string   `json:"operator"`
+	Values   []string `json:"values,omitempty"`
+}
+
+//ServiceAffinityTerm 服务亲和条件，TopologyKey 为空时按主机划分
+type ServiceAffinityTerm struct {
+	Namespace   string `json:"namespace,omitempty"`
+	Service     string `json:"service"`
+	TopologyKey string `json:"topologyKey,omitempty"`
+}
+
+//Match 节点标签是否满足要求
+func (r *NodeSelectorRequirement) Match(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorOpIn:
+		if !ok {
+			return false
+		}
+		for _, value := range r.Values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	case SelectorOpNotIn:
+		for _, value := range r.Values {
+			if ok && v == value {
+				return false
+			}
+		}
+		return true
+	case SelectorOpExists:
+		return ok
+	case SelectorOpDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (r *NodeSelectorRequirement) String() string {
+	switch r.Operator {
+	case SelectorOpExists, SelectorOpDoesNotExist:
+		return r.Key + " " + r.Operator
+	}
+	return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+}
+
+//MatchNode 检查节点标签是否满足nodeSelector 和节点亲和性
+func (s *Service) MatchNode(labels map[string]string) error {
+	for k, v := range s.NodeSelector {
+		if labels[k] != v {
+			return fmt.Errorf("node selector %s=%s not matched", k, v)
+		}
+	}
+	if s.Affinity == nil {
+		return nil
+	}
+	for _, r := range s.Affinity.NodeAffinity {
+		if !r.Match(labels) {
+			return fmt.Errorf("node affinity %s not matched", r.String())
+		}
+	}
+	return nil
+}
+
+//Key 条件对应的服务，namespace 默认与svc 相同
+func (t *ServiceAffinityTerm) Key(svc *Service) string {
+	ns := t.Namespace
+	if ns == "" {
+		ns = svc.Namespace
+	}
+	return ns + "/" + t.Service
+}
@@ -7,6 +7,12 @@ const (
 	HashLabelKey = "oars.hashwing.cn/hash"
 	//ServicePortLabelKey ...
 	ServicePortLabelKey = "oars.hashwing.cn/port"
+	//RevisionLabelKey ...
+	RevisionLabelKey = "oars.hashwing.cn/revision"
+	//ImageDigestLabelKey 创建容器时镜像的digest
+	ImageDigestLabelKey = "oars.hashwing.cn/image-digest"
+	//RestartPolicyLabelKey 旧版本创建的容器的重启策略，容器以no 创建，由worker 按该策略退避重启；新容器的重启策略由运行时执行
+	RestartPolicyLabelKey = "oars.hashwing.cn/restart"
 	//SystemNamespace ...
 	SystemNamespace = "system"
 	//DefaultSystemName ...
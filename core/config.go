@@ -1,5 +1,7 @@
 package core
 
+import "time"
+
 //Config 配置
 type Config struct {
 	Server  ServerConfig
@@ -10,10 +12,13 @@ type Config struct {
 
 //ServerConfig 服务端配置
 type ServerConfig struct {
-	Port int    `envconfig:"SERVER_PORT"  default:"8801"`
-	Name string `envconfig:"SERVER_NAME"  default:"server"`
-	Host string `envconfig:"SERVER_HOST"  default:"127.0.0.1"`
-	TLS  TLSConfig
+	Port      int           `envconfig:"SERVER_PORT"  default:"8801"`
+	Name      string        `envconfig:"SERVER_NAME"  default:"server"`
+	Host      string        `envconfig:"SERVER_HOST"  default:"127.0.0.1"`
+	SecretKey string        `envconfig:"SERVER_SECRET_KEY"`                      //密钥资源的加密口令，worker 需配置相同的值
+	EventTTL  time.Duration `envconfig:"SERVER_EVENT_TTL" default:"168h"`        //事件保留时间，0 不清理
+	CopyLimit int64         `envconfig:"SERVER_COPY_LIMIT" default:"1073741824"` //cpFrom、cpTo 传输tar 包的字节数上限，0 不限制
+	TLS       TLSConfig
 }
 
 //TLSConfig TLS 配置
@@ -36,19 +41,29 @@ type EtcdConfig struct {
 
 //NodeConfig 节点配置
 type NodeConfig struct {
-	Hostname           string   `envconfig:"NODE_HOSTNAME"`
-	IP                 string   `envconfig:"NODE_IP"`
-	MAC                string   `envconfig:"NODE_MAC"`
-	Port               int      `envconfig:"NODE_PORT" default:"8802"`
-	UpDNS              []string `envconfig:"NODE_UPSTREAN_DNS"`
-	MetricsPort        int      `envconfig:"NODE_METRUCSPort" default:"8803"`
-	WorkDir            string   `envconfig:"NODE_WORKDIR" default:"/opt/oars/woker"`
-	ContainerNetwork   string   `envconfig:"NODE_CONTAINER_NETWORK" default:"bridge"`
-	ContainerCIDR      string   `envconfig:"NODE_CONTAINER_CIDR"`
-	ContainerRangeCIDR string   `envconfig:"NODE_CONTAINER_RANGE_CIDR"`
-	Interface          string   `envconfig:"NODE_INTERFACE"`
+	Hostname           string            `envconfig:"NODE_HOSTNAME"`
+	IP                 string            `envconfig:"NODE_IP"`
+	MAC                string            `envconfig:"NODE_MAC"`
+	Port               int               `envconfig:"NODE_PORT" default:"8802"`
+	UpDNS              []string          `envconfig:"NODE_UPSTREAN_DNS"`
+	MetricsPort        int               `envconfig:"NODE_METRUCSPort" default:"8803"`
+	WorkDir            string            `envconfig:"NODE_WORKDIR" default:"/opt/oars/woker"`
+	ContainerNetwork   string            `envconfig:"NODE_CONTAINER_NETWORK" default:"bridge"`
+	ContainerCIDR      string            `envconfig:"NODE_CONTAINER_CIDR"`
+	ContainerRangeCIDR string            `envconfig:"NODE_CONTAINER_RANGE_CIDR"`
+	Interface          string            `envconfig:"NODE_INTERFACE"`
+	Runtime            string            `envconfig:"NODE_RUNTIME" default:"docker"`
+	Labels             map[string]string `envconfig:"NODE_LABELS"`
+	ImageCheckInterval time.Duration     `envconfig:"NODE_IMAGE_CHECK_INTERVAL" default:"5m"`    //autoUpdate 服务检查镜像digest 的间隔
+	ImageGCHigh        int               `envconfig:"NODE_IMAGE_GC_HIGH_THRESHOLD" default:"85"` //镜像所在磁盘使用率超过该百分比时回收镜像，0 不回收
+	ImageGCLow         int               `envconfig:"NODE_IMAGE_GC_LOW_THRESHOLD" default:"80"`  //回收至磁盘使用率低于该百分比
+	ExecRecordDir      string            `envconfig:"NODE_EXEC_RECORD_DIR"`                      //exec 会话录像（asciicast）保存目录，为空不录制
+	DriftCheckInterval time.Duration     `envconfig:"NODE_DRIFT_CHECK_INTERVAL" default:"5m"`    //检查容器配置漂移的间隔，0 不检查
+	StopContainers     bool              `envconfig:"NODE_STOP_CONTAINERS"`                      //worker 退出时停止本节点的容器，重新启动后恢复
+	StopGracePeriod    time.Duration     `envconfig:"NODE_STOP_GRACE_PERIOD" default:"30s"`      //退出时等待容器按StopSignal 停止的时间，超时后强制结束
 	Vault              VaultConfig
 	Loki               LokiConfig
+	Containerd         ContainerdConfig
 }
 
 //IngressConfig ingress 配置
@@ -73,8 +88,15 @@ type ImageRegistryConfig struct {
 
 //VaultConfig vault config
 type VaultConfig struct {
-	Address string `envconfig:"VAULT_ADDRESSS"`
-	TOKEN   string `envconfig:"VAULT_TOKEN"`
+	Address      string `envconfig:"VAULT_ADDRESSS"`
+	TOKEN        string `envconfig:"VAULT_TOKEN"`
+	AuthMethod   string `envconfig:"VAULT_AUTH_METHOD" default:"token"` //token、approle、jwt
+	AuthMount    string `envconfig:"VAULT_AUTH_MOUNT"`                  //认证挂载路径，默认与认证方式相同
+	RoleID       string `envconfig:"VAULT_ROLE_ID"`
+	SecretID     string `envconfig:"VAULT_SECRET_ID"`
+	SecretIDFile string `envconfig:"VAULT_SECRET_ID_FILE"`
+	Role         string `envconfig:"VAULT_JWT_ROLE"`
+	JWTFile      string `envconfig:"VAULT_JWT_FILE"`
 }
 
 type LokiConfig struct {
@@ -84,3 +106,11 @@ type LokiConfig struct {
 	MaxSize string `envconfig:"LOKI_MAX_SIZE" default:"50m"`
 	MaxFile string `envconfig:"LOKI_MAX_FILE" default:"10"`
 }
+
+//ContainerdConfig containerd 运行时配置，通过nerdctl 管理容器
+type ContainerdConfig struct {
+	Address   string `envconfig:"CONTAINERD_ADDRESS" default:"/run/containerd/containerd.sock"`
+	Namespace string `envconfig:"CONTAINERD_NAMESPACE" default:"oars"`
+	Nerdctl   string `envconfig:"CONTAINERD_NERDCTL" default:"nerdctl"`
+	Root      string `envconfig:"CONTAINERD_ROOT" default:"/var/lib/containerd"`
+}
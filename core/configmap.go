@@ -8,6 +8,21 @@ type ConfigMap struct {
 	Data map[string]string `json:"data"`
 }
 
+//ConfigMapRef 服务引用的ConfigMap
+//设置Path 时以文件挂载，Key 为空时挂载目录；设置Env 时将Key 注入为环境变量；都未设置时注入全部键
+type ConfigMapRef struct {
+	Name            string `json:"name"` //同命名空间的ConfigMap
+	Key             string `json:"key,omitempty"`
+	Path            string `json:"path,omitempty"`
+	Env             string `json:"env,omitempty"`
+	RestartOnChange bool   `json:"restartOnChange,omitempty"` //变更时重建容器，否则只更新挂载的文件
+}
+
+//IsMount 是否以文件挂载
+func (r ConfigMapRef) IsMount() bool {
+	return r.Path != ""
+}
+
 //String ...
 func (e *ConfigMap) String() string {
 	d, _ := json.Marshal(e)
@@ -6,13 +6,23 @@ import "encoding/json"
 type ContainerService struct {
 	ID              string                 `json:"-"`
 	Name            string                 `json:"-"`
+	Hold            bool                   `json:"-"`
+	SpecHash        string                 `json:"-"` //不含引用配置的摘要
+	Kind            string                 `json:"-"`
+	Job             *JobSpec               `json:"-"`
+	CronJob         *CronJobSpec           `json:"-"`
+	DriftPolicy     string                 `json:"-"`
 	Labels          map[string]string      `json:"labels"`
 	Image           string                 `json:"image,omitempty"`
 	ImagePullPolicy string                 `json:"imagePullPolicy,omitempty"`
 	ImagePullAuth   string                 `json:"imagePullAuth,omitempty"`
+	AutoUpdate      bool                   `json:"autoUpdate,omitempty"` //拉取策略为Always 时定期检查镜像digest，变化后滚动重建
 	Volumes         []string               `json:"volumes,omitempty"`
-	DependsOn       []string               `json:"depends_on,omitempty"`
+	DependsOn       []string               `json:"depends_on,omitempty"`     //同服务的端点名或service.namespace
+	InitContainers  []ContainerService     `json:"initContainers,omitempty"` //创建容器前依次运行至成功退出
 	Environment     []string               `json:"environment,omitempty"`
+	SecretEnv       []SecretEnvSource      `json:"secretEnv,omitempty"`
+	Secrets         []SecretMount          `json:"secrets,omitempty"`
 	Restart         string                 `json:"restart,omitempty"`
 	Command         StrSlice               `json:"command,omitempty"`
 	Shell           StrSlice               `json:"shell,omitempty"`
@@ -33,8 +43,11 @@ type ContainerService struct {
 	Privileged      bool                   `json:"privileged,omitempty"`
 	WorkingDir      string                 `json:"working_dir,omitempty"`
 	ConfigMap       map[string]string      `json:"configmap,omitempty"`
+	ConfigMapRefs   []ConfigMapRef         `json:"configMapRefs,omitempty"`
 	Ports           []string               `json:"ports,omitempty"`
 	Expose          []string               `json:"expose,omitempty"`
+	LivenessProbe   *Probe                 `json:"livenessProbe,omitempty"`
+	ReadinessProbe  *Probe                 `json:"readinessProbe,omitempty"`
 }
 
 var (
@@ -60,11 +73,47 @@ type ContainerPort struct {
 	Protocol      string `json:"protocol,omitempty"`
 }
 
+//Probe 健康检查，端口为0时使用服务端口
+type Probe struct {
+	HTTPGet             *HTTPGetAction   `json:"httpGet,omitempty"`
+	TCPSocket           *TCPSocketAction `json:"tcpSocket,omitempty"`
+	Exec                *ExecAction      `json:"exec,omitempty"`
+	InitialDelaySeconds int              `json:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       int              `json:"periodSeconds,omitempty"`
+	TimeoutSeconds      int              `json:"timeoutSeconds,omitempty"`
+	SuccessThreshold    int              `json:"successThreshold,omitempty"`
+	FailureThreshold    int              `json:"failureThreshold,omitempty"`
+}
+
+//HTTPGetAction http 检查，返回码200-399 为成功
+type HTTPGetAction struct {
+	Path    string            `json:"path,omitempty"`
+	Port    int               `json:"port,omitempty"`
+	Scheme  string            `json:"scheme,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+//TCPSocketAction tcp 检查
+type TCPSocketAction struct {
+	Port int `json:"port,omitempty"`
+}
+
+//ExecAction 容器内执行命令，退出码为0 为成功
+type ExecAction struct {
+	Command StrSlice `json:"command,omitempty"`
+}
+
+//ContainerResource 容器资源
 type ContainerResource struct {
 	CPU    float64 `json:"cpu,omitempty"`
 	Memory int64   `json:"memory,omitempty"`
 }
 
+//MemoryBytes 内存限制（字节）
+func (r *ContainerResource) MemoryBytes() int64 {
+	return r.Memory * 1024
+}
+
 // StrSlice represents a string or an array of strings.
 // We need to override the json decoder to accept both options.
 type StrSlice []string
@@ -15,22 +15,107 @@ type Node struct {
 //Endpoint 端点
 type Endpoint struct {
 	*ResourceMeta
-	Kind    string            `json:"kind"`
-	Service string            `json:"service"`
-	Labels  map[string]string `json:"labels,omitempty"`
-	Status  *EndpointStatus   `json:"status,omitempty"`
+	Kind          string            `json:"kind"`
+	Service       string            `json:"service"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Status        *EndpointStatus   `json:"status,omitempty"`
+	Unschedulable bool              `json:"unschedulable,omitempty"` //节点被cordon，不再分配新端点
+	Drain         *NodeDrain        `json:"drain,omitempty"`         //进行中的排空，admin 重启后继续
 }
 
 //EndpointStatus endpoint status
 type EndpointStatus struct {
-	State       string      `json:"state"`
-	StateDetail string      `json:"stateDetail"`
-	ID          string      `json:"id,omitempty"`
-	IP          string      `json:"ip,omitempty"`
-	Port        int         `json:"port,omitempty"`
-	Gateway     string      `json:"gateway,omitempty"`
-	Node        Node        `json:"node,omitempty"`
-	NodeInfo    interface{} `json:"hostInfo,omitempty"`
+	State        string              `json:"state"`
+	StateDetail  string              `json:"stateDetail"`
+	ID           string              `json:"id,omitempty"`
+	IP           string              `json:"ip,omitempty"`
+	Port         int                 `json:"port,omitempty"`
+	Gateway      string              `json:"gateway,omitempty"`
+	Node         Node                `json:"node,omitempty"`
+	NodeInfo     interface{}         `json:"hostInfo,omitempty"`
+	Conditions   []EndpointCondition `json:"conditions,omitempty"`
+	Job          *JobStatus          `json:"job,omitempty"`
+	ImageDigest  string              `json:"imageDigest,omitempty"`
+	ExitCode     int                 `json:"exitCode,omitempty"` //最近一次退出码
+	OOMKilled    bool                `json:"oomKilled,omitempty"`
+	RestartCount int                 `json:"restartCount,omitempty"`
+	StartedAt    int64               `json:"startedAt,omitempty"`
+	FinishedAt   int64               `json:"finishedAt,omitempty"`
+}
+
+//CrashLoopBackOffState 容器反复退出，等待退避后重启
+const CrashLoopBackOffState = "CrashLoopBackOff"
+
+//NodeStoppingState worker 正在退出，节点不再参与调度
+const NodeStoppingState = "stopping"
+
+//JobStatus 任务运行状态
+type JobStatus struct {
+	Phase            string `json:"phase"`
+	Succeeded        int    `json:"succeeded"`
+	Failed           int    `json:"failed"`
+	LastExitCode     int    `json:"lastExitCode"`
+	Reason           string `json:"reason,omitempty"`
+	StartTime        int64  `json:"startTime,omitempty"`
+	CompletionTime   int64  `json:"completionTime,omitempty"`
+	LastScheduleTime int64  `json:"lastScheduleTime,omitempty"`
+}
+
+const (
+	//JobPending 等待运行或等待下次调度
+	JobPending = "Pending"
+	//JobRunning 运行中
+	JobRunning = "Running"
+	//JobComplete 已完成
+	JobComplete = "Complete"
+	//JobFailed 超过重试次数或运行超时
+	JobFailed = "Failed"
+)
+
+//EndpointCondition endpoint condition
+type EndpointCondition struct {
+	Type               string `json:"type"`
+	Status             bool   `json:"status"`
+	Reason             string `json:"reason,omitempty"`
+	Message            string `json:"message,omitempty"`
+	LastTransitionTime int64  `json:"lastTransitionTime,omitempty"`
+}
+
+const (
+	//ReadyCondition 端点就绪，可接收流量
+	ReadyCondition = "Ready"
+)
+
+//GetCondition ...
+func (s *EndpointStatus) GetCondition(t string) *EndpointCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+//SetCondition ...
+func (s *EndpointStatus) SetCondition(cond EndpointCondition) {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == cond.Type {
+			s.Conditions[i] = cond
+			return
+		}
+	}
+	s.Conditions = append(s.Conditions, cond)
+}
+
+//IsReady 运行中且就绪检查通过，未上报就绪状态时以运行状态为准
+func (s *EndpointStatus) IsReady() bool {
+	if s == nil || s.State != "running" {
+		return false
+	}
+	if cond := s.GetCondition(ReadyCondition); cond != nil {
+		return cond.Status
+	}
+	return true
 }
 
 //String ...
@@ -82,8 +167,60 @@ func (e *Endpoint) ResourcePrefixKey() string {
 
 //EndpointLogOpt 日志输出
 type EndpointLogOpt struct {
-	ID       string `json:"id"`
-	Hostname string `json:"hostname"`
-	Tail     string `json:"tail"`
-	Since    string `json:"since"`
+	ID         string `json:"id"`
+	Hostname   string `json:"hostname"`
+	Tail       string `json:"tail"`
+	Since      string `json:"since"`
+	Until      string `json:"until"`
+	Follow     bool   `json:"follow"`
+	Timestamps bool   `json:"timestamps"`
+}
+
+//EndpointLogLine 一行端点日志
+type EndpointLogLine struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	Stream   string `json:"stream"`         //stdout、stderr，error 为读取日志失败
+	Time     string `json:"time,omitempty"` //RFC3339Nano
+	Log      string `json:"log"`
+}
+
+//EndpointExecOpt 交互式执行参数
+type EndpointExecOpt struct {
+	Cmd  []string `json:"cmd"` //为空时优先使用bash，不存在时使用sh
+	Env  []string `json:"env,omitempty"`
+	User string   `json:"user,omitempty"`
+	Tty  bool     `json:"tty"`
+	Rows uint     `json:"rows,omitempty"`
+	Cols uint     `json:"cols,omitempty"`
+}
+
+//ExecControl exec websocket 的控制帧，以文本消息发送，二进制消息为终端数据
+type ExecControl struct {
+	Type    string `json:"type"`
+	Rows    uint   `json:"rows,omitempty"`    //resize
+	Cols    uint   `json:"cols,omitempty"`    //resize
+	Signal  string `json:"signal,omitempty"`  //signal，如SIGINT、TERM、9
+	Code    int    `json:"code"`              //exit
+	Message string `json:"message,omitempty"` //error
+}
+
+//exec 控制帧类型，resize、signal 由客户端发送，exit、error 由服务端发送
+const (
+	ExecResize = "resize"
+	ExecSignal = "signal"
+	ExecExit   = "exit"
+	ExecError  = "error"
+)
+
+//NodeDrain 节点排空进度
+type NodeDrain struct {
+	Timeout   int    `json:"timeout"`
+	StartTime int64  `json:"startTime"`
+	Service   string `json:"service,omitempty"` //正在排空的服务
+}
+
+//NodeDrainOpt 节点排空参数
+type NodeDrainOpt struct {
+	Name    string `json:"name"`
+	Timeout int    `json:"timeout"` //等待替换端点就绪的秒数，默认300
 }
@@ -1,15 +1,25 @@
 package core
 
-import "encoding/json"
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
 
-//Event 事件
+//Event 事件，同一资源相同操作、状态和原因的事件合并为一条并计数
 type Event struct {
 	*ResourceMeta
-	Action  string `json:"action"`
-	Status  string `json:"status"`
-	From    string `json:"from"`
-	Message string `json:"message"`
-	Number  int64  `json:"number"`
+	ID             string    `json:"id,omitempty"` //合并键的摘要
+	Action         string    `json:"action"`
+	Status         string    `json:"status"`
+	Reason         string    `json:"reason,omitempty"` //为空时按消息合并
+	From           string    `json:"from"`
+	Message        string    `json:"message"`
+	Count          int       `json:"count"`
+	FirstTimestamp time.Time `json:"firstTimestamp"`
+	LastTimestamp  time.Time `json:"lastTimestamp"`
+	Number         int64     `json:"number"` //最后发生时间(UnixNano)，兼容旧版本
 }
 
 const (
@@ -19,8 +29,45 @@ const (
 	DeleteEventAction = "delete"
 	//StartEventAction 启动事件操作
 	StartEventAction = "start"
+	//RestartEventAction 重启事件操作
+	RestartEventAction = "restart"
 	//ImagePullEventAction 拉镜像事件操作
 	ImagePullEventAction = "imagePull"
+	//ScheduleEventAction 调度事件操作
+	ScheduleEventAction = "schedule"
+	//RollingUpdateEventAction 滚动更新事件操作
+	RollingUpdateEventAction = "rollingUpdate"
+	//CordonEventAction 节点停止调度事件操作
+	CordonEventAction = "cordon"
+	//UncordonEventAction 节点恢复调度事件操作
+	UncordonEventAction = "uncordon"
+	//DrainEventAction 节点排空事件操作
+	DrainEventAction = "drain"
+	//JobEventAction 任务运行事件操作
+	JobEventAction = "job"
+	//DependencyEventAction 等待依赖事件操作
+	DependencyEventAction = "dependency"
+	//InitEventAction 初始化容器事件操作
+	InitEventAction = "init"
+	//ConfigEventAction 引用配置更新事件操作
+	ConfigEventAction = "config"
+	//ImageUpdateEventAction 镜像更新事件操作
+	ImageUpdateEventAction = "imageUpdate"
+	//ImageGCEventAction 镜像回收事件操作
+	ImageGCEventAction = "imageGC"
+	//CopyFromEventAction 从容器复制文件事件操作
+	CopyFromEventAction = "cpFrom"
+	//CopyToEventAction 复制文件到容器事件操作
+	CopyToEventAction = "cpTo"
+	//DriftEventAction 容器配置漂移事件操作
+	DriftEventAction = "drift"
+	//StopEventAction 停止事件操作
+	StopEventAction = "stop"
+
+	//PullingEventReason 拉取镜像进度
+	PullingEventReason = "Pulling"
+	//BackOffEventReason 失败后等待重试
+	BackOffEventReason = "BackOff"
 
 	//SuccessEventStatus 成功事件
 	SuccessEventStatus = "success"
@@ -60,7 +107,10 @@ func (l *Event) ResourceKind() string {
 
 //ResourceKey ...
 func (l *Event) ResourceKey() string {
-	return l.Name + "/" + l.Action + "/" + l.Status
+	if l.ID == "" {
+		return l.Name + "/" + l.Action + "/" + l.Status
+	}
+	return l.Name + "/" + l.Action + "/" + l.Status + "/" + l.ID
 }
 
 //ResourcePrefixKey ...
@@ -84,3 +134,21 @@ func (l *Event) GenName(r Resource) {
 	}
 	l.ResourceMeta.Name = r.ResourceGroup() + "/" + r.ResourceKind() + "/" + r.ResourceKey()
 }
+
+//GenID 按原因或消息生成合并键
+func (l *Event) GenID() {
+	key := l.Reason
+	if key == "" {
+		key = l.Message
+	}
+	sum := md5.Sum([]byte(key))
+	l.ID = hex.EncodeToString(sum[:8])
+}
+
+//LastSeen 最后发生时间，兼容没有LastTimestamp 的旧事件
+func (l *Event) LastSeen() time.Time {
+	if !l.LastTimestamp.IsZero() {
+		return l.LastTimestamp
+	}
+	return time.Unix(0, l.Number)
+}
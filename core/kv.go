@@ -23,11 +23,14 @@ type WatchChan struct {
 	Put    bool
 	PrevKV KV
 	KV     KV
+	Rev    int64 //事件的修订版本，首次获取的数据为获取时的版本
 }
 
 //KVRegister 注册
 type KVRegister interface {
 	Close() error
+	//Done 租约失效或撤销后关闭
+	Done() <-chan struct{}
 }
 
 //KVStore kv 存储
@@ -35,7 +38,11 @@ type KVStore interface {
 	Put(ctx context.Context, kv KV) error
 	Get(ctx context.Context, key string, op KVOption) ([]KV, error)
 	GetWithRev(ctx context.Context, key string, op KVOption) ([]KV, int64, error)
+	//PutIfNotModified key(op.WithPrefix 时为前缀)下的键在op.WithRev 之后都未被修改时写入kv，返回是否写入
+	PutIfNotModified(ctx context.Context, kv KV, key string, op KVOption) (bool, error)
 	Delete(ctx context.Context, key string, op KVOption) error
 	Watch(ctx context.Context, key string, updateCh chan WatchChan, errCh chan error, op KVOption)
 	Register(ctx context.Context, kv KV, lease int64) (KVRegister, error)
+	//TryLock key 不存在时写入并绑定租约，租约撤销或过期后释放，已被持有时返回nil
+	TryLock(ctx context.Context, kv KV, lease int64) (KVRegister, error)
 }
@@ -7,6 +7,22 @@ import (
 //Namespace 命名空间
 type Namespace struct {
 	*ResourceMeta
+	Quota      *ResourceQuota `json:"quota,omitempty"`
+	LimitRange *LimitRange    `json:"limitRange,omitempty"`
+}
+
+//ResourceQuota 命名空间内所有服务端点的资源总量上限，0 为不限制
+type ResourceQuota struct {
+	CPU       float64 `json:"cpu,omitempty"`
+	Memory    int64   `json:"memory,omitempty"` //单位与ContainerResource 相同
+	Endpoints int     `json:"endpoints,omitempty"`
+	HostPorts int     `json:"hostPorts,omitempty"`
+}
+
+//LimitRange 命名空间内容器的默认资源限制和上限
+type LimitRange struct {
+	Default *ContainerResource `json:"default,omitempty"` //未设置的资源限制使用默认值
+	Max     *ContainerResource `json:"max,omitempty"`
 }
 
 //String ...
@@ -39,6 +39,14 @@ func (m *ResourceMeta) GetUpdated() int64 {
 	return m.Updated
 }
 
+//GetNamespace ...
+func (m *ResourceMeta) GetNamespace() string {
+	if m == nil {
+		return ""
+	}
+	return m.Namespace
+}
+
 //IsRegister ...
 func (m *ResourceMeta) IsRegister() bool {
 	if m == nil {
@@ -80,7 +88,9 @@ type Resource interface {
 //ResourceStore resource store
 type ResourceStore interface {
 	List(ctx context.Context, arg Resource, opts *ListOptions) ([]Resource, error)
+	ListWithRev(ctx context.Context, arg Resource, opts *ListOptions) ([]Resource, int64, error)
 	Get(ctx context.Context, arg Resource, opts *GetOptions) (Resource, error)
+	GetWithRev(ctx context.Context, arg Resource, opts *GetOptions) (Resource, int64, error)
 	Put(ctx context.Context, arg Resource, opts *PutOptions) (Resource, error)
 	Delete(ctx context.Context, arg Resource, opts *DeleteOptions) error
 }
@@ -88,14 +98,43 @@ type ResourceStore interface {
 type ListOptions struct{}
 type GetOptions struct{}
 type DeleteOptions struct{}
-type PutOptions struct{}
+
+//PutOptions Guard 非空时，Guard 前缀下的资源在GuardRev 之后有修改则不写入，返回ErrResourceModified；
+//Guard 为空而GuardRev 非0 时只检查写入的资源本身
+type PutOptions struct {
+	Guard    Resource
+	GuardRev int64
+}
+
 type CreateOptions struct{}
 type UpdateOptions struct{}
 
 type ResourceLister interface {
 	List() ([]Resource, bool)
+	//ListWithRev 同时返回缓存已同步到的修订版本，用于写入时检查资源是否在此后被修改
+	ListWithRev() ([]Resource, int64, bool)
 }
 
+//ResourceWatcher 监听资源变化，rev 为0 时先以ADDED 输出已有资源
+type ResourceWatcher interface {
+	Watch(ctx context.Context, arg Resource, rev int64, out func(*WatchEvent) error) error
+}
+
+//WatchEvent 资源变化通知
+type WatchEvent struct {
+	Type     string   `json:"type"`
+	Revision int64    `json:"revision"` //重连时从该版本之后继续监听，初始列表中的ADDED 为0
+	Object   Resource `json:"object,omitempty"`
+}
+
+//监听事件类型
+const (
+	WatchAdded    = "ADDED"
+	WatchModified = "MODIFIED"
+	WatchDeleted  = "DELETED"
+	WatchBookmark = "BOOKMARK" //无资源，仅用于更新版本
+)
+
 type ResourceEventHandle struct {
 	Trigger     chan struct{}
 	Interceptor func(put bool, current, pre Resource) (Resource, bool, error)
@@ -103,4 +142,6 @@ type ResourceEventHandle struct {
 
 type ResourceRegister interface {
 	Close() error
+	//Done 租约失效或撤销后关闭
+	Done() <-chan struct{}
 }
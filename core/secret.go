@@ -0,0 +1,82 @@
+package core
+
+import "encoding/json"
+
+//Secret 密钥，加密存储，API 查询时不返回内容
+type Secret struct {
+	*ResourceMeta
+	Data map[string]string `json:"data"`
+}
+
+//SecretEnvSource 从密钥读取的环境变量
+type SecretEnvSource struct {
+	Name   string `json:"name"`   //环境变量名
+	Secret string `json:"secret"` //同命名空间的密钥名
+	Key    string `json:"key"`
+}
+
+//SecretMount 以文件挂载的密钥
+type SecretMount struct {
+	Secret string `json:"secret"`        //同命名空间的密钥名
+	Key    string `json:"key,omitempty"` //为空时挂载目录，每个键一个文件
+	Path   string `json:"path"`          //容器内路径
+}
+
+//RedactedValue 脱敏后的密钥值
+const RedactedValue = "******"
+
+//Redact 返回脱敏的副本
+func (e *Secret) Redact() *Secret {
+	s := &Secret{
+		ResourceMeta: e.ResourceMeta,
+		Data:         make(map[string]string, len(e.Data)),
+	}
+	for k := range e.Data {
+		s.Data[k] = RedactedValue
+	}
+	return s
+}
+
+//String ...
+func (e *Secret) String() string {
+	d, _ := json.Marshal(e)
+	return string(d)
+}
+
+//Parse ...
+func (e *Secret) Parse(s string) error {
+	return json.Unmarshal([]byte(s), e)
+}
+
+//New ...
+func (e *Secret) New() Resource {
+	return &Secret{
+		ResourceMeta: new(ResourceMeta),
+	}
+}
+
+//ResourceGroup ...
+func (e *Secret) ResourceGroup() string {
+	return "secrets"
+}
+
+//ResourceKind ...
+func (e *Secret) ResourceKind() string {
+	return "secret"
+}
+
+//ResourceKey ...
+func (e *Secret) ResourceKey() string {
+	return "namespaces/" + e.Namespace + "/" + e.Name
+}
+
+//ResourcePrefixKey ...
+func (e *Secret) ResourcePrefixKey() string {
+	if e.ResourceMeta == nil {
+		return "namespaces/"
+	}
+	if e.Namespace != "" {
+		return "namespaces/" + e.Namespace + "/" + e.Name
+	}
+	return "namespaces/"
+}
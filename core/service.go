@@ -2,6 +2,8 @@ package core
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"html/template"
@@ -10,10 +12,54 @@ import (
 //Service 服务
 type Service struct {
 	*ResourceMeta
-	Kind          string            `json:"kind"`
-	Endpoints     []ServiceEndpoint `json:"endpoints"`
-	Docker        ContainerService  `json:"docker,omitempty"`
-	VirtualServer *VirtualServer    `json:"vs,omitempty"`
+	Kind           string            `json:"kind"`
+	Replicas       int               `json:"replicas,omitempty"` //大于0时由调度器分配端点
+	Endpoints      []ServiceEndpoint `json:"endpoints"`
+	Docker         ContainerService  `json:"docker,omitempty"`
+	VirtualServer  *VirtualServer    `json:"vs,omitempty"`
+	UpdateStrategy *UpdateStrategy   `json:"updateStrategy,omitempty"`
+	Revision       string            `json:"revision,omitempty"`
+	NodeSelector   map[string]string `json:"nodeSelector,omitempty"`
+	Affinity       *Affinity         `json:"affinity,omitempty"`
+	Disruption     *DisruptionBudget `json:"disruptionBudget,omitempty"`
+	Job            *JobSpec          `json:"job,omitempty"`
+	CronJob        *CronJobSpec      `json:"cronJob,omitempty"`
+	DriftPolicy    string            `json:"driftPolicy,omitempty"` //容器配置被手动修改时的处理，默认report
+}
+
+const (
+	//DockerServiceKind 常驻容器服务
+	DockerServiceKind = "docker"
+	//JobServiceKind 运行至完成的任务
+	JobServiceKind = "job"
+	//CronJobServiceKind 定时任务
+	CronJobServiceKind = "cronjob"
+)
+
+const (
+	//DriftPolicyReport 配置漂移时仅产生事件
+	DriftPolicyReport = "report"
+	//DriftPolicyRepair 配置漂移时产生事件并重建容器
+	DriftPolicyRepair = "repair"
+)
+
+//JobSpec 任务参数
+type JobSpec struct {
+	Completions           int   `json:"completions,omitempty"`           //需成功运行的次数，默认1
+	BackoffLimit          *int  `json:"backoffLimit,omitempty"`          //失败重试次数，默认6
+	ActiveDeadlineSeconds int64 `json:"activeDeadlineSeconds,omitempty"` //任务最长运行时间
+}
+
+//CronJobSpec 定时任务参数
+type CronJobSpec struct {
+	Schedule string `json:"schedule"` //标准cron 表达式
+	Suspend  bool   `json:"suspend,omitempty"`
+}
+
+//DisruptionBudget 主动中断(如排空节点)时的可用性要求
+type DisruptionBudget struct {
+	MinAvailable   int `json:"minAvailable,omitempty"`
+	MaxUnavailable int `json:"maxUnavailable,omitempty"` //每批中断的端点数，默认1
 }
 
 //ServiceEndpoint 服务端点
@@ -22,8 +68,30 @@ type ServiceEndpoint struct {
 	Hostname string                 `json:"hostname"`
 	Config   map[string]interface{} `json:"config"`
 	Domain   string                 `json:"domain,omitempty"`
+	Hold     bool                   `json:"hold,omitempty"`     //滚动更新时暂缓替换
+	Surge    bool                   `json:"surge,omitempty"`    //滚动更新时临时增加的端点
+	Evicting bool                   `json:"evicting,omitempty"` //排空节点时等待替换的端点，不计入副本数
+}
+
+//UpdateStrategy 更新策略
+type UpdateStrategy struct {
+	Type          string         `json:"type,omitempty"`
+	RollingUpdate *RollingUpdate `json:"rollingUpdate,omitempty"`
+}
+
+//RollingUpdate 滚动更新参数
+type RollingUpdate struct {
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+	MaxSurge       int `json:"maxSurge,omitempty"`
 }
 
+const (
+	//RecreateUpdateStrategy 同时重建所有端点，默认策略
+	RecreateUpdateStrategy = "Recreate"
+	//RollingUpdateStrategy 逐个替换端点
+	RollingUpdateStrategy = "RollingUpdate"
+)
+
 //VirtualServer Linux Virtual Server
 type VirtualServer struct {
 	ClusterIP string   `json:"clusterIP,omitempty"`
@@ -81,10 +149,64 @@ func (svc *Service) ResourcePrefixKey() string {
 	return "namespaces/"
 }
 
+//IsRollingUpdate 是否滚动更新
+func (svc *Service) IsRollingUpdate() bool {
+	return svc.UpdateStrategy != nil && svc.UpdateStrategy.Type == RollingUpdateStrategy
+}
+
+//SpecRevision 容器模板版本，与worker 计算容器摘要的字段一致
+func (svc *Service) SpecRevision() string {
+	h := md5.New()
+	h.Write([]byte(svc.Docker.String()))
+	if svc.IsJob() {
+		for _, v := range []interface{}{svc.Kind, svc.Job, svc.CronJob} {
+			d, _ := json.Marshal(v)
+			h.Write(d)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//IsContainer 是否以容器运行
+func (svc *Service) IsContainer() bool {
+	switch svc.Kind {
+	case DockerServiceKind, JobServiceKind, CronJobServiceKind:
+		return true
+	}
+	return false
+}
+
+//IsJob 是否为任务或定时任务
+func (svc *Service) IsJob() bool {
+	return svc.Kind == JobServiceKind || svc.Kind == CronJobServiceKind
+}
+
+//GetCompletions ...
+func (j *JobSpec) GetCompletions() int {
+	if j == nil || j.Completions <= 0 {
+		return 1
+	}
+	return j.Completions
+}
+
+//GetBackoffLimit ...
+func (j *JobSpec) GetBackoffLimit() int {
+	if j == nil || j.BackoffLimit == nil {
+		return 6
+	}
+	return *j.BackoffLimit
+}
+
+//VaultRef vault 密钥的引用，由worker 在创建容器时替换为密钥值
+//模板中参数需使用反引号，如{{ vault `secret/db` `password` }}
+func VaultRef(path, key string) string {
+	return "${oars_vault:" + path + ":" + key + "}"
+}
+
 //ParseContainer ...
 func (svc *Service) ParseContainer(vars ServiceValues) (*ContainerService, error) {
-	if svc.Kind == "docker" {
-		tmpl := template.New("tpl")
+	if svc.IsContainer() {
+		tmpl := template.New("tpl").Funcs(template.FuncMap{"vault": VaultRef})
 		tmpl, err := tmpl.Parse(svc.Docker.String())
 		if err != nil {
 			return nil, err
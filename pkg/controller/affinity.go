@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//match 检查节点是否满足服务的nodeSelector、节点亲和和服务(反)亲和
+func (n *nodeState) match(svc *core.Service, nodes []*nodeState) error {
+	err := svc.MatchNode(n.labels)
+	if err != nil {
+		return err
+	}
+	if svc.Affinity == nil {
+		return nil
+	}
+	for _, term := range svc.Affinity.ServiceAffinity {
+		key := term.Key(svc)
+		if countReplicas(domainNodes(n, term.TopologyKey, nodes), key) > 0 {
+			continue
+		}
+		//亲和自身且尚无副本时允许放置第一个
+		if key == serviceKey(svc) && countReplicas(nodes, key) == 0 {
+			continue
+		}
+		return fmt.Errorf("service affinity %s not satisfied", topologyDesc(term))
+	}
+	for _, term := range svc.Affinity.ServiceAntiAffinity {
+		if countReplicas(domainNodes(n, term.TopologyKey, nodes), term.Key(svc)) > 0 {
+			return fmt.Errorf("service anti-affinity %s not satisfied", topologyDesc(term))
+		}
+	}
+	return nil
+}
+
+//domainNodes 与n 处于同一拓扑域的节点
+func domainNodes(n *nodeState, topologyKey string, nodes []*nodeState) []*nodeState {
+	if topologyKey == "" || topologyKey == core.HostnameLabelKey {
+		return []*nodeState{n}
+	}
+	v, ok := n.labels[topologyKey]
+	if !ok {
+		return []*nodeState{n}
+	}
+	res := make([]*nodeState, 0)
+	for _, node := range nodes {
+		if nv, ok := node.labels[topologyKey]; ok && nv == v {
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+func countReplicas(nodes []*nodeState, key string) int {
+	count := 0
+	for _, n := range nodes {
+		count += n.replicas[key]
+	}
+	return count
+}
+
+func topologyDesc(term core.ServiceAffinityTerm) string {
+	desc := term.Service
+	if term.Namespace != "" {
+		desc = term.Service + "." + term.Namespace
+	}
+	if term.TopologyKey != "" {
+		desc += " by " + term.TopologyKey
+	}
+	return desc
+}
+
+//validatePlacement 检查已分配端点是否满足约束，返回不满足的原因
+func validatePlacement(svc *core.Service, nodes []*nodeState) []string {
+	reasons := make([]string, 0)
+	for _, ed := range svc.Endpoints {
+		n := findNode(nodes, ed.Hostname)
+		if n == nil {
+			continue
+		}
+		//不计算端点自身
+		n.release(svc)
+		err := n.match(svc, nodes)
+		n.allocate(svc)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("endpoint %s on %s: %s", endpointKey(svc, ed), ed.Hostname, err.Error()))
+		}
+	}
+	return reasons
+}
@@ -8,6 +8,9 @@ import (
 func Start(store core.KVStore, cfg *core.Config, stopCh <-chan struct{}) {
 	nodec := newNodec(store)
 	ingressc := newIngress(store, cfg)
+	schedulerc := newScheduler(store)
+	rolloutc := newRollout(store)
+	eventgcc := newEventGC(store, cfg.Server.EventTTL)
 	certc, err := newCert(store)
 	if err != nil {
 		return
@@ -15,12 +18,15 @@ func Start(store core.KVStore, cfg *core.Config, stopCh <-chan struct{}) {
 	nodecStopCh := make(chan struct{})
 	go nodec.runNodec(nodecStopCh)
 	go ingressc.run(nodecStopCh)
+	go schedulerc.run(nodecStopCh)
+	go rolloutc.run(nodecStopCh)
+	go eventgcc.run(nodecStopCh)
 	go certc.run()
 	for {
 		select {
 		case <-stopCh:
-			nodecStopCh <- struct{}{}
-			break
+			close(nodecStopCh)
+			return
 		}
 	}
 }
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func addEvent(store core.ResourceStore, from string, r core.Resource, action, status, msg string) {
+	event := &core.Event{
+		Action:  action,
+		Status:  status,
+		From:    "controller-" + from,
+		Message: msg,
+	}
+	event.GenName(r)
+	err := resStore.RecordEvent(context.Background(), store, event)
+	if err != nil {
+		log.Error(err)
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const eventGCInterval = 10 * time.Minute
+
+//eventGCController 删除最后发生时间超过保留时间的事件
+type eventGCController struct {
+	eventStore core.ResourceStore
+	ttl        time.Duration
+}
+
+func newEventGC(kv core.KVStore, ttl time.Duration) *eventGCController {
+	return &eventGCController{
+		eventStore: resStore.NewStore(kv, new(core.Event)),
+		ttl:        ttl,
+	}
+}
+
+func (c *eventGCController) run(stopCh <-chan struct{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	t := time.NewTicker(eventGCInterval)
+	defer t.Stop()
+	for {
+		c.gc(time.Now())
+		select {
+		case <-stopCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+//gc 返回删除的事件数
+func (c *eventGCController) gc(now time.Time) int {
+	ctx := context.Background()
+	ress, err := c.eventStore.List(ctx, new(core.Event), &core.ListOptions{})
+	if err != nil {
+		log.Error(err)
+		return 0
+	}
+	n := 0
+	for _, res := range ress {
+		event := res.(*core.Event)
+		if now.Sub(event.LastSeen()) < c.ttl {
+			continue
+		}
+		err := c.eventStore.Delete(ctx, event, &core.DeleteOptions{})
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		n++
+	}
+	return n
+}
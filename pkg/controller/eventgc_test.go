@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestEventGC(t *testing.T) {
+	c := newEventGC(newMemKV(), time.Hour)
+	ctx := context.Background()
+	now := time.Now()
+	put := func(name string, last time.Time) {
+		event := &core.Event{
+			ResourceMeta:  &core.ResourceMeta{Namespace: "default", Name: name},
+			Action:        "create",
+			Status:        core.SuccessEventStatus,
+			LastTimestamp: last,
+			Number:        last.UnixNano(),
+		}
+		event.GenID()
+		if _, err := c.eventStore.Put(ctx, event, &core.PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("old", now.Add(-2*time.Hour))
+	put("recent", now.Add(-time.Minute))
+	//旧事件没有LastTimestamp 时按Number 判断
+	legacy := &core.Event{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "legacy"},
+		Action:       "create",
+		Number:       now.Add(-3 * time.Hour).UnixNano(),
+	}
+	legacy.GenID()
+	c.eventStore.Put(ctx, legacy, &core.PutOptions{})
+
+	if n := c.gc(now); n != 2 {
+		t.Fatalf("expected 2 expired events deleted, got %d", n)
+	}
+	ress, err := c.eventStore.List(ctx, new(core.Event), &core.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ress) != 1 || ress[0].(*core.Event).Name != "recent" {
+		t.Fatalf("expected only the unexpired event kept, got %v", ress)
+	}
+	if n := c.gc(now); n != 0 {
+		t.Fatalf("expected nothing left to delete, got %d", n)
+	}
+}
@@ -0,0 +1,254 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//rolloutController 滚动更新，逐个放开被hold 的端点
+type rolloutController struct {
+	kv         core.KVStore
+	trigger    chan struct{}
+	svcStore   core.ResourceStore
+	eventStore core.ResourceStore
+	svcLister  core.ResourceLister
+	edpLister  core.ResourceLister
+	nodeLister core.ResourceLister
+}
+
+func newRollout(kv core.KVStore) *rolloutController {
+	return &rolloutController{
+		kv:         kv,
+		trigger:    make(chan struct{}, 1),
+		svcStore:   resStore.NewStore(kv, new(core.Service)),
+		eventStore: resStore.NewStore(kv, new(core.Event)),
+	}
+}
+
+func (c *rolloutController) run(stopCh <-chan struct{}) error {
+	handle := &core.ResourceEventHandle{
+		Trigger: c.trigger,
+	}
+	svcLister, err := resStore.NewLister(c.kv, new(core.Service), handle)
+	if err != nil {
+		return err
+	}
+	c.svcLister = svcLister
+	edpLister, err := resStore.NewLister(c.kv, new(core.Endpoint), handle)
+	if err != nil {
+		return err
+	}
+	c.edpLister = edpLister
+	node := &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Namespace: core.SystemNamespace,
+		},
+		Service: "node",
+	}
+	nodeLister, err := resStore.NewLister(c.kv, node, &core.ResourceEventHandle{})
+	if err != nil {
+		return err
+	}
+	c.nodeLister = nodeLister
+	go c.update(stopCh)
+	c.scheduler()
+	return nil
+}
+
+func (c *rolloutController) scheduler() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (c *rolloutController) update(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-c.trigger:
+			c.rollout()
+		}
+	}
+}
+
+func (c *rolloutController) rollout() {
+	svcRess, rev, ok := c.svcLister.ListWithRev()
+	if !ok {
+		return
+	}
+	edpRess, ok := c.edpLister.List()
+	if !ok {
+		return
+	}
+	nodeRess, ok := c.nodeLister.List()
+	if !ok {
+		return
+	}
+	svcs := copyServices(svcRess)
+	nodes := nodeStates(nodeRess, svcs)
+	for _, svc := range svcs {
+		if !svc.IsRollingUpdate() || !inRollout(svc) {
+			continue
+		}
+		edps := make(map[string]*core.Endpoint)
+		for _, res := range edpRess {
+			edp := res.(*core.Endpoint)
+			if edp.Namespace == svc.Namespace && edp.Service == serviceName(svc) && edp.Status != nil {
+				edps[edp.Name] = edp
+			}
+		}
+		msgs, changed := rolloutService(svc, edps, nodes)
+		if !changed {
+			continue
+		}
+		//服务在处理期间被修改时不覆盖，缓存同步后按新的定义重新处理
+		_, err := c.svcStore.Put(context.Background(), svc, &core.PutOptions{GuardRev: rev})
+		if err == e.ErrResourceModified {
+			time.AfterFunc(conflictRetryDelay, c.scheduler)
+			continue
+		}
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		status := core.InProgressEventStatus
+		if !inRollout(svc) {
+			status = core.SuccessEventStatus
+		}
+		addEvent(c.eventStore, "rollout", svc, core.RollingUpdateEventAction, status, strings.Join(msgs, "; "))
+	}
+}
+
+//inRollout 是否有未放开的端点或临时端点
+func inRollout(svc *core.Service) bool {
+	for _, ed := range svc.Endpoints {
+		if ed.Hold || ed.Surge {
+			return true
+		}
+	}
+	return false
+}
+
+//rolloutService 根据maxUnavailable、maxSurge 放开端点，返回进度信息和服务是否有变更
+func rolloutService(svc *core.Service, edps map[string]*core.Endpoint, nodes []*nodeState) ([]string, bool) {
+	maxUnavailable, maxSurge := 0, 0
+	if ru := svc.UpdateStrategy.RollingUpdate; ru != nil {
+		maxUnavailable, maxSurge = ru.MaxUnavailable, ru.MaxSurge
+	}
+	if maxUnavailable <= 0 && maxSurge <= 0 {
+		maxUnavailable = 1
+	}
+	msgs := make([]string, 0)
+	changed := false
+	updated := func(ed core.ServiceEndpoint) bool {
+		edp, ok := edps[endpointKey(svc, ed)]
+		return ok && edp.Labels[core.RevisionLabelKey] == svc.Revision && edp.Status.IsReady()
+	}
+
+	total, done, held, unavailable, surges, surgeReady := 0, 0, 0, 0, 0, 0
+	for _, ed := range svc.Endpoints {
+		if ed.Evicting {
+			continue
+		}
+		if ed.Surge {
+			surges++
+			if updated(ed) {
+				surgeReady++
+			}
+			continue
+		}
+		total++
+		switch {
+		case ed.Hold:
+			held++
+			edp, ok := edps[endpointKey(svc, ed)]
+			if !ok || !edp.Status.IsReady() {
+				unavailable++
+			}
+		case updated(ed):
+			done++
+		default:
+			unavailable++
+		}
+	}
+
+	if held == 0 {
+		if done < total {
+			return msgs, false
+		}
+		//全部更新完成，删除临时端点
+		if surges > 0 {
+			eds := make([]core.ServiceEndpoint, 0, total)
+			for _, ed := range svc.Endpoints {
+				if !ed.Surge {
+					eds = append(eds, ed)
+				}
+			}
+			svc.Endpoints = eds
+			changed = true
+		}
+		msgs = append(msgs, fmt.Sprintf("rolling update completed (%d/%d)", done, total))
+		return msgs, changed
+	}
+
+	//增加临时端点
+	for surges < maxSurge {
+		n, err := pickNode(svc, nodes)
+		if err != nil {
+			msgs = append(msgs, "surge: "+err.Error())
+			break
+		}
+		n.allocate(svc)
+		ed := core.ServiceEndpoint{
+			Name:     fmt.Sprintf("%s-surge-%d", serviceName(svc), surges),
+			Hostname: n.name,
+			Surge:    true,
+		}
+		svc.Endpoints = append(svc.Endpoints, ed)
+		msgs = append(msgs, "add surge endpoint "+ed.Name+" on "+ed.Hostname)
+		surges++
+		changed = true
+	}
+
+	budget := maxUnavailable + surgeReady - unavailable
+	for i := range svc.Endpoints {
+		if budget <= 0 {
+			break
+		}
+		if !svc.Endpoints[i].Hold {
+			continue
+		}
+		svc.Endpoints[i].Hold = false
+		budget--
+		changed = true
+		msgs = append(msgs, fmt.Sprintf("update endpoint %s (%d/%d)", endpointKey(svc, svc.Endpoints[i]), done+1, total))
+		done++
+	}
+	return msgs, changed
+}
+
+//serviceName 去掉"@"后缀的服务名
+func serviceName(svc *core.Service) string {
+	return strings.Split(svc.Name, "@")[0]
+}
+
+//endpointKey 端点名称，与worker 的默认命名一致
+func endpointKey(svc *core.Service, ed core.ServiceEndpoint) string {
+	if ed.Name != "" {
+		return ed.Name
+	}
+	if names := strings.Split(svc.Name, "@"); len(names) > 1 {
+		return names[1]
+	}
+	return ed.Hostname
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+)
+
+//memKV 内存kv，只实现Put/Get/Delete 和带修订版本的读写
+type memKV struct {
+	core.KVStore
+	mu   sync.Mutex
+	data map[string]string
+	mod  map[string]int64
+	rev  int64
+}
+
+func newMemKV() *memKV {
+	return &memKV{data: make(map[string]string), mod: make(map[string]int64)}
+}
+
+func (m *memKV) Put(ctx context.Context, kv core.KV) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(kv)
+	return nil
+}
+
+func (m *memKV) put(kv core.KV) {
+	m.rev++
+	m.data[kv.Key] = kv.Value
+	m.mod[kv.Key] = m.rev
+}
+
+func (m *memKV) Get(ctx context.Context, key string, op core.KVOption) ([]core.KV, error) {
+	kvs, _, err := m.GetWithRev(ctx, key, op)
+	return kvs, err
+}
+
+func (m *memKV) GetWithRev(ctx context.Context, key string, op core.KVOption) ([]core.KV, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kvs := make([]core.KV, 0)
+	for k, v := range m.data {
+		if k == key || op.WithPrefix && strings.HasPrefix(k, key) {
+			kvs = append(kvs, core.KV{Key: k, Value: v})
+		}
+	}
+	return kvs, m.rev, nil
+}
+
+func (m *memKV) PutIfNotModified(ctx context.Context, kv core.KV, key string, op core.KVOption) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, rev := range m.mod {
+		if (k == key || op.WithPrefix && strings.HasPrefix(k, key)) && rev > op.WithRev {
+			return false, nil
+		}
+	}
+	m.put(kv)
+	return true, nil
+}
+
+func (m *memKV) Delete(ctx context.Context, key string, op core.KVOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k := range m.data {
+		if k == key || op.WithPrefix && strings.HasPrefix(k, key) {
+			m.rev++
+			delete(m.data, k)
+			m.mod[k] = m.rev
+		}
+	}
+	return nil
+}
+
+//snapshotLister 固定的缓存快照
+type snapshotLister struct {
+	ress []core.Resource
+	rev  int64
+}
+
+func (l *snapshotLister) List() ([]core.Resource, bool) {
+	return l.ress, true
+}
+
+func (l *snapshotLister) ListWithRev() ([]core.Resource, int64, bool) {
+	return l.ress, l.rev, true
+}
+
+func TestRolloutService(t *testing.T) {
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Name: "web", Namespace: "default"},
+		Revision:     "v2",
+		UpdateStrategy: &core.UpdateStrategy{
+			Type: core.RollingUpdateStrategy,
+		},
+		Endpoints: []core.ServiceEndpoint{
+			{Name: "web-0", Hostname: "node1", Hold: true},
+			{Name: "web-1", Hostname: "node2", Hold: true},
+		},
+	}
+	edp := func(name, rev, state string) *core.Endpoint {
+		return &core.Endpoint{
+			ResourceMeta: &core.ResourceMeta{Name: name},
+			Labels:       map[string]string{core.RevisionLabelKey: rev},
+			Status:       &core.EndpointStatus{State: state},
+		}
+	}
+	edps := map[string]*core.Endpoint{
+		"web-0": edp("web-0", "v1", "running"),
+		"web-1": edp("web-1", "v1", "running"),
+	}
+	_, changed := rolloutService(svc, edps, nil)
+	if !changed || svc.Endpoints[0].Hold || !svc.Endpoints[1].Hold {
+		t.Errorf("expect only web-0 released, got %+v", svc.Endpoints)
+		return
+	}
+
+	//web-0 正在重建，不应放开下一个
+	edps["web-0"] = edp("web-0", "v2", "created")
+	_, changed = rolloutService(svc, edps, nil)
+	if changed {
+		t.Errorf("web-1 should wait for web-0 running, got %+v", svc.Endpoints)
+		return
+	}
+
+	edps["web-0"] = edp("web-0", "v2", "running")
+	_, changed = rolloutService(svc, edps, nil)
+	if !changed || svc.Endpoints[1].Hold {
+		t.Errorf("expect web-1 released, got %+v", svc.Endpoints)
+	}
+}
+
+func TestRolloutConflict(t *testing.T) {
+	kv := newMemKV()
+	c := newRollout(kv)
+	ctx := context.Background()
+	svc := &core.Service{
+		ResourceMeta:   &core.ResourceMeta{Name: "web", Namespace: "default"},
+		Kind:           core.DockerServiceKind,
+		Revision:       "v2",
+		UpdateStrategy: &core.UpdateStrategy{Type: core.RollingUpdateStrategy},
+		Endpoints:      []core.ServiceEndpoint{{Name: "web-0", Hostname: "node1", Hold: true}},
+	}
+	c.svcStore.Put(ctx, svc, &core.PutOptions{})
+	ress, rev, _ := c.svcStore.ListWithRev(ctx, &core.Service{ResourceMeta: &core.ResourceMeta{}}, &core.ListOptions{})
+	c.svcLister = &snapshotLister{ress: ress, rev: rev}
+	c.edpLister = &snapshotLister{ress: []core.Resource{&core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"},
+		Service:      "web",
+		Labels:       map[string]string{core.RevisionLabelKey: "v1"},
+		Status:       &core.EndpointStatus{State: "running"},
+	}}}
+	c.nodeLister = &snapshotLister{}
+
+	//缓存快照之后用户更新了服务
+	edited := *svc
+	edited.Revision = "v3"
+	resStore.NewStore(kv, new(core.Service)).Put(ctx, &edited, &core.PutOptions{})
+	c.rollout()
+	res, _ := c.svcStore.Get(ctx, svc, &core.GetOptions{})
+	if cur := res.(*core.Service); cur.Revision != "v3" || !cur.Endpoints[0].Hold {
+		t.Fatalf("expect user update kept, got %+v", cur)
+	}
+
+	//缓存同步后继续滚动更新
+	ress, rev, _ = c.svcStore.ListWithRev(ctx, &core.Service{ResourceMeta: &core.ResourceMeta{}}, &core.ListOptions{})
+	c.svcLister = &snapshotLister{ress: ress, rev: rev}
+	c.rollout()
+	res, _ = c.svcStore.Get(ctx, svc, &core.GetOptions{})
+	if cur := res.(*core.Service); cur.Revision != "v3" || cur.Endpoints[0].Hold {
+		t.Fatalf("expect endpoint released after resync, got %+v", cur)
+	}
+}
@@ -0,0 +1,390 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//conflictRetryDelay 服务在写入前被修改时，等待缓存同步后重新处理的间隔
+const conflictRetryDelay = time.Second
+
+type schedulerController struct {
+	kv         core.KVStore
+	trigger    chan struct{}
+	svcStore   core.ResourceStore
+	eventStore core.ResourceStore
+	svcLister  core.ResourceLister
+	nodeLister core.ResourceLister
+}
+
+//nodeInfo 节点上报的资源信息
+type nodeInfo struct {
+	LogicalCores int   `json:"logicalCores"`
+	Memory       int64 `json:"memory"`
+}
+
+//nodeState 调度时节点的资源占用情况
+type nodeState struct {
+	name     string
+	cpu      float64
+	memory   int64
+	usedCPU  float64
+	usedMem  int64
+	labels   map[string]string
+	replicas map[string]int
+	//unschedulable 已cordon，仅参与资源统计
+	unschedulable bool
+}
+
+func newScheduler(kv core.KVStore) *schedulerController {
+	return &schedulerController{
+		kv:         kv,
+		trigger:    make(chan struct{}, 1),
+		svcStore:   resStore.NewStore(kv, new(core.Service)),
+		eventStore: resStore.NewStore(kv, new(core.Event)),
+	}
+}
+
+func (c *schedulerController) run(stopCh <-chan struct{}) error {
+	handle := &core.ResourceEventHandle{
+		Trigger: c.trigger,
+	}
+	svcLister, err := resStore.NewLister(c.kv, new(core.Service), handle)
+	if err != nil {
+		return err
+	}
+	c.svcLister = svcLister
+	edp := &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Namespace: core.SystemNamespace,
+		},
+		Service: "node",
+	}
+	nodeLister, err := resStore.NewLister(c.kv, edp, handle)
+	if err != nil {
+		return err
+	}
+	c.nodeLister = nodeLister
+	go c.update(stopCh)
+	c.scheduler()
+	return nil
+}
+
+func (c *schedulerController) scheduler() {
+	select {
+	case c.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (c *schedulerController) update(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-c.trigger:
+			c.schedule()
+		}
+	}
+}
+
+func (c *schedulerController) schedule() {
+	svcRess, rev, ok := c.svcLister.ListWithRev()
+	if !ok {
+		return
+	}
+	nodeRess, ok := c.nodeLister.List()
+	if !ok {
+		return
+	}
+	svcs := copyServices(svcRess)
+	nodes := nodeStates(nodeRess, svcs)
+	for _, svc := range svcs {
+		if !svc.IsContainer() {
+			continue
+		}
+		var changed bool
+		var err error
+		if svc.Replicas > 0 {
+			changed, err = scheduleService(svc, nodes)
+		}
+		if err == nil {
+			//手动指定或已分配的端点不满足约束时只上报事件
+			if reasons := validatePlacement(svc, nodes); len(reasons) > 0 {
+				err = errors.New(strings.Join(reasons, "; "))
+			}
+		}
+		if err != nil {
+			addEvent(c.eventStore, "scheduler", svc, core.ScheduleEventAction, core.FailEventStatus, err.Error())
+		}
+		if !changed {
+			continue
+		}
+		//只在服务未被修改时写入，避免覆盖用户的更新
+		_, perr := c.svcStore.Put(context.Background(), svc, &core.PutOptions{GuardRev: rev})
+		if perr == e.ErrResourceModified {
+			time.AfterFunc(conflictRetryDelay, c.scheduler)
+			continue
+		}
+		if perr != nil {
+			log.Error(perr)
+			continue
+		}
+		if err == nil {
+			addEvent(c.eventStore, "scheduler", svc, core.ScheduleEventAction, core.SuccessEventStatus, placement(svc))
+		}
+	}
+}
+
+//copyServices 复制服务，避免修改lister 缓存
+func copyServices(ress []core.Resource) []*core.Service {
+	svcs := make([]*core.Service, 0, len(ress))
+	for _, res := range ress {
+		svc := new(core.Service)
+		err := svc.Parse(res.String())
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		svcs = append(svcs, svc)
+	}
+	return svcs
+}
+
+//nodeStates 运行中的节点及已分配的资源
+func nodeStates(nodeRess []core.Resource, svcs []*core.Service) []*nodeState {
+	nodes := make([]*nodeState, 0)
+	for _, res := range nodeRess {
+		edp := res.(*core.Endpoint)
+		if edp.Status == nil || edp.Status.State != "running" {
+			continue
+		}
+		nodes = append(nodes, newNodeState(edp))
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].name < nodes[j].name
+	})
+	for _, svc := range svcs {
+		for _, ed := range svc.Endpoints {
+			if n := findNode(nodes, ed.Hostname); n != nil {
+				n.allocate(svc)
+			}
+		}
+	}
+	return nodes
+}
+
+//scheduleService 按副本数增删服务端点，返回服务是否有变更
+func scheduleService(svc *core.Service, nodes []*nodeState) (bool, error) {
+	changed := false
+	eds := make([]core.ServiceEndpoint, 0, len(svc.Endpoints))
+	surges := make([]core.ServiceEndpoint, 0)
+	for _, ed := range svc.Endpoints {
+		//临时端点和等待替换的排空端点不计入副本数
+		if ed.Surge || ed.Evicting {
+			surges = append(surges, ed)
+			continue
+		}
+		eds = append(eds, ed)
+	}
+	defer func() {
+		svc.Endpoints = append(eds, surges...)
+	}()
+	for len(eds) > svc.Replicas {
+		ed := eds[len(eds)-1]
+		if n := findNode(nodes, ed.Hostname); n != nil {
+			n.release(svc)
+		}
+		eds = eds[:len(eds)-1]
+		changed = true
+	}
+	//节点已不存在或不在运行的端点重新选择节点
+	for i, ed := range eds {
+		if findNode(nodes, ed.Hostname) != nil {
+			continue
+		}
+		n, err := pickNode(svc, nodes)
+		if err != nil {
+			return changed, fmt.Errorf("endpoint %s on unavailable node %s: %v", ed.Name, ed.Hostname, err)
+		}
+		n.allocate(svc)
+		eds[i] = core.ServiceEndpoint{
+			Name:     endpointName(svc, eds),
+			Hostname: n.name,
+		}
+		changed = true
+	}
+	for len(eds) < svc.Replicas {
+		n, err := pickNode(svc, nodes)
+		if err != nil {
+			return changed, err
+		}
+		n.allocate(svc)
+		eds = append(eds, core.ServiceEndpoint{
+			Name:     endpointName(svc, eds),
+			Hostname: n.name,
+		})
+		changed = true
+	}
+	return changed, nil
+}
+
+//pickNode 选择资源满足且同服务副本最少、负载最低的节点
+func pickNode(svc *core.Service, nodes []*nodeState) (*nodeState, error) {
+	var best *nodeState
+	reasons := make([]string, 0)
+	for _, n := range nodes {
+		if n.unschedulable {
+			reasons = append(reasons, n.name+": unschedulable")
+			continue
+		}
+		if err := n.fit(svc); err != nil {
+			reasons = append(reasons, n.name+": "+err.Error())
+			continue
+		}
+		if err := n.match(svc, nodes); err != nil {
+			reasons = append(reasons, n.name+": "+err.Error())
+			continue
+		}
+		if best == nil {
+			best = n
+			continue
+		}
+		key := serviceKey(svc)
+		if n.replicas[key] != best.replicas[key] {
+			if n.replicas[key] < best.replicas[key] {
+				best = n
+			}
+			continue
+		}
+		if n.load() < best.load() {
+			best = n
+		}
+	}
+	if best == nil {
+		if len(reasons) == 0 {
+			return nil, errors.New("no available node")
+		}
+		return nil, fmt.Errorf("no available node: %s", strings.Join(reasons, "; "))
+	}
+	return best, nil
+}
+
+func newNodeState(edp *core.Endpoint) *nodeState {
+	n := &nodeState{
+		name:          edp.Name,
+		unschedulable: edp.Unschedulable,
+		labels:        map[string]string{core.HostnameLabelKey: edp.Name},
+		replicas:      make(map[string]int),
+	}
+	for k, v := range edp.Labels {
+		n.labels[k] = v
+	}
+	if edp.Status.NodeInfo == nil {
+		return n
+	}
+	d, err := json.Marshal(edp.Status.NodeInfo)
+	if err != nil {
+		return n
+	}
+	info := new(nodeInfo)
+	if err := json.Unmarshal(d, info); err != nil {
+		return n
+	}
+	n.cpu = float64(info.LogicalCores)
+	n.memory = info.Memory
+	return n
+}
+
+func (n *nodeState) fit(svc *core.Service) error {
+	res := svc.Docker.Resources
+	if res == nil {
+		return nil
+	}
+	if n.cpu > 0 && res.CPU > 0 && n.usedCPU+res.CPU > n.cpu {
+		return errors.New("insufficient cpu")
+	}
+	if n.memory > 0 && res.Memory > 0 && n.usedMem+res.MemoryBytes() > n.memory {
+		return errors.New("insufficient memory")
+	}
+	return nil
+}
+
+func (n *nodeState) allocate(svc *core.Service) {
+	n.replicas[serviceKey(svc)]++
+	if res := svc.Docker.Resources; res != nil {
+		n.usedCPU += res.CPU
+		n.usedMem += res.MemoryBytes()
+	}
+}
+
+func (n *nodeState) release(svc *core.Service) {
+	n.replicas[serviceKey(svc)]--
+	if res := svc.Docker.Resources; res != nil {
+		n.usedCPU -= res.CPU
+		n.usedMem -= res.MemoryBytes()
+	}
+}
+
+//load 节点cpu和内存占用比例中较大者
+func (n *nodeState) load() float64 {
+	load := 0.0
+	if n.cpu > 0 {
+		load = n.usedCPU / n.cpu
+	}
+	if n.memory > 0 {
+		if m := float64(n.usedMem) / float64(n.memory); m > load {
+			load = m
+		}
+	}
+	return load
+}
+
+func findNode(nodes []*nodeState, name string) *nodeState {
+	for _, n := range nodes {
+		if n.name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+func serviceKey(svc *core.Service) string {
+	return svc.Namespace + "/" + svc.Name
+}
+
+//endpointName 生成未被占用的端点名称
+func endpointName(svc *core.Service, eds []core.ServiceEndpoint) string {
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s-%d", serviceName(svc), i)
+		exist := false
+		for _, ed := range eds {
+			if ed.Name == name {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			return name
+		}
+	}
+}
+
+func placement(svc *core.Service) string {
+	items := make([]string, 0, len(svc.Endpoints))
+	for _, ed := range svc.Endpoints {
+		items = append(items, ed.Name+"->"+ed.Hostname)
+	}
+	return strings.Join(items, ",")
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestScheduleService(t *testing.T) {
+	nodes := []*nodeState{
+		{name: "node1", cpu: 2, memory: 1 << 30, replicas: make(map[string]int)},
+		{name: "node2", cpu: 4, memory: 1 << 30, replicas: make(map[string]int)},
+	}
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Name: "web", Namespace: "default"},
+		Kind:         "docker",
+		Replicas:     3,
+		Docker: core.ContainerService{
+			Resources: &core.ContainerResource{CPU: 1},
+		},
+	}
+	changed, err := scheduleService(svc, nodes)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !changed || len(svc.Endpoints) != 3 {
+		t.Errorf("expect 3 endpoints, got %v", svc.Endpoints)
+		return
+	}
+	if svc.Endpoints[0].Hostname == svc.Endpoints[1].Hostname {
+		t.Errorf("replicas should spread across nodes: %s", placement(svc))
+	}
+	if svc.Endpoints[2].Hostname != "node2" {
+		t.Errorf("third replica should go to the least loaded node: %s", placement(svc))
+	}
+
+	svc.Replicas = 8
+	_, err = scheduleService(svc, nodes)
+	if err == nil {
+		t.Error("expect insufficient cpu error")
+	}
+
+	svc.Replicas = 1
+	changed, _ = scheduleService(svc, nodes)
+	if !changed || len(svc.Endpoints) != 1 || svc.Endpoints[0].Name != "web-0" {
+		t.Errorf("expect scale down to web-0, got %s", placement(svc))
+	}
+}
+
+func TestScheduleAffinity(t *testing.T) {
+	newNodes := func() []*nodeState {
+		return []*nodeState{
+			{name: "node1", labels: map[string]string{"disk": "hdd", "zone": "a"}, replicas: make(map[string]int)},
+			{name: "node2", labels: map[string]string{"disk": "ssd", "zone": "a"}, replicas: make(map[string]int)},
+			{name: "node3", labels: map[string]string{"disk": "ssd", "zone": "b"}, replicas: make(map[string]int)},
+		}
+	}
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Name: "db", Namespace: "default"},
+		Kind:         "docker",
+		Replicas:     2,
+		NodeSelector: map[string]string{"disk": "ssd"},
+		Affinity: &core.Affinity{
+			ServiceAntiAffinity: []core.ServiceAffinityTerm{{Service: "db"}},
+		},
+	}
+	nodes := newNodes()
+	_, err := scheduleService(svc, nodes)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if placement(svc) != "db-0->node2,db-1->node3" {
+		t.Errorf("unexpected placement %s", placement(svc))
+	}
+	svc.Replicas = 3
+	_, err = scheduleService(svc, nodes)
+	if err == nil {
+		t.Errorf("expect anti-affinity error, got %s", placement(svc))
+	}
+
+	//按zone 反亲和，手动指定的端点违反约束
+	pinned := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Name: "cache", Namespace: "default"},
+		Kind:         "docker",
+		Endpoints: []core.ServiceEndpoint{
+			{Name: "cache-0", Hostname: "node1"},
+			{Name: "cache-1", Hostname: "node2"},
+		},
+		Affinity: &core.Affinity{
+			ServiceAntiAffinity: []core.ServiceAffinityTerm{{Service: "cache", TopologyKey: "zone"}},
+		},
+	}
+	nodes = newNodes()
+	nodes[0].allocate(pinned)
+	nodes[1].allocate(pinned)
+	if reasons := validatePlacement(pinned, nodes); len(reasons) != 2 {
+		t.Errorf("expect 2 violations, got %v", reasons)
+	}
+}
+
+func TestScheduleLostNode(t *testing.T) {
+	newNodes := func(names ...string) []*nodeState {
+		nodes := make([]*nodeState, 0, len(names))
+		for _, name := range names {
+			nodes = append(nodes, &nodeState{name: name, replicas: make(map[string]int)})
+		}
+		return nodes
+	}
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Name: "web", Namespace: "default"},
+		Kind:         "docker",
+		Replicas:     2,
+	}
+	_, err := scheduleService(svc, newNodes("node1", "node2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placement(svc) != "web-0->node1,web-1->node2" {
+		t.Fatalf("unexpected placement %s", placement(svc))
+	}
+
+	//node2 下线后其端点迁移到node1
+	nodes := newNodes("node1")
+	for _, ed := range svc.Endpoints {
+		if n := findNode(nodes, ed.Hostname); n != nil {
+			n.allocate(svc)
+		}
+	}
+	changed, err := scheduleService(svc, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || placement(svc) != "web-0->node1,web-2->node1" {
+		t.Fatalf("expect lost endpoint moved to node1, got %s", placement(svc))
+	}
+
+	//没有可用节点时保留端点并报告
+	svc.Endpoints[1].Hostname = "node3"
+	if _, err := scheduleService(svc, newNodes()); err == nil || len(svc.Endpoints) != 2 {
+		t.Fatalf("expect error and endpoints kept, got %v %s", err, placement(svc))
+	}
+}
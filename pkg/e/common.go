@@ -12,6 +12,9 @@ var (
 	//ErrResourceExisted ...
 	ErrResourceExisted = errors.New("resource had existed")
 
+	//ErrResourceModified resource modified after read
+	ErrResourceModified = errors.New("resource has been modified")
+
 	//ErrCACertNotFound ...
 	ErrCACertNotFound = errors.New("ca cert not found")
 )
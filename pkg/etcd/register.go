@@ -10,6 +10,7 @@ import (
 type register struct {
 	leaseID clientv3.LeaseID
 	client  *clientv3.Client
+	done    chan struct{}
 }
 
 //Register 注册服务
@@ -24,24 +25,53 @@ func (s *Storage) Register(ctx context.Context, kv core.KV, lease int64) (core.K
 	if err != nil {
 		return nil, err
 	}
+	return s.keepAlive(resp.ID)
+}
+
+//TryLock 获取锁，key 已存在时返回nil
+func (s *Storage) TryLock(ctx context.Context, kv core.KV, lease int64) (core.KVRegister, error) {
+	key := s.keyPrefix + "/" + kv.Key
+	resp, err := s.client.Grant(context.Background(), lease)
+	if err != nil {
+		return nil, err
+	}
+	tresp, err := s.client.Txn(context.Background()).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, kv.Value, clientv3.WithLease(resp.ID))).
+		Commit()
+	if err == nil && tresp.Succeeded {
+		return s.keepAlive(resp.ID)
+	}
+	s.client.Revoke(context.Background(), resp.ID)
+	return nil, err
+}
+
+func (s *Storage) keepAlive(id clientv3.LeaseID) (core.KVRegister, error) {
 	//设置续租 定期发送需求请求
-	ch, err := s.client.KeepAlive(context.Background(), resp.ID)
+	ch, err := s.client.KeepAlive(context.Background(), id)
 	if err != nil {
 		return nil, err
 	}
-	go func() {
-		for {
-			<-ch
-		}
-	}()
 	ser := &register{
 		client:  s.client,
-		leaseID: resp.ID,
+		leaseID: id,
+		done:    make(chan struct{}),
 	}
+	go func() {
+		//租约撤销或过期后通道关闭
+		for range ch {
+		}
+		close(ser.done)
+	}()
 
 	return ser, nil
 }
 
+//Done 租约失效或撤销后关闭
+func (s *register) Done() <-chan struct{} {
+	return s.done
+}
+
 // Close 注销服务
 func (s *register) Close() error {
 	//撤销租约
@@ -68,6 +68,22 @@ func (s *Storage) GetWithRev(ctx context.Context, key string, op core.KVOption)
 	return res, gresp.Header.Revision, nil
 }
 
+//PutIfNotModified puts a key-value pair when no key in range was modified after op.WithRev.
+func (s *Storage) PutIfNotModified(ctx context.Context, kv core.KV, key string, op core.KVOption) (bool, error) {
+	key = s.keyPrefix + "/" + key
+	ctx, cancel := s.newEtcdTimeoutContext(ctx)
+	defer cancel()
+	cmp := clientv3.Compare(clientv3.ModRevision(key), "<", op.WithRev+1)
+	if op.WithPrefix {
+		cmp = cmp.WithPrefix()
+	}
+	resp, err := s.client.Txn(ctx).If(cmp).Then(clientv3.OpPut(s.keyPrefix+"/"+kv.Key, kv.Value)).Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
 // Delete delete key
 func (s *Storage) Delete(ctx context.Context, key string, op core.KVOption) error {
 	key = s.keyPrefix + "/" + key
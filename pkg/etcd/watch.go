@@ -2,6 +2,7 @@ package etcd
 
 import (
 	"context"
+	"errors"
 	"strings"
 
 	"github.com/oars-sigs/oars-cloud/core"
@@ -24,19 +25,24 @@ func (s *Storage) Watch(ctx context.Context, key string, updateCh chan core.Watc
 	if !op.DisableFirst {
 		gresp, err := s.client.Get(gctx, key, clientv3.WithPrefix())
 		if err != nil {
-			errCh <- err
-		} else {
-			for _, k := range gresp.Kvs {
-				kv := core.KV{
-					Key:   strings.TrimPrefix(string(k.Key), s.keyPrefix+"/"),
-					Value: string(k.Value),
-				}
-				watch := core.WatchChan{
-					Put:    true,
-					PrevKV: kv,
-					KV:     kv,
-				}
-				updateCh <- watch
+			sendErr(ctx, errCh, err)
+			return
+		}
+		for _, k := range gresp.Kvs {
+			kv := core.KV{
+				Key:   strings.TrimPrefix(string(k.Key), s.keyPrefix+"/"),
+				Value: string(k.Value),
+			}
+			watch := core.WatchChan{
+				Put:    true,
+				PrevKV: kv,
+				KV:     kv,
+				Rev:    gresp.Header.Revision,
+			}
+			select {
+			case updateCh <- watch:
+			case <-ctx.Done():
+				return
 			}
 		}
 		opts = append(opts, clientv3.WithRev(gresp.Header.Revision+1))
@@ -44,13 +50,20 @@ func (s *Storage) Watch(ctx context.Context, key string, updateCh chan core.Watc
 		opts = append(opts, clientv3.WithRev(op.WithRev+1))
 	}
 
-	wch := s.client.Watch(context.Background(), key, opts...)
+	wctx, wcancel := context.WithCancel(ctx)
+	defer wcancel()
+	wch := s.client.Watch(wctx, key, opts...)
 	for {
 		select {
-		case c := <-wch:
+		case c, ok := <-wch:
+			if !ok {
+				sendErr(ctx, errCh, errors.New("watch channel closed"))
+				return
+			}
+			//版本已被压缩等错误后watch 会关闭，由调用方重新获取
 			if c.Err() != nil {
-				errCh <- c.Err()
-				continue
+				sendErr(ctx, errCh, c.Err())
+				return
 			}
 			for _, e := range c.Events {
 				isPut := false
@@ -73,11 +86,23 @@ func (s *Storage) Watch(ctx context.Context, key string, updateCh chan core.Watc
 					Put:    isPut,
 					PrevKV: prev,
 					KV:     kv,
+					Rev:    e.Kv.ModRevision,
+				}
+				select {
+				case updateCh <- watch:
+				case <-ctx.Done():
+					return
 				}
-				updateCh <- watch
 			}
 		case <-ctx.Done():
 			return
 		}
 	}
 }
+
+func sendErr(ctx context.Context, errCh chan error, err error) {
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
+	}
+}
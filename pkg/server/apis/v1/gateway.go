@@ -48,3 +48,36 @@ func (c *GatewayController) Exec(ctx *gin.Context) {
 		return
 	}
 }
+
+//Logs 以SSE 输出服务日志，参数endpoint、follow、timestamps、tail、since、until
+func (c *GatewayController) Logs(ctx *gin.Context) {
+	c.stream(ctx, "endpoint", "logs")
+}
+
+//Watch 以SSE 输出资源变化，参数namespace、rev
+func (c *GatewayController) Watch(ctx *gin.Context) {
+	c.stream(ctx, "watch", ctx.Param("kind"))
+}
+
+//CopyFrom 以tar 包下载端点容器中的文件或目录，参数path
+func (c *GatewayController) CopyFrom(ctx *gin.Context) {
+	c.stream(ctx, "endpoint", "cpFrom")
+}
+
+//CopyTo 将请求体的tar 包解压到端点容器的目录，参数path
+func (c *GatewayController) CopyTo(ctx *gin.Context) {
+	c.stream(ctx, "endpoint", "cpTo")
+}
+
+//stream 调用直接输出响应的操作，未输出时返回结果
+func (c *GatewayController) stream(ctx *gin.Context, resource, action string) {
+	var reply core.APIReply
+	err := c.Mgr.Admin.Call(ctx, resource, action, nil, &reply)
+	if err != nil {
+		ctx.JSON(200, e.InternalError(err))
+		return
+	}
+	if !ctx.Writer.Written() {
+		ctx.JSON(200, reply)
+	}
+}
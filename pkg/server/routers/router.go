@@ -16,4 +16,8 @@ func NewV1(r *gin.Engine, mgr *core.APIManager) {
 	apiv1 := r.Group("/api")
 	apiv1.POST("gateway", gatewayc.Gateway)
 	apiv1.GET("exec/:hostname/:id", gatewayc.Exec)
+	apiv1.GET("logs/:namespace/:service", gatewayc.Logs)
+	apiv1.GET("watch/:kind", gatewayc.Watch)
+	apiv1.GET("cp/:namespace/:service/:endpoint", gatewayc.CopyFrom)
+	apiv1.PUT("cp/:namespace/:service/:endpoint", gatewayc.CopyTo)
 }
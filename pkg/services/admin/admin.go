@@ -18,6 +18,9 @@ type service struct {
 	eventStore           core.ResourceStore
 	certStore            core.ResourceStore
 	cfgStore             core.ResourceStore
+	secretStore          core.ResourceStore
+	secretWatcher        core.ResourceWatcher
+	copyLimit            int64
 }
 
 //New admin api
@@ -32,6 +35,9 @@ func New(store core.KVStore, cfg *core.Config) core.ServiceInterface {
 		eventStore:           resources.NewStore(store, new(core.Event)),
 		certStore:            resources.NewStore(store, new(core.Certificate)),
 		cfgStore:             resources.NewStore(store, new(core.ConfigMap)),
+		secretStore:          resources.NewCipherStore(store, new(core.Secret), cfg.Server.SecretKey),
+		secretWatcher:        resources.NewCipherWatcher(store, new(core.Secret), cfg.Server.SecretKey),
+		copyLimit:            cfg.Server.CopyLimit,
 	}
 	s.PutNamespace(core.Namespace{
 		ResourceMeta: &core.ResourceMeta{
@@ -67,6 +73,7 @@ func New(store core.KVStore, cfg *core.Config) core.ServiceInterface {
 	}, &core.PutOptions{})
 	s.initCert()
 	s.initConfigMap()
+	go s.resumeDrains()
 	return s
 }
 
@@ -79,6 +86,8 @@ func (s *service) Call(ctx context.Context, resource, action string, args interf
 		r = s.regService(ctx, action, args)
 	case "endpoint":
 		r = s.regEndpoint(ctx, action, args)
+	case "node":
+		r = s.regNode(ctx, action, args)
 	case "ingressListener":
 		r = s.regIngressListener(ctx, action, args)
 	case "ingressRoute":
@@ -91,6 +100,10 @@ func (s *service) Call(ctx context.Context, resource, action string, args interf
 		r = s.regCert(ctx, action, args)
 	case "configmap":
 		r = s.regConfigMap(ctx, action, args)
+	case "secret":
+		r = s.regSecret(ctx, action, args)
+	case "watch":
+		r = s.WatchResource(ctx, action)
 	default:
 		r = e.ResourceNotFoundError()
 	}
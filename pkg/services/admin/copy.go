@@ -0,0 +1,156 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/gin-gonic/gin"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+)
+
+//copyTarget 解析路径参数中的端点和查询参数path
+func (s *service) copyTarget(ctx *gin.Context) (*core.Endpoint, string, error) {
+	p := ctx.Query("path")
+	if !path.IsAbs(p) {
+		return nil, "", errors.New("path must be absolute")
+	}
+	res, err := s.edpStore.Get(ctx.Request.Context(), &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: ctx.Param("namespace"), Name: ctx.Param("endpoint")},
+		Service:      ctx.Param("service"),
+	}, &core.GetOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	edp := res.(*core.Endpoint)
+	if edp.Kind != "container" || edp.Status == nil || edp.Status.ID == "" {
+		return nil, "", fmt.Errorf("endpoint %s has no running container", ctx.Param("endpoint"))
+	}
+	return edp, path.Clean(p), nil
+}
+
+//archiveURL worker 的/archive 地址
+func (s *service) archiveURL(edp *core.Endpoint, p string) (string, error) {
+	addr, err := s.getAddr(edp.Status.Node.Hostname)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("id", edp.Status.ID)
+	q.Set("path", p)
+	q.Set("limit", fmt.Sprint(s.copyLimit))
+	return "http://" + addr + "/archive?" + q.Encode(), nil
+}
+
+//archiveError worker 返回的错误，超过大小上限或路径不存在为参数错误
+func archiveError(resp *http.Response) *core.APIReply {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	err := errors.New(strings.TrimSpace(string(msg)))
+	if resp.StatusCode == http.StatusRequestEntityTooLarge || resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return e.InvalidParameterError(err)
+	}
+	return e.InternalError(err)
+}
+
+//CopyFromEndPoint 以tar 包下载端点容器中的文件或目录
+func (s *service) CopyFromEndPoint(cc context.Context) *core.APIReply {
+	ctx, ok := cc.(*gin.Context)
+	if !ok {
+		return core.NewAPIError(errors.New("context error"))
+	}
+	edp, p, err := s.copyTarget(ctx)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	fail := func(msg string) {
+		s.addEvent(edp, core.CopyFromEventAction, core.FailEventStatus, fmt.Sprintf("copy %s from container failed: %s", p, msg))
+	}
+	u, err := s.archiveURL(edp, p)
+	if err != nil {
+		fail(err.Error())
+		return e.InternalError(err)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return e.InternalError(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx.Request.Context()))
+	if err != nil {
+		fail(err.Error())
+		return e.InternalError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		r := archiveError(resp)
+		fail(r.SubMsg)
+		return r
+	}
+	ctx.Header("Content-Type", "application/x-tar")
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", path.Base(p)+".tar"))
+	ctx.Status(http.StatusOK)
+	n, err := io.Copy(ctx.Writer, resp.Body)
+	if err != nil {
+		fail(err.Error())
+		//已开始输出，中断连接使客户端感知传输失败
+		panic(http.ErrAbortHandler)
+	}
+	s.addEvent(edp, core.CopyFromEventAction, core.SuccessEventStatus, fmt.Sprintf("copied %s from container, %s", p, units.HumanSize(float64(n))))
+	return core.NewAPIReply("")
+}
+
+//CopyToEndPoint 将请求体的tar 包解压到端点容器的path 目录
+func (s *service) CopyToEndPoint(cc context.Context) *core.APIReply {
+	ctx, ok := cc.(*gin.Context)
+	if !ok {
+		return core.NewAPIError(errors.New("context error"))
+	}
+	edp, p, err := s.copyTarget(ctx)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	fail := func(msg string) {
+		s.addEvent(edp, core.CopyToEventAction, core.FailEventStatus, fmt.Sprintf("copy to %s in container failed: %s", p, msg))
+	}
+	if s.copyLimit > 0 && ctx.Request.ContentLength > s.copyLimit {
+		err := fmt.Errorf("archive size %d exceeds the limit %d", ctx.Request.ContentLength, s.copyLimit)
+		fail(err.Error())
+		return e.InvalidParameterError(err)
+	}
+	u, err := s.archiveURL(edp, p)
+	if err != nil {
+		fail(err.Error())
+		return e.InternalError(err)
+	}
+	req, err := http.NewRequest(http.MethodPut, u, ctx.Request.Body)
+	if err != nil {
+		return e.InternalError(err)
+	}
+	req.ContentLength = ctx.Request.ContentLength
+	req.Header.Set("Content-Type", "application/x-tar")
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx.Request.Context()))
+	if err != nil {
+		fail(err.Error())
+		return e.InternalError(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		r := archiveError(resp)
+		fail(r.SubMsg)
+		return r
+	}
+	//worker 返回写入的字节数
+	n, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 32))
+	size, _ := strconv.ParseInt(strings.TrimSpace(string(n)), 10, 64)
+	s.addEvent(edp, core.CopyToEventAction, core.SuccessEventStatus, fmt.Sprintf("copied %s to %s in container", units.HumanSize(float64(size)), p))
+	return core.NewAPIReply("")
+}
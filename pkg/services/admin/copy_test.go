@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestCopyFromEndPointCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	started, closed, stop := make(chan struct{}, 1), make(chan struct{}, 1), make(chan struct{})
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tar"))
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			closed <- struct{}{}
+		case <-stop:
+		}
+	}))
+	defer worker.Close()
+	defer close(stop)
+	host, port, _ := net.SplitHostPort(worker.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	s := newMemService()
+	bg := context.Background()
+	s.edpStore.Put(bg, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: core.SystemNamespace, Name: "node1"},
+		Service:      "node",
+		Status:       &core.EndpointStatus{ID: "node1", IP: host, Port: p, State: "running"},
+	}, &core.PutOptions{})
+	s.edpStore.Put(bg, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"},
+		Kind:         "container",
+		Service:      "web",
+		Status:       &core.EndpointStatus{ID: "c1", State: "running", Node: core.Node{Hostname: "node1"}},
+	}, &core.PutOptions{})
+
+	ctx, cancel := context.WithCancel(bg)
+	defer cancel()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?path=/etc", nil).WithContext(ctx)
+	c.Params = gin.Params{{Key: "namespace", Value: "default"}, {Key: "service", Value: "web"}, {Key: "endpoint", Value: "web-0"}}
+	done := make(chan struct{})
+	go func() {
+		//传输中断时以ErrAbortHandler 结束
+		defer func() {
+			recover()
+			close(done)
+		}()
+		s.CopyFromEndPoint(c)
+	}()
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker archive not requested")
+	}
+
+	//客户端断开后关闭到worker 的请求
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker archive request not closed after client disconnect")
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("copy handler did not return after client disconnect")
+	}
+}
@@ -2,11 +2,11 @@ package admin
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/rpc"
-	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -25,6 +25,12 @@ func (s *service) regEndpoint(ctx context.Context, action string, args interface
 		return s.StopEndPoint(args)
 	case "log":
 		return s.GetEndPointLog(args)
+	case "logs":
+		return s.StreamEndPointLog(ctx)
+	case "cpFrom":
+		return s.CopyFromEndPoint(ctx)
+	case "cpTo":
+		return s.CopyToEndPoint(ctx)
 	case "exec":
 		return s.ExecEndPoint(ctx, args)
 	case "event":
@@ -168,6 +174,7 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+//ExecEndPoint 代理到worker 的exec 连接，参数cmd、env 可重复，另有user、tty、rows、cols
 func (s *service) ExecEndPoint(cc context.Context, args interface{}) *core.APIReply {
 	ctx, ok := cc.(*gin.Context)
 	if !ok {
@@ -180,25 +187,28 @@ func (s *service) ExecEndPoint(cc context.Context, args interface{}) *core.APIRe
 	defer c.Close()
 
 	hostname := ctx.Param("hostname")
-	id := ctx.Param("id")
+	q := ctx.Request.URL.Query()
+	q.Set("id", ctx.Param("id"))
 
 	addr, err := s.getAddr(hostname)
 	if err != nil {
+		execError(c, err)
 		return core.NewAPIError(err)
 	}
-
-	addr = "ws://" + addr + "/exec?id=" + id
-	err = s.connExec(addr+"&cmd=bash", c)
+	err = s.connExec("ws://"+addr+"/exec?"+q.Encode(), c)
 	if err != nil {
-		err = s.connExec(addr+"&cmd=sh", c)
-		if err != nil {
-			return core.NewAPIError(err)
-		}
+		execError(c, err)
+		return core.NewAPIError(err)
 	}
-	fmt.Println(addr)
 	return core.NewAPIReply("")
 }
 
+func execError(c *websocket.Conn, err error) {
+	data, _ := json.Marshal(&core.ExecControl{Type: core.ExecError, Message: err.Error()})
+	c.WriteMessage(websocket.TextMessage, data)
+}
+
+//connExec 双向转发消息，保持消息类型以区分终端数据和控制帧
 func (s *service) connExec(addr string, c *websocket.Conn) error {
 	cli, resp, err := websocket.DefaultDialer.Dial(addr, nil)
 	if err != nil {
@@ -207,54 +217,26 @@ func (s *service) connExec(addr string, c *websocket.Conn) error {
 	defer resp.Body.Close()
 
 	defer cli.Close()
-	stopCh := make(chan error)
-	go func() {
-		i := 0
+	stopCh := make(chan error, 2)
+	pipe := func(dst, src *websocket.Conn) {
 		for {
-			mt, data, err := cli.ReadMessage()
+			mt, data, err := src.ReadMessage()
 			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					dst.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+					err = nil
+				}
 				stopCh <- err
-				break
-			}
-			if i == 0 && strings.HasPrefix(string(data), "OCI runtime exec failed:") {
-				stopCh <- errors.New("not found cmd")
-				break
+				return
 			}
-			if i == 0 {
-				go func() {
-					for {
-						mt, data, err := c.ReadMessage()
-						if err != nil {
-							stopCh <- err
-							break
-						}
-						err = cli.WriteMessage(mt, data)
-						if err != nil {
-							stopCh <- err
-							break
-						}
-					}
-				}()
-			}
-			i = 1
-			err = c.WriteMessage(mt, data)
+			err = dst.WriteMessage(mt, data)
 			if err != nil {
 				stopCh <- err
-				break
-			}
-			if mt == websocket.CloseMessage {
-				stopCh <- nil
-				break
-			}
-		}
-	}()
-	for {
-		select {
-		case err := <-stopCh:
-			if err != nil {
-				return err
+				return
 			}
-			return nil
 		}
 	}
+	go pipe(c, cli)
+	go pipe(cli, c)
+	return <-stopCh
 }
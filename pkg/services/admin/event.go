@@ -2,9 +2,13 @@ package admin
 
 import (
 	"context"
+	"sort"
 
 	"github.com/oars-sigs/oars-cloud/core"
 	"github.com/oars-sigs/oars-cloud/pkg/e"
+	"github.com/oars-sigs/oars-cloud/pkg/store/resources"
+
+	"github.com/sirupsen/logrus"
 )
 
 func (s *service) regEvent(ctx context.Context, action string, args interface{}) *core.APIReply {
@@ -26,5 +30,23 @@ func (s *service) GetEvent(args interface{}) *core.APIReply {
 	if err != nil {
 		return e.InternalError(err)
 	}
+	//按最后发生时间排列成时间线
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].(*core.Event).LastSeen().Before(events[j].(*core.Event).LastSeen())
+	})
 	return core.NewAPIReply(events)
 }
+
+func (s *service) addEvent(r core.Resource, action, status, msg string) {
+	event := &core.Event{
+		Action:  action,
+		Status:  status,
+		From:    "admin",
+		Message: msg,
+	}
+	event.GenName(r)
+	err := resources.RecordEvent(context.TODO(), s.eventStore, event)
+	if err != nil {
+		logrus.Error(err)
+	}
+}
@@ -0,0 +1,250 @@
+package admin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+)
+
+//logMergeWindow 跟踪日志时，空闲端点使其他端点日志最多延迟输出的时间
+const logMergeWindow = time.Second
+
+//StreamEndPointLog 以SSE 输出端点日志，未指定端点时按时间合并服务所有端点的日志
+func (s *service) StreamEndPointLog(cc context.Context) *core.APIReply {
+	c, ok := cc.(*gin.Context)
+	if !ok {
+		return core.NewAPIError(errors.New("context error"))
+	}
+	//gin.Context 不会在客户端断开时取消，使用请求的context
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	opt := core.EndpointLogOpt{
+		Tail:       c.Query("tail"),
+		Since:      c.Query("since"),
+		Until:      c.Query("until"),
+		Follow:     c.Query("follow") == "true",
+		Timestamps: c.Query("timestamps") == "true",
+	}
+	namespace, svc, name := c.Param("namespace"), c.Param("service"), c.Query("endpoint")
+	ress, err := s.edpStore.List(ctx, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: namespace},
+		Service:      svc,
+	}, &core.ListOptions{})
+	if err != nil {
+		return e.InternalError(err)
+	}
+	edps := make([]*core.Endpoint, 0)
+	for _, res := range ress {
+		edp := res.(*core.Endpoint)
+		if edp.Namespace != namespace || edp.Service != svc || edp.Kind != "container" || edp.Status == nil || edp.Status.ID == "" {
+			continue
+		}
+		if name == "" || edp.Name == name {
+			edps = append(edps, edp)
+		}
+	}
+	if len(edps) == 0 {
+		return e.InvalidParameterError(fmt.Errorf("no endpoints found for %s.%s", svc, namespace))
+	}
+	streams := make([]<-chan *core.EndpointLogLine, 0, len(edps))
+	for _, edp := range edps {
+		ch := make(chan *core.EndpointLogLine, 100)
+		streams = append(streams, ch)
+		go s.readEndpointLog(ctx, edp, opt, ch)
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	window := time.Duration(0)
+	if opt.Follow {
+		window = logMergeWindow
+	}
+	mergeLogs(ctx, streams, window, func(l *core.EndpointLogLine) error {
+		if !opt.Timestamps {
+			l.Time = ""
+		}
+		data, _ := json.Marshal(l)
+		_, err := fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+		c.Writer.Flush()
+		return err
+	})
+	return core.NewAPIReply("")
+}
+
+//readEndpointLog 读取worker 输出的SSE 日志，读取失败时输出一行error 日志
+func (s *service) readEndpointLog(ctx context.Context, edp *core.Endpoint, opt core.EndpointLogOpt, ch chan<- *core.EndpointLogLine) {
+	defer close(ch)
+	send := func(l *core.EndpointLogLine) bool {
+		l.Endpoint = edp.Name
+		select {
+		case ch <- l:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	fail := func(err error) {
+		send(&core.EndpointLogLine{Stream: "error", Time: time.Now().Format(time.RFC3339Nano), Log: err.Error()})
+	}
+	addr, err := s.getAddr(edp.Status.Node.Hostname)
+	if err != nil {
+		fail(err)
+		return
+	}
+	q := url.Values{}
+	q.Set("id", edp.Status.ID)
+	q.Set("tail", opt.Tail)
+	q.Set("since", opt.Since)
+	q.Set("until", opt.Until)
+	q.Set("follow", fmt.Sprint(opt.Follow))
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/logs?"+q.Encode(), nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		fail(err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fail(fmt.Errorf("worker returned %s", resp.Status))
+		return
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := strings.TrimPrefix(line, "data: ")
+			if event == "error" {
+				fail(errors.New(data))
+				return
+			}
+			l := new(core.EndpointLogLine)
+			if json.Unmarshal([]byte(data), l) != nil {
+				continue
+			}
+			if !send(l) {
+				return
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		fail(err)
+	}
+}
+
+type pendingLog struct {
+	line *core.EndpointLogLine
+	t    time.Time //日志时间
+	at   time.Time //收到时间
+}
+
+//mergeLogs 按时间合并多个各自有序的日志流，所有未结束的流都有待输出的行时输出最早的一行
+//window 大于0 时用于跟踪日志，空闲的流最多使输出延迟window
+func mergeLogs(ctx context.Context, streams []<-chan *core.EndpointLogLine, window time.Duration, out func(*core.EndpointLogLine) error) error {
+	type item struct {
+		i    int
+		line *core.EndpointLogLine
+	}
+	recv := make(chan item)
+	done := make(chan struct{})
+	defer close(done)
+	for i, ch := range streams {
+		go func(i int, ch <-chan *core.EndpointLogLine) {
+			for l := range ch {
+				select {
+				case recv <- item{i, l}:
+				case <-done:
+					return
+				}
+			}
+			select {
+			case recv <- item{i, nil}:
+			case <-done:
+			}
+		}(i, ch)
+	}
+	queues := make([][]pendingLog, len(streams))
+	open := make([]bool, len(streams))
+	for i := range open {
+		open[i] = true
+	}
+	active := len(streams)
+	for {
+		//输出可以确定顺序的行，有等待超过window 的行时不再等待空闲的流
+		for {
+			min, ready, oldest := -1, true, time.Time{}
+			for i, q := range queues {
+				if len(q) == 0 {
+					if open[i] {
+						ready = false
+					}
+					continue
+				}
+				if min < 0 || q[0].t.Before(queues[min][0].t) {
+					min = i
+				}
+				if oldest.IsZero() || q[0].at.Before(oldest) {
+					oldest = q[0].at
+				}
+			}
+			if min < 0 || (!ready && (window <= 0 || time.Since(oldest) < window)) {
+				break
+			}
+			err := out(queues[min][0].line)
+			if err != nil {
+				return err
+			}
+			queues[min] = queues[min][1:]
+		}
+		if active == 0 {
+			return nil
+		}
+		var timeout <-chan time.Time
+		if window > 0 {
+			oldest := time.Time{}
+			for _, q := range queues {
+				if len(q) > 0 && (oldest.IsZero() || q[0].at.Before(oldest)) {
+					oldest = q[0].at
+				}
+			}
+			if !oldest.IsZero() {
+				timeout = time.After(time.Until(oldest.Add(window)))
+			}
+		}
+		select {
+		case it := <-recv:
+			if it.line == nil {
+				open[it.i] = false
+				active--
+				continue
+			}
+			t, _ := time.Parse(time.RFC3339Nano, it.line.Time)
+			queues[it.i] = append(queues[it.i], pendingLog{line: it.line, t: t, at: time.Now()})
+		case <-timeout:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
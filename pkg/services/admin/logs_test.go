@@ -0,0 +1,120 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func logStream(lines ...string) chan *core.EndpointLogLine {
+	ch := make(chan *core.EndpointLogLine, len(lines))
+	for _, l := range lines {
+		ch <- &core.EndpointLogLine{Time: "2021-06-01T10:00:0" + l + "Z", Log: l}
+	}
+	return ch
+}
+
+func TestMergeLogs(t *testing.T) {
+	a := logStream("1", "4", "5")
+	b := logStream("2", "3", "6")
+	close(a)
+	close(b)
+	res := ""
+	err := mergeLogs(context.Background(), []<-chan *core.EndpointLogLine{a, b}, 0, func(l *core.EndpointLogLine) error {
+		res += l.Log
+		return nil
+	})
+	if err != nil || res != "123456" {
+		t.Fatalf("expect logs merged in time order, got %q %v", res, err)
+	}
+
+	//跟踪时空闲的流不会一直阻塞输出
+	a = logStream("1")
+	b = make(chan *core.EndpointLogLine)
+	out := make(chan string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mergeLogs(ctx, []<-chan *core.EndpointLogLine{a, b}, 100*time.Millisecond, func(l *core.EndpointLogLine) error {
+		out <- l.Log
+		return nil
+	})
+	select {
+	case l := <-out:
+		if l != "1" {
+			t.Fatalf("unexpected line %q", l)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("idle stream blocked merged output")
+	}
+}
+
+func TestStreamEndPointLogCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	started, closed, stop := make(chan struct{}, 1), make(chan struct{}, 1), make(chan struct{})
+	worker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "data: {\"log\":\"1\"}\n\n")
+		w.(http.Flusher).Flush()
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			closed <- struct{}{}
+		case <-stop:
+		}
+	}))
+	defer worker.Close()
+	defer close(stop)
+	host, port, _ := net.SplitHostPort(worker.Listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+
+	s := newMemService()
+	bg := context.Background()
+	s.edpStore.Put(bg, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: core.SystemNamespace, Name: "node1"},
+		Service:      "node",
+		Status:       &core.EndpointStatus{ID: "node1", IP: host, Port: p, State: "running"},
+	}, &core.PutOptions{})
+	s.edpStore.Put(bg, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"},
+		Kind:         "container",
+		Service:      "web",
+		Status:       &core.EndpointStatus{ID: "c1", State: "running", Node: core.Node{Hostname: "node1"}},
+	}, &core.PutOptions{})
+
+	ctx, cancel := context.WithCancel(bg)
+	defer cancel()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?follow=true", nil).WithContext(ctx)
+	c.Params = gin.Params{{Key: "namespace", Value: "default"}, {Key: "service", Value: "web"}}
+	done := make(chan struct{})
+	go func() {
+		s.StreamEndPointLog(c)
+		close(done)
+	}()
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker log stream not requested")
+	}
+
+	//客户端断开后关闭worker 的日志流
+	cancel()
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker log stream not closed after client disconnect")
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream handler did not return after client disconnect")
+	}
+}
@@ -28,6 +28,10 @@ func (s *service) PutNamespace(args interface{}) *core.APIReply {
 	if !nameRegex.MatchString(ns.Name) {
 		return e.InvalidParameterError()
 	}
+	err = validateNamespaceLimits(&ns)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
 	ctx := context.TODO()
 	_, err = s.nsStore.Put(ctx, &ns, &core.PutOptions{})
 	if err != nil {
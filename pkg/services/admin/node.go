@@ -0,0 +1,533 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+	"github.com/oars-sigs/oars-cloud/pkg/store/resources"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultDrainTimeout = 300
+
+//drainLockLease 排空锁的租约，持有的admin 退出后由其他实例继续排空
+const drainLockLease = 30
+
+var (
+	//drainPollInterval 检查替换端点是否就绪的间隔
+	drainPollInterval = 2 * time.Second
+	//drainResumeInterval 检查无人处理的排空的间隔
+	drainResumeInterval = time.Minute
+)
+
+func (s *service) regNode(ctx context.Context, action string, args interface{}) *core.APIReply {
+	switch action {
+	case "get":
+		return s.GetNode(args)
+	case "cordon":
+		return s.CordonNode(args, true)
+	case "uncordon":
+		return s.CordonNode(args, false)
+	case "drain":
+		return s.DrainNode(args)
+	}
+	return e.MethodNotFoundMethod()
+}
+
+//drainPlan 单个服务在待排空节点上的端点
+type drainPlan struct {
+	svc       *core.Service
+	endpoints []core.ServiceEndpoint
+	batch     int
+}
+
+func (s *service) GetNode(args interface{}) *core.APIReply {
+	var node core.Endpoint
+	err := unmarshalArgs(args, &node)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	if node.ResourceMeta == nil {
+		node.ResourceMeta = new(core.ResourceMeta)
+	}
+	node.Namespace = core.SystemNamespace
+	node.Service = "node"
+	return s.GetEndPoint(node)
+}
+
+func (s *service) CordonNode(args interface{}, unschedulable bool) *core.APIReply {
+	var arg core.Endpoint
+	err := unmarshalArgs(args, &arg)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	if arg.ResourceMeta == nil || arg.Name == "" {
+		return e.InvalidParameterError(errors.New("node name is required"))
+	}
+	ctx := context.TODO()
+	if s.getNode(ctx, arg.Name) == nil {
+		return e.InvalidParameterError(errors.New("not found node " + arg.Name))
+	}
+	node, err := s.setUnschedulable(ctx, arg.Name, unschedulable)
+	if err != nil {
+		return e.InternalError(err)
+	}
+	return core.NewAPIReply(node)
+}
+
+func (s *service) DrainNode(args interface{}) *core.APIReply {
+	var opt core.NodeDrainOpt
+	err := unmarshalArgs(args, &opt)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	ctx := context.TODO()
+	node := s.getNode(ctx, opt.Name)
+	if node == nil {
+		return e.InvalidParameterError(errors.New("not found node " + opt.Name))
+	}
+	lock, err := s.lockDrain(node)
+	if err != nil {
+		return e.InternalError(err)
+	}
+	if lock == nil || node.Drain != nil {
+		if lock != nil {
+			lock.Close()
+		}
+		return e.InvalidParameterError(errors.New("node " + opt.Name + " is already draining"))
+	}
+	if opt.Timeout <= 0 {
+		opt.Timeout = defaultDrainTimeout
+	}
+	plans, err := s.drainPlans(ctx, node.Name)
+	if err != nil {
+		lock.Close()
+		s.addEvent(node, core.DrainEventAction, core.FailEventStatus, err.Error())
+		return e.InvalidParameterError(err)
+	}
+	cordoned := false
+	node, err = s.updateNode(ctx, node.Name, func(n *core.Endpoint) bool {
+		cordoned = n.Unschedulable
+		n.Unschedulable = true
+		n.Drain = &core.NodeDrain{
+			Timeout:   opt.Timeout,
+			StartTime: time.Now().Unix(),
+		}
+		return true
+	})
+	if err != nil || node == nil {
+		lock.Close()
+		return e.InternalError(err)
+	}
+	if !cordoned {
+		s.addEvent(node, core.CordonEventAction, core.SuccessEventStatus, "")
+	}
+	s.addEvent(node, core.DrainEventAction, core.InProgressEventStatus, fmt.Sprintf("draining %d services", len(plans)))
+	go s.drain(node, plans, lock)
+	svcs := make([]string, 0, len(plans))
+	for _, p := range plans {
+		svcs = append(svcs, p.svc.Name+"."+p.svc.Namespace)
+	}
+	return core.NewAPIReply(svcs)
+}
+
+//getNode 按名称精确查找节点
+func (s *service) getNode(ctx context.Context, name string) *core.Endpoint {
+	node, _ := s.getNodeWithRev(ctx, name)
+	return node
+}
+
+func (s *service) getNodeWithRev(ctx context.Context, name string) (*core.Endpoint, int64) {
+	res, rev, err := s.edpStore.GetWithRev(ctx, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Namespace: core.SystemNamespace,
+			Name:      name,
+		},
+		Service: "node",
+	}, &core.GetOptions{})
+	if err != nil {
+		return nil, rev
+	}
+	node := res.(*core.Endpoint)
+	if node.Name != name {
+		return nil, rev
+	}
+	return node, rev
+}
+
+//updateNode 读取最新的节点，update 返回true 时写入，期间被worker 等修改则重新读取；返回最新的节点，不存在时为nil
+func (s *service) updateNode(ctx context.Context, name string, update func(node *core.Endpoint) bool) (*core.Endpoint, error) {
+	for i := 0; ; i++ {
+		node, rev := s.getNodeWithRev(ctx, name)
+		if node == nil || !update(node) {
+			return node, nil
+		}
+		_, err := s.edpStore.Put(ctx, node, &core.PutOptions{GuardRev: rev})
+		if err != e.ErrResourceModified || i >= conflictRetries {
+			return node, err
+		}
+	}
+}
+
+func (s *service) setUnschedulable(ctx context.Context, name string, unschedulable bool) (*core.Endpoint, error) {
+	action := core.UncordonEventAction
+	if unschedulable {
+		action = core.CordonEventAction
+	}
+	changed := false
+	node, err := s.updateNode(ctx, name, func(n *core.Endpoint) bool {
+		changed = n.Unschedulable != unschedulable
+		//uncordon 取消进行中的排空
+		drain := !unschedulable && n.Drain != nil
+		if drain {
+			n.Drain = nil
+		}
+		n.Unschedulable = unschedulable
+		return changed || drain
+	})
+	if err != nil || node == nil {
+		return node, err
+	}
+	if changed {
+		s.addEvent(node, action, core.SuccessEventStatus, "")
+	}
+	return node, nil
+}
+
+//lockDrain 获取节点的排空锁，已被其他排空持有时返回nil
+func (s *service) lockDrain(node *core.Endpoint) (core.ResourceRegister, error) {
+	return resources.TryLock(s.store, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Namespace:  core.SystemNamespace,
+			Name:       node.Name,
+			ObjectKind: &core.ResourceObjectKind{IsLock: true},
+		},
+		Service: "node-drain",
+	}, drainLockLease)
+}
+
+//drainPlans 找出节点上的容器端点，并检查中断预算
+func (s *service) drainPlans(ctx context.Context, hostname string) ([]*drainPlan, error) {
+	ress, err := s.svcStore.List(ctx, new(core.Service), &core.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	plans := make([]*drainPlan, 0)
+	violations := make([]string, 0)
+	for _, res := range ress {
+		svc := res.(*core.Service)
+		if !svc.IsContainer() {
+			continue
+		}
+		p := &drainPlan{svc: svc, batch: 1}
+		for _, ed := range svc.Endpoints {
+			if ed.Hostname == hostname {
+				p.endpoints = append(p.endpoints, ed)
+			}
+		}
+		if len(p.endpoints) == 0 {
+			continue
+		}
+		budget := svc.Disruption
+		if budget != nil && budget.MaxUnavailable > 0 {
+			p.batch = budget.MaxUnavailable
+		}
+		if budget != nil && budget.MinAvailable > 0 {
+			edps, err := s.serviceEndpoints(ctx, svc)
+			if err != nil {
+				return nil, err
+			}
+			available, onNode := 0, 0
+			for _, edp := range edps {
+				if !edp.Status.IsReady() {
+					continue
+				}
+				available++
+				if edp.Status.Node.Hostname == hostname {
+					onNode++
+				}
+			}
+			//调度器管理的端点会迁移，一批中断batch 个；手动指定的端点被停止后不会恢复
+			lost := onNode
+			if svc.Replicas > 0 && p.batch < lost {
+				lost = p.batch
+			}
+			if available-lost < budget.MinAvailable {
+				violations = append(violations, fmt.Sprintf("service %s.%s: %d available, draining would leave %d, minAvailable is %d",
+					svc.Name, svc.Namespace, available, available-lost, budget.MinAvailable))
+				continue
+			}
+			if svc.Replicas > 0 && available-p.batch < budget.MinAvailable {
+				p.batch = available - budget.MinAvailable
+			}
+		}
+		plans = append(plans, p)
+	}
+	if len(violations) > 0 {
+		return nil, errors.New(strings.Join(violations, "; "))
+	}
+	sort.Slice(plans, func(i, j int) bool {
+		return plans[i].svc.Namespace+"/"+plans[i].svc.Name < plans[j].svc.Namespace+"/"+plans[j].svc.Name
+	})
+	return plans, nil
+}
+
+//drain 逐个服务、分批迁移或停止端点，进度记录在节点上，持有排空锁直到结束
+func (s *service) drain(node *core.Endpoint, plans []*drainPlan, lock core.ResourceRegister) {
+	defer lock.Close()
+	ctx := context.Background()
+	timeout := time.Duration(node.Drain.Timeout) * time.Second
+	for _, p := range plans {
+		if !s.updateDrain(ctx, node.Name, p.svc.Name+"."+p.svc.Namespace) {
+			s.addEvent(node, core.DrainEventAction, core.FailEventStatus, "drain cancelled")
+			return
+		}
+		for i := 0; i < len(p.endpoints); i += p.batch {
+			select {
+			case <-lock.Done():
+				//锁已失效，由取得锁的实例继续
+				logrus.Warnf("drain lock of node %s lost", node.Name)
+				return
+			default:
+			}
+			end := i + p.batch
+			if end > len(p.endpoints) {
+				end = len(p.endpoints)
+			}
+			var err error
+			if p.svc.Replicas > 0 {
+				err = s.evictEndpoints(ctx, p.svc, p.endpoints[i:end], node.Name, timeout)
+			} else {
+				err = s.stopEndpoints(ctx, p.svc, p.endpoints[i:end])
+			}
+			if err != nil {
+				logrus.Error(err)
+				s.finishDrain(ctx, node.Name)
+				s.addEvent(node, core.DrainEventAction, core.FailEventStatus, fmt.Sprintf("service %s.%s: %s", p.svc.Name, p.svc.Namespace, err.Error()))
+				return
+			}
+		}
+		s.addEvent(node, core.DrainEventAction, core.InProgressEventStatus, fmt.Sprintf("service %s.%s drained", p.svc.Name, p.svc.Namespace))
+	}
+	s.finishDrain(ctx, node.Name)
+	s.addEvent(node, core.DrainEventAction, core.SuccessEventStatus, "")
+}
+
+//updateDrain 记录正在排空的服务，排空已取消时返回false
+func (s *service) updateDrain(ctx context.Context, name, svc string) bool {
+	draining := false
+	_, err := s.updateNode(ctx, name, func(n *core.Endpoint) bool {
+		if n.Drain == nil {
+			return false
+		}
+		draining = true
+		n.Drain.Service = svc
+		return true
+	})
+	if err != nil {
+		logrus.Error(err)
+	}
+	return draining
+}
+
+//finishDrain 清除排空进度，节点保持cordon
+func (s *service) finishDrain(ctx context.Context, name string) {
+	_, err := s.updateNode(ctx, name, func(n *core.Endpoint) bool {
+		if n.Drain == nil {
+			return false
+		}
+		n.Drain = nil
+		return true
+	})
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+//resumeDrains 定期继续没有实例处理的排空，如发起排空的admin 已退出
+func (s *service) resumeDrains() {
+	for {
+		s.resumeOrphanDrains()
+		time.Sleep(drainResumeInterval)
+	}
+}
+
+func (s *service) resumeOrphanDrains() {
+	ctx := context.Background()
+	ress, err := s.edpStore.List(ctx, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: core.SystemNamespace},
+		Service:      "node",
+	}, &core.ListOptions{})
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for _, res := range ress {
+		node := res.(*core.Endpoint)
+		if node.Drain == nil {
+			continue
+		}
+		lock, err := s.lockDrain(node)
+		if err != nil {
+			logrus.Error(err)
+			continue
+		}
+		if lock == nil {
+			//正在由其他实例排空
+			continue
+		}
+		//取得锁前排空可能已结束
+		if node = s.getNode(ctx, node.Name); node == nil || node.Drain == nil {
+			lock.Close()
+			continue
+		}
+		plans, err := s.drainPlans(ctx, node.Name)
+		if err != nil {
+			s.finishDrain(ctx, node.Name)
+			lock.Close()
+			s.addEvent(node, core.DrainEventAction, core.FailEventStatus, err.Error())
+			continue
+		}
+		s.addEvent(node, core.DrainEventAction, core.InProgressEventStatus, fmt.Sprintf("resume draining %d services", len(plans)))
+		go s.drain(node, plans, lock)
+	}
+}
+
+//evictEndpoints 标记端点等待替换，调度器在其他节点补齐副本，新端点就绪后再删除旧端点
+func (s *service) evictEndpoints(ctx context.Context, svc *core.Service, eds []core.ServiceEndpoint, hostname string, timeout time.Duration) error {
+	err := s.markEvicting(ctx, svc, eds, true)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(drainPollInterval)
+		ok, err := s.replaced(ctx, svc, hostname)
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			//保留旧端点，不造成中断
+			if err := s.markEvicting(ctx, svc, eds, false); err != nil {
+				logrus.Error(err)
+			}
+			return errors.New("timeout waiting for replacement endpoints")
+		}
+	}
+	return s.updateService(ctx, svc, func(cur *core.Service) bool {
+		endpoints := make([]core.ServiceEndpoint, 0, len(cur.Endpoints))
+		for _, ed := range cur.Endpoints {
+			if !ed.Evicting || !containsEndpoint(eds, ed) {
+				endpoints = append(endpoints, ed)
+			}
+		}
+		changed := len(endpoints) != len(cur.Endpoints)
+		cur.Endpoints = endpoints
+		return changed
+	})
+}
+
+//markEvicting 设置或取消端点的等待替换标记
+func (s *service) markEvicting(ctx context.Context, svc *core.Service, eds []core.ServiceEndpoint, evicting bool) error {
+	return s.updateService(ctx, svc, func(cur *core.Service) bool {
+		changed := false
+		for i, ed := range cur.Endpoints {
+			if ed.Evicting != evicting && containsEndpoint(eds, ed) {
+				cur.Endpoints[i].Evicting = evicting
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+func containsEndpoint(eds []core.ServiceEndpoint, ed core.ServiceEndpoint) bool {
+	for _, r := range eds {
+		if ed.Name == r.Name && ed.Hostname == r.Hostname {
+			return true
+		}
+	}
+	return false
+}
+
+//replaced 不含排空端点的副本数已补齐，且都已就绪
+func (s *service) replaced(ctx context.Context, svc *core.Service, hostname string) (bool, error) {
+	cur := s.getService(ctx, svc)
+	if cur == nil {
+		return true, nil
+	}
+	edps, err := s.serviceEndpoints(ctx, cur)
+	if err != nil {
+		return false, err
+	}
+	count := 0
+	for _, ed := range cur.Endpoints {
+		if ed.Evicting || ed.Surge {
+			continue
+		}
+		count++
+		//同批次之外的端点仍在排空节点上运行
+		if ed.Hostname == hostname {
+			continue
+		}
+		ready := false
+		for _, edp := range edps {
+			if edp.Name == ed.Name && edp.Status.Node.Hostname == ed.Hostname {
+				ready = edp.Status.IsReady()
+				break
+			}
+		}
+		if !ready {
+			return false, nil
+		}
+	}
+	return count >= cur.Replicas, nil
+}
+
+//stopEndpoints 停止手动指定节点的端点
+func (s *service) stopEndpoints(ctx context.Context, svc *core.Service, eds []core.ServiceEndpoint) error {
+	edps, err := s.serviceEndpoints(ctx, svc)
+	if err != nil {
+		return err
+	}
+	for _, ed := range eds {
+		for _, edp := range edps {
+			if edp.Name != ed.Name || edp.Status.Node.Hostname != ed.Hostname || edp.Status.ID == "" {
+				continue
+			}
+			r := s.StopEndPoint(edp)
+			if r.Code != core.ServiceSuccessCode {
+				return fmt.Errorf("stop endpoint %s: %s", edp.Name, r.SubMsg)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *service) serviceEndpoints(ctx context.Context, svc *core.Service) ([]*core.Endpoint, error) {
+	ress, err := s.edpStore.List(ctx, &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{Namespace: svc.Namespace},
+		Service:      strings.Split(svc.Name, "@")[0],
+	}, &core.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	edps := make([]*core.Endpoint, 0, len(ress))
+	for _, res := range ress {
+		edp := res.(*core.Endpoint)
+		if edp.Status != nil {
+			edps = append(edps, edp)
+		}
+	}
+	return edps, nil
+}
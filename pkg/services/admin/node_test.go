@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/store/resources"
+)
+
+//memKV 内存kv，只实现Put/Get/Delete 和带修订版本的读写
+type memKV struct {
+	core.KVStore
+	mu   sync.Mutex
+	data map[string]string
+	mod  map[string]int64
+	rev  int64
+}
+
+func (m *memKV) Put(ctx context.Context, kv core.KV) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.put(kv)
+	return nil
+}
+
+func (m *memKV) put(kv core.KV) {
+	m.rev++
+	m.data[kv.Key] = kv.Value
+	m.mod[kv.Key] = m.rev
+}
+
+func (m *memKV) PutIfNotModified(ctx context.Context, kv core.KV, key string, op core.KVOption) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for k, rev := range m.mod {
+		if (k == key || op.WithPrefix && strings.HasPrefix(k, key)) && rev > op.WithRev {
+			return false, nil
+		}
+	}
+	m.put(kv)
+	return true, nil
+}
+
+func (m *memKV) Get(ctx context.Context, key string, op core.KVOption) ([]core.KV, error) {
+	kvs, _, err := m.GetWithRev(ctx, key, op)
+	return kvs, err
+}
+
+func (m *memKV) GetWithRev(ctx context.Context, key string, op core.KVOption) ([]core.KV, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kvs := make([]core.KV, 0)
+	for k, v := range m.data {
+		if k == key || op.WithPrefix && strings.HasPrefix(k, key) {
+			kvs = append(kvs, core.KV{Key: k, Value: v})
+		}
+	}
+	return kvs, m.rev, nil
+}
+
+func (m *memKV) Delete(ctx context.Context, key string, op core.KVOption) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	delete(m.mod, key)
+	return nil
+}
+
+//Watch 没有变化，阻塞到ctx 结束
+func (m *memKV) Watch(ctx context.Context, key string, updateCh chan core.WatchChan, errCh chan error, op core.KVOption) {
+	<-ctx.Done()
+}
+
+//TryLock 锁保存为普通key，Close 时删除
+func (m *memKV) TryLock(ctx context.Context, kv core.KV, lease int64) (core.KVRegister, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[kv.Key]; ok {
+		return nil, nil
+	}
+	m.put(kv)
+	return &memLock{kv: m, key: kv.Key, done: make(chan struct{})}, nil
+}
+
+type memLock struct {
+	kv   *memKV
+	key  string
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *memLock) Close() error {
+	l.once.Do(func() {
+		l.kv.Delete(context.Background(), l.key, core.KVOption{})
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *memLock) Done() <-chan struct{} {
+	return l.done
+}
+
+func newMemService() *service {
+	kv := &memKV{data: make(map[string]string), mod: make(map[string]int64)}
+	return &service{
+		store:      kv,
+		edpStore:   resources.NewStore(kv, new(core.Endpoint)),
+		nsStore:    resources.NewStore(kv, new(core.Namespace)),
+		svcStore:   resources.NewStore(kv, new(core.Service)),
+		eventStore: resources.NewStore(kv, new(core.Event)),
+	}
+}
+
+func TestDrainNode(t *testing.T) {
+	drainPollInterval = 10 * time.Millisecond
+	s := newMemService()
+	ctx := context.Background()
+	putEdp := func(svc, name, host string) {
+		s.edpStore.Put(ctx, &core.Endpoint{
+			ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: name},
+			Service:      svc,
+			Status:       &core.EndpointStatus{State: "running", Node: core.Node{Hostname: host}},
+		}, &core.PutOptions{})
+	}
+	for _, n := range []string{"node1", "node2"} {
+		s.edpStore.Put(ctx, &core.Endpoint{
+			ResourceMeta: &core.ResourceMeta{Namespace: core.SystemNamespace, Name: n},
+			Service:      "node",
+			Status:       &core.EndpointStatus{State: "running"},
+		}, &core.PutOptions{})
+	}
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web"},
+		Kind:         core.DockerServiceKind,
+		Replicas:     1,
+		Endpoints:    []core.ServiceEndpoint{{Name: "web-0", Hostname: "node1"}},
+	}
+	s.svcStore.Put(ctx, svc, &core.PutOptions{})
+	putEdp("web", "web-0", "node1")
+
+	r := s.DrainNode(&core.NodeDrainOpt{Name: "node1", Timeout: 5})
+	if r.Code != core.ServiceSuccessCode {
+		t.Fatalf("drain failed: %+v", r)
+	}
+	node := s.getNode(ctx, "node1")
+	if !node.Unschedulable || node.Drain == nil {
+		t.Fatalf("expect drain recorded on node, got %+v", node)
+	}
+
+	//替换端点就绪前保留旧端点
+	time.Sleep(50 * time.Millisecond)
+	cur := s.getService(ctx, svc)
+	if len(cur.Endpoints) != 1 || !cur.Endpoints[0].Evicting {
+		t.Fatalf("expect endpoint kept and marked evicting, got %+v", cur.Endpoints)
+	}
+	//排空期间只有一个实例持有锁
+	if lock, _ := s.lockDrain(node); lock != nil {
+		t.Fatal("expect drain lock held while draining")
+	}
+	if r := s.DrainNode(&core.NodeDrainOpt{Name: "node1"}); r.Code == core.ServiceSuccessCode {
+		t.Fatal("expect second drain rejected")
+	}
+
+	//排空期间保存服务不丢失排空状态
+	edit := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web"},
+		Kind:         core.DockerServiceKind,
+		Replicas:     1,
+		Endpoints:    []core.ServiceEndpoint{{Name: "web-0", Hostname: "node1"}},
+	}
+	if r := s.PutService(edit); r.Code != core.ServiceSuccessCode {
+		t.Fatalf("put service failed: %+v", r)
+	}
+	cur = s.getService(ctx, svc)
+	if len(cur.Endpoints) != 1 || !cur.Endpoints[0].Evicting {
+		t.Fatalf("expect evicting flag kept after PutService, got %+v", cur.Endpoints)
+	}
+
+	//模拟调度器在其他节点补齐副本
+	cur.Endpoints = append(cur.Endpoints, core.ServiceEndpoint{Name: "web-1", Hostname: "node2"})
+	s.svcStore.Put(ctx, cur, &core.PutOptions{})
+	putEdp("web", "web-1", "node2")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		cur = s.getService(ctx, svc)
+		if node = s.getNode(ctx, "node1"); node.Drain == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if node.Drain != nil || !node.Unschedulable {
+		t.Fatalf("expect drain finished with node cordoned, got %+v", node)
+	}
+	if len(cur.Endpoints) != 1 || cur.Endpoints[0].Name != "web-1" {
+		t.Fatalf("expect evicted endpoint removed, got %+v", cur.Endpoints)
+	}
+	time.Sleep(20 * time.Millisecond)
+	lock, _ := s.lockDrain(node)
+	if lock == nil {
+		t.Fatal("expect drain lock released after drain")
+	}
+	lock.Close()
+}
@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+)
+
+//conflictRetries 读取后资源被并发修改时的重试次数
+const conflictRetries = 5
+
+//applyNamespaceLimits 按命名空间的LimitRange 补全资源限制，并检查ResourceQuota，
+//返回写入服务的选项，检查后同命名空间的服务有修改时写入失败，避免并发创建超出配额
+func (s *service) applyNamespaceLimits(ctx context.Context, svc *core.Service) (*core.PutOptions, *core.APIReply) {
+	opts := &core.PutOptions{}
+	res, err := s.nsStore.Get(ctx, &core.Namespace{ResourceMeta: &core.ResourceMeta{Name: svc.Namespace}}, &core.GetOptions{})
+	if err == e.ErrResourceNotFound {
+		//命名空间不存在时不限制
+		return opts, nil
+	}
+	if err != nil {
+		return nil, e.InternalError(err)
+	}
+	ns := res.(*core.Namespace)
+	if ns.Name != svc.Namespace {
+		return opts, nil
+	}
+	err = applyLimitRange(ns.LimitRange, svc)
+	if err != nil {
+		return nil, e.InvalidParameterError(err)
+	}
+	if ns.Quota == nil {
+		return opts, nil
+	}
+	arg := &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: svc.Namespace}}
+	ress, rev, err := s.svcStore.ListWithRev(ctx, arg, &core.ListOptions{})
+	if err != nil {
+		return nil, e.InternalError(err)
+	}
+	used := new(core.ResourceQuota)
+	for _, res := range ress {
+		other := res.(*core.Service)
+		if other.Namespace != svc.Namespace || other.Name == svc.Name {
+			continue
+		}
+		addUsage(used, serviceUsage(other))
+	}
+	err = checkQuota(ns.Quota, used, svc)
+	if err != nil {
+		return nil, e.InvalidParameterError(err)
+	}
+	opts.Guard = arg
+	opts.GuardRev = rev
+	return opts, nil
+}
+
+//validateNamespaceLimits 检查配额和默认值
+func validateNamespaceLimits(ns *core.Namespace) error {
+	if q := ns.Quota; q != nil && (q.CPU < 0 || q.Memory < 0 || q.Endpoints < 0 || q.HostPorts < 0) {
+		return fmt.Errorf("quota must not be negative")
+	}
+	lr := ns.LimitRange
+	if lr == nil || lr.Default == nil || lr.Max == nil {
+		return nil
+	}
+	if (lr.Max.CPU > 0 && lr.Default.CPU > lr.Max.CPU) || (lr.Max.Memory > 0 && lr.Default.Memory > lr.Max.Memory) {
+		return fmt.Errorf("default resource exceeds the max of limitRange")
+	}
+	return nil
+}
+
+//applyLimitRange 补全默认资源限制并检查上限
+func applyLimitRange(lr *core.LimitRange, svc *core.Service) error {
+	if lr == nil {
+		return nil
+	}
+	if lr.Default != nil {
+		if svc.Docker.Resources == nil {
+			svc.Docker.Resources = new(core.ContainerResource)
+		}
+		if svc.Docker.Resources.CPU == 0 {
+			svc.Docker.Resources.CPU = lr.Default.CPU
+		}
+		if svc.Docker.Resources.Memory == 0 {
+			svc.Docker.Resources.Memory = lr.Default.Memory
+		}
+	}
+	if lr.Max == nil {
+		return nil
+	}
+	r := svc.Docker.Resources
+	if r == nil {
+		r = new(core.ContainerResource)
+	}
+	if lr.Max.CPU > 0 && (r.CPU == 0 || r.CPU > lr.Max.CPU) {
+		return fmt.Errorf("cpu %v exceeds the limit %v of namespace %s", r.CPU, lr.Max.CPU, svc.Namespace)
+	}
+	if lr.Max.Memory > 0 && (r.Memory == 0 || r.Memory > lr.Max.Memory) {
+		return fmt.Errorf("memory %d exceeds the limit %d of namespace %s", r.Memory, lr.Max.Memory, svc.Namespace)
+	}
+	return nil
+}
+
+//checkQuota 检查加入服务后是否超过配额，配额限制的资源要求服务设置对应的资源限制
+func checkQuota(quota, used *core.ResourceQuota, svc *core.Service) error {
+	req := serviceUsage(svc)
+	r := svc.Docker.Resources
+	if quota.CPU > 0 {
+		if r == nil || r.CPU == 0 {
+			return fmt.Errorf("cpu limit is required by the quota of namespace %s", svc.Namespace)
+		}
+		if used.CPU+req.CPU > quota.CPU {
+			return fmt.Errorf("exceeded quota of namespace %s: requested cpu %v, used %v, limited %v", svc.Namespace, req.CPU, used.CPU, quota.CPU)
+		}
+	}
+	if quota.Memory > 0 {
+		if r == nil || r.Memory == 0 {
+			return fmt.Errorf("memory limit is required by the quota of namespace %s", svc.Namespace)
+		}
+		if used.Memory+req.Memory > quota.Memory {
+			return fmt.Errorf("exceeded quota of namespace %s: requested memory %d, used %d, limited %d", svc.Namespace, req.Memory, used.Memory, quota.Memory)
+		}
+	}
+	if quota.Endpoints > 0 && used.Endpoints+req.Endpoints > quota.Endpoints {
+		return fmt.Errorf("exceeded quota of namespace %s: requested endpoints %d, used %d, limited %d", svc.Namespace, req.Endpoints, used.Endpoints, quota.Endpoints)
+	}
+	if quota.HostPorts > 0 && used.HostPorts+req.HostPorts > quota.HostPorts {
+		return fmt.Errorf("exceeded quota of namespace %s: requested host ports %d, used %d, limited %d", svc.Namespace, req.HostPorts, used.HostPorts, quota.HostPorts)
+	}
+	return nil
+}
+
+//serviceUsage 服务所有端点占用的资源
+func serviceUsage(svc *core.Service) *core.ResourceQuota {
+	n := 0
+	for _, edp := range svc.Endpoints {
+		//滚动更新时临时增加的端点不计入
+		if !edp.Surge {
+			n++
+		}
+	}
+	if svc.Replicas > n {
+		n = svc.Replicas
+	}
+	usage := &core.ResourceQuota{
+		Endpoints: n,
+		HostPorts: n * hostPorts(svc.Docker.Ports),
+	}
+	if r := svc.Docker.Resources; r != nil {
+		usage.CPU = float64(n) * r.CPU
+		usage.Memory = int64(n) * r.Memory
+	}
+	return usage
+}
+
+func addUsage(total, usage *core.ResourceQuota) {
+	total.CPU += usage.CPU
+	total.Memory += usage.Memory
+	total.Endpoints += usage.Endpoints
+	total.HostPorts += usage.HostPorts
+}
+
+//hostPorts 绑定主机端口的映射数，端口段按段内端口数计算，只有容器端口的不计入
+func hostPorts(ports []string) int {
+	n := 0
+	for _, p := range ports {
+		mappings, err := nat.ParsePortSpec(p)
+		if err != nil {
+			//模板等无法解析的端口，含主机端口时按一个计算
+			if strings.Contains(p, ":") {
+				n++
+			}
+			continue
+		}
+		for _, m := range mappings {
+			if m.Binding.HostPort != "" {
+				n++
+			}
+		}
+	}
+	return n
+}
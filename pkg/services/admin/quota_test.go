@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+	"github.com/oars-sigs/oars-cloud/pkg/store/resources"
+)
+
+//errKV 读取总是失败的kv
+type errKV struct {
+	core.KVStore
+}
+
+func (errKV) Get(ctx context.Context, key string, op core.KVOption) ([]core.KV, error) {
+	return nil, errors.New("etcdserver: request timed out")
+}
+
+func TestQuota(t *testing.T) {
+	lr := &core.LimitRange{
+		Default: &core.ContainerResource{CPU: 0.5, Memory: 512 * 1024},
+		Max:     &core.ContainerResource{CPU: 2},
+	}
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Namespace: "dev", Name: "web"},
+		Replicas:     2,
+		Docker:       core.ContainerService{Ports: []string{"8080:80", "9000-9001:9000-9001"}},
+	}
+	err := applyLimitRange(lr, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := svc.Docker.Resources; r == nil || r.CPU != 0.5 || r.Memory != 512*1024 {
+		t.Fatalf("expect default resources applied, got %+v", r)
+	}
+	usage := serviceUsage(svc)
+	if usage.CPU != 1 || usage.Endpoints != 2 || usage.HostPorts != 6 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	if n := hostPorts([]string{"80", "9000-9001/udp", "127.0.0.1::81", "127.0.0.1:8081:81", "{{.port}}:80"}); n != 2 {
+		t.Fatalf("expect only host bindings counted, got %d", n)
+	}
+	used := &core.ResourceQuota{CPU: 3, Endpoints: 1}
+	if err := checkQuota(&core.ResourceQuota{CPU: 4, Endpoints: 3}, used, svc); err != nil {
+		t.Fatalf("expect within quota, got %v", err)
+	}
+	err = checkQuota(&core.ResourceQuota{CPU: 3.5}, used, svc)
+	if err == nil || !strings.Contains(err.Error(), "exceeded quota") {
+		t.Fatalf("expect cpu quota exceeded, got %v", err)
+	}
+	if err := checkQuota(&core.ResourceQuota{HostPorts: 5}, used, svc); err == nil {
+		t.Fatal("expect host port quota exceeded")
+	}
+
+	svc.Docker.Resources.CPU = 4
+	if err := applyLimitRange(lr, svc); err == nil {
+		t.Fatal("expect limitRange max exceeded")
+	}
+}
+
+func TestQuotaAdmission(t *testing.T) {
+	s := newMemService()
+	ctx := context.Background()
+	s.nsStore.Put(ctx, &core.Namespace{
+		ResourceMeta: &core.ResourceMeta{Name: "dev"},
+		Quota:        &core.ResourceQuota{HostPorts: 2},
+	}, &core.PutOptions{})
+	newSvc := func(name, port string) *core.Service {
+		return &core.Service{
+			ResourceMeta: &core.ResourceMeta{Namespace: "dev", Name: name},
+			Kind:         core.DockerServiceKind,
+			Replicas:     1,
+			Docker:       core.ContainerService{Ports: []string{port}},
+		}
+	}
+	if r := s.PutService(newSvc("web", "8080:80")); r.Code != core.ServiceSuccessCode {
+		t.Fatalf("put web: %+v", r)
+	}
+
+	//检查配额后有其他服务写入，不能超出配额
+	api := newSvc("api", "8081:80")
+	opts, r := s.applyNamespaceLimits(ctx, api)
+	if r != nil {
+		t.Fatalf("admit api: %+v", r)
+	}
+	s.svcStore.Put(ctx, newSvc("admin", "8082:80"), &core.PutOptions{})
+	if _, err := s.svcStore.Put(ctx, api, opts); err != e.ErrResourceModified {
+		t.Fatalf("expect concurrent put rejected, got %v", err)
+	}
+	if r := s.PutService(api); r.Code != core.ServiceInvalidParameterCode || !strings.Contains(r.SubMsg, "exceeded quota") {
+		t.Fatalf("expect quota exceeded after retry, got %+v", r)
+	}
+	//只有容器端口的服务不占用主机端口
+	if r := s.PutService(newSvc("worker", "9000")); r.Code != core.ServiceSuccessCode {
+		t.Fatalf("put worker: %+v", r)
+	}
+
+	//读取命名空间失败时不跳过配额检查
+	s.nsStore = resources.NewStore(errKV{}, new(core.Namespace))
+	if r := s.PutService(newSvc("cache", "6379:6379")); r.Code != core.ServiceInternalErrorCode {
+		t.Fatalf("expect store error reported, got %+v", r)
+	}
+}
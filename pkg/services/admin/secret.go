@@ -0,0 +1,70 @@
+package admin
+
+import (
+	"context"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+)
+
+func (s *service) regSecret(ctx context.Context, action string, args interface{}) *core.APIReply {
+	switch action {
+	case "get":
+		return s.ListSecret(args)
+	case "put":
+		return s.PutSecret(args)
+	case "delete":
+		return s.DeleteSecret(args)
+	}
+	return e.MethodNotFoundMethod()
+}
+
+func (s *service) PutSecret(args interface{}) *core.APIReply {
+	var secret core.Secret
+	err := unmarshalArgs(args, &secret)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	if secret.ResourceMeta == nil || !nameRegex.MatchString(secret.Name) || secret.Namespace == "" {
+		return e.InvalidParameterError()
+	}
+	ctx := context.TODO()
+	_, err = s.secretStore.Put(ctx, &secret, &core.PutOptions{})
+	if err != nil {
+		return e.InternalError(err)
+	}
+	return core.NewAPIReply(secret.Redact())
+}
+
+func (s *service) DeleteSecret(args interface{}) *core.APIReply {
+	var secret core.Secret
+	err := unmarshalArgs(args, &secret)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	ctx := context.TODO()
+	err = s.secretStore.Delete(ctx, &secret, &core.DeleteOptions{})
+	if err != nil {
+		return e.InternalError(err)
+	}
+	return core.NewAPIReply("")
+}
+
+//ListSecret 只返回键，值已脱敏
+func (s *service) ListSecret(args interface{}) *core.APIReply {
+	var secret core.Secret
+	err := unmarshalArgs(args, &secret)
+	if err != nil {
+		return e.InvalidParameterError(err)
+	}
+	ctx := context.TODO()
+	ress, err := s.secretStore.List(ctx, &secret, &core.ListOptions{})
+	if err != nil {
+		return e.InternalError(err)
+	}
+	secrets := make([]*core.Secret, 0, len(ress))
+	for _, res := range ress {
+		secrets = append(secrets, res.(*core.Secret).Redact())
+	}
+	return core.NewAPIReply(secrets)
+}
@@ -2,9 +2,12 @@ package admin
 
 import (
 	"context"
+	"errors"
 
 	"github.com/oars-sigs/oars-cloud/core"
 	"github.com/oars-sigs/oars-cloud/pkg/e"
+
+	"github.com/robfig/cron/v3"
 )
 
 func (s *service) regService(ctx context.Context, action string, args interface{}) *core.APIReply {
@@ -28,14 +31,113 @@ func (s *service) PutService(args interface{}) *core.APIReply {
 	if !nameRegex.MatchString(svc.Name) {
 		return e.InvalidParameterError()
 	}
+	if svc.Kind == core.CronJobServiceKind {
+		if svc.CronJob == nil {
+			return e.InvalidParameterError(errors.New("cronJob is required"))
+		}
+		_, err = cron.ParseStandard(svc.CronJob.Schedule)
+		if err != nil {
+			return e.InvalidParameterError(err)
+		}
+	}
+	switch svc.DriftPolicy {
+	case "", core.DriftPolicyReport, core.DriftPolicyRepair:
+	default:
+		return e.InvalidParameterError(errors.New("unsupported driftPolicy " + svc.DriftPolicy))
+	}
 	ctx := context.TODO()
-	_, err = s.svcStore.Put(ctx, &svc, &core.PutOptions{})
+	endpoints := svc.Endpoints
+	for i := 0; ; i++ {
+		old, rev := s.getServiceWithRev(ctx, &svc)
+		svc.Endpoints = keepEndpoints(old, svc.Replicas, endpoints)
+		opts, r := s.applyNamespaceLimits(ctx, &svc)
+		if r != nil {
+			return r
+		}
+		//读取后服务被controller 修改，或检查配额后同命名空间的服务有修改时重试
+		if opts.Guard == nil || rev < opts.GuardRev {
+			opts.GuardRev = rev
+		}
+		svc.Revision = svc.SpecRevision()
+		if old != nil && svc.IsRollingUpdate() && old.SpecRevision() != svc.Revision {
+			//滚动更新，由controller 逐个放开端点
+			for i := range svc.Endpoints {
+				svc.Endpoints[i].Hold = !svc.Endpoints[i].Surge
+			}
+		}
+		_, err = s.svcStore.Put(ctx, &svc, opts)
+		if err != e.ErrResourceModified || i >= conflictRetries {
+			break
+		}
+	}
 	if err != nil {
 		return e.InternalError(err)
 	}
 	return core.NewAPIReply(svc)
 }
 
+//keepEndpoints 保留调度器分配的端点，以及controller 维护的滚动更新和排空状态
+func keepEndpoints(old *core.Service, replicas int, eds []core.ServiceEndpoint) []core.ServiceEndpoint {
+	if old == nil {
+		return append([]core.ServiceEndpoint{}, eds...)
+	}
+	if replicas > 0 && len(eds) == 0 {
+		//保留调度器已分配的端点，避免重新调度
+		return append([]core.ServiceEndpoint{}, old.Endpoints...)
+	}
+	res := make([]core.ServiceEndpoint, 0, len(eds))
+	for _, ed := range eds {
+		for _, o := range old.Endpoints {
+			if o.Name == ed.Name && o.Hostname == ed.Hostname {
+				ed.Hold, ed.Surge, ed.Evicting = o.Hold, o.Surge, o.Evicting
+				break
+			}
+		}
+		res = append(res, ed)
+	}
+	if replicas > 0 {
+		//滚动更新的临时端点和等待替换的排空端点
+		for _, o := range old.Endpoints {
+			if (o.Surge || o.Evicting) && !containsEndpoint(res, o) {
+				res = append(res, o)
+			}
+		}
+	}
+	return res
+}
+
+func (s *service) getService(ctx context.Context, svc *core.Service) *core.Service {
+	old, _ := s.getServiceWithRev(ctx, svc)
+	return old
+}
+
+//getServiceWithRev 同时返回读取时的修订版本，服务不存在时仍返回版本
+func (s *service) getServiceWithRev(ctx context.Context, svc *core.Service) (*core.Service, int64) {
+	res, rev, err := s.svcStore.GetWithRev(ctx, svc, &core.GetOptions{})
+	if err != nil {
+		return nil, rev
+	}
+	old := res.(*core.Service)
+	if old.Name != svc.Name || old.Namespace != svc.Namespace {
+		return nil, rev
+	}
+	return old, rev
+}
+
+//updateService 读取最新的服务，update 返回true 时写入，期间被其他组件修改则重新读取；服务不存在时忽略
+func (s *service) updateService(ctx context.Context, svc *core.Service, update func(cur *core.Service) bool) error {
+	for i := 0; ; i++ {
+		cur, rev := s.getServiceWithRev(ctx, svc)
+		if cur == nil || !update(cur) {
+			return nil
+		}
+		_, err := s.svcStore.Put(ctx, cur, &core.PutOptions{GuardRev: rev})
+		if err != e.ErrResourceModified || i >= conflictRetries {
+			return err
+		}
+	}
+}
+
 func (s *service) DeleteService(args interface{}) *core.APIReply {
 	var svc core.Service
 	err := unmarshalArgs(args, &svc)
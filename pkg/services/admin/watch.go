@@ -0,0 +1,118 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+	"github.com/oars-sigs/oars-cloud/pkg/store/resources"
+)
+
+//watchArg 可监听的资源，namespaced 为true 时按命名空间过滤
+func watchArg(kind, namespace string) (res core.Resource, namespaced bool, ok bool) {
+	meta := &core.ResourceMeta{Namespace: namespace}
+	switch kind {
+	case "namespace":
+		return &core.Namespace{ResourceMeta: new(core.ResourceMeta)}, false, true
+	case "service":
+		return &core.Service{ResourceMeta: meta}, true, true
+	case "endpoint":
+		return &core.Endpoint{ResourceMeta: meta}, true, true
+	case "node":
+		return &core.Endpoint{ResourceMeta: &core.ResourceMeta{Namespace: core.SystemNamespace}, Service: "node"}, false, true
+	case "ingressListener":
+		return &core.IngressListener{ResourceMeta: new(core.ResourceMeta)}, false, true
+	case "ingressRoute":
+		return &core.IngressRoute{ResourceMeta: meta}, true, true
+	case "event":
+		return new(core.Event), true, true
+	case "cert":
+		return &core.Certificate{ResourceMeta: new(core.ResourceMeta)}, false, true
+	case "configmap":
+		return &core.ConfigMap{ResourceMeta: meta}, true, true
+	case "secret":
+		return &core.Secret{ResourceMeta: meta}, true, true
+	}
+	return nil, false, false
+}
+
+//WatchResource 以SSE 输出资源变化，参数namespace、rev，也可通过Last-Event-ID 从断开处继续
+func (s *service) WatchResource(cc context.Context, kind string) *core.APIReply {
+	ctx, ok := cc.(*gin.Context)
+	if !ok {
+		return core.NewAPIError(errors.New("context error"))
+	}
+	namespace := ctx.Query("namespace")
+	res, namespaced, ok := watchArg(kind, namespace)
+	if !ok {
+		return e.InvalidParameterError(fmt.Errorf("unsupported kind %s", kind))
+	}
+	revStr := ctx.Query("rev")
+	if id := ctx.GetHeader("Last-Event-ID"); id != "" {
+		revStr = id
+	}
+	var rev int64
+	if revStr != "" {
+		var err error
+		rev, err = strconv.ParseInt(revStr, 10, 64)
+		if err != nil || rev < 0 {
+			return e.InvalidParameterError(fmt.Errorf("invalid revision %s", revStr))
+		}
+	}
+	watcher := resources.NewWatcher(s.store, res)
+	if kind == "secret" {
+		watcher = s.secretWatcher
+	}
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Status(http.StatusOK)
+	ctx.Writer.WriteHeaderNow()
+	ctx.Writer.Flush()
+	//客户端断开时结束监听
+	reqCtx := ctx.Request.Context()
+	err := watcher.Watch(reqCtx, res, rev, func(event *core.WatchEvent) error {
+		if namespaced && !watchMatch(event.Object, namespace) {
+			return nil
+		}
+		if secret, ok := event.Object.(*core.Secret); ok {
+			event.Object = secret.Redact()
+		}
+		data, _ := json.Marshal(event)
+		//初始列表中的事件没有版本，断开后从上一个id 重新列出
+		id := ""
+		if event.Revision > 0 {
+			id = fmt.Sprintf("id: %d\n", event.Revision)
+		}
+		_, err := fmt.Fprintf(ctx.Writer, "%sdata: %s\n\n", id, data)
+		ctx.Writer.Flush()
+		return err
+	})
+	if err != nil && reqCtx.Err() == nil {
+		//版本已被压缩时客户端需从0 重新监听
+		fmt.Fprintf(ctx.Writer, "event: error\ndata: %s\n\n", strings.Replace(err.Error(), "\n", " ", -1))
+		ctx.Writer.Flush()
+	}
+	return core.NewAPIReply("")
+}
+
+//watchMatch 资源是否属于该命名空间，事件按关联资源的命名空间
+func watchMatch(res core.Resource, namespace string) bool {
+	if res == nil || namespace == "" {
+		return true
+	}
+	if event, ok := res.(*core.Event); ok {
+		return strings.Contains(event.Name, "/namespaces/"+namespace+"/")
+	}
+	if r, ok := res.(interface{ GetNamespace() string }); ok {
+		return r.GetNamespace() == namespace
+	}
+	return true
+}
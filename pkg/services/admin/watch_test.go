@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//blockWatcher 阻塞到ctx 结束
+type blockWatcher struct {
+	started chan struct{}
+}
+
+func (w *blockWatcher) Watch(ctx context.Context, arg core.Resource, rev int64, out func(*core.WatchEvent) error) error {
+	w.started <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWatchResourceCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newMemService()
+	w := &blockWatcher{started: make(chan struct{}, 1)}
+	s.secretWatcher = w
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	done := make(chan struct{})
+	go func() {
+		s.WatchResource(c, "secret")
+		close(done)
+	}()
+	select {
+	case <-w.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watch not started")
+	}
+
+	//客户端断开后结束监听
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("watch did not return after client disconnect")
+	}
+}
+
+//sseWriter 记录SSE 输出，看到BOOKMARK 后断开客户端
+type sseWriter struct {
+	mu     sync.Mutex
+	header http.Header
+	body   strings.Builder
+	cancel context.CancelFunc
+}
+
+func (w *sseWriter) Header() http.Header { return w.header }
+func (w *sseWriter) WriteHeader(int)     {}
+func (w *sseWriter) Flush()              {}
+
+func (w *sseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if strings.Contains(string(b), core.WatchBookmark) {
+		w.cancel()
+	}
+	return w.body.Write(b)
+}
+
+//watchSSE 监听到BOOKMARK 为止，返回输出的消息
+func watchSSE(s *service, kind, lastID string) []string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &sseWriter{header: make(http.Header), cancel: cancel}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	if lastID != "" {
+		c.Request.Header.Set("Last-Event-ID", lastID)
+	}
+	s.WatchResource(c, kind)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Split(strings.TrimSpace(w.body.String()), "\n\n")
+}
+
+func TestWatchResourceResumePartialList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := newMemService()
+	ctx := context.Background()
+	for _, name := range []string{"api", "web"} {
+		s.svcStore.Put(ctx, &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: name}}, &core.PutOptions{})
+	}
+	msgs := watchSSE(s, "service", "")
+	if len(msgs) != 3 {
+		t.Fatalf("expected 2 services and a bookmark, got %q", msgs)
+	}
+	//初始列表没有id，只有BOOKMARK 可以作为恢复点
+	for _, m := range msgs[:2] {
+		if strings.HasPrefix(m, "id:") {
+			t.Errorf("expected no id on listed event, got %q", m)
+		}
+	}
+	if !strings.HasPrefix(msgs[2], "id:") {
+		t.Errorf("expected id on bookmark, got %q", msgs[2])
+	}
+
+	//收到第一个对象后断开，客户端没有Last-Event-ID，重连后重新列出全部对象
+	lastID := ""
+	for _, line := range strings.Split(msgs[0], "\n") {
+		if strings.HasPrefix(line, "id: ") {
+			lastID = strings.TrimPrefix(line, "id: ")
+		}
+	}
+	msgs = watchSSE(s, "service", lastID)
+	got := 0
+	for _, m := range msgs {
+		if strings.Contains(m, core.WatchAdded) {
+			got++
+		}
+	}
+	if got != 2 {
+		t.Errorf("expected both services after resuming a partial list, got %q", msgs)
+	}
+}
@@ -0,0 +1,170 @@
+package resources
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	log "github.com/sirupsen/logrus"
+)
+
+//ErrSecretKeyRequired 未配置加密口令
+var ErrSecretKeyRequired = errors.New("secret key is not configured")
+
+//cipherKV 使用AES-GCM 加密值的kv 存储，键保持明文
+type cipherKV struct {
+	core.KVStore
+	aead cipher.AEAD
+}
+
+//NewCipherStore 加密存储资源
+func NewCipherStore(kvstore core.KVStore, cur core.Resource, key string) core.ResourceStore {
+	return NewStore(newCipherKV(kvstore, key), cur)
+}
+
+//NewCipherLister 解密并缓存资源
+func NewCipherLister(kvstore core.KVStore, resource core.Resource, key string, handle *core.ResourceEventHandle) (core.ResourceLister, error) {
+	if key == "" {
+		return nil, ErrSecretKeyRequired
+	}
+	return NewLister(newCipherKV(kvstore, key), resource, handle)
+}
+
+func newCipherKV(kvstore core.KVStore, key string) *cipherKV {
+	c := &cipherKV{KVStore: kvstore}
+	if key == "" {
+		return c
+	}
+	//口令经sha256 得到AES-256 密钥
+	sum := sha256.Sum256([]byte(key))
+	block, _ := aes.NewCipher(sum[:])
+	c.aead, _ = cipher.NewGCM(block)
+	return c
+}
+
+func (c *cipherKV) encrypt(s string) (string, error) {
+	if c.aead == nil {
+		return "", ErrSecretKeyRequired
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(c.aead.Seal(nonce, nonce, []byte(s), nil)), nil
+}
+
+func (c *cipherKV) decrypt(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	if c.aead == nil {
+		return "", ErrSecretKeyRequired
+	}
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	n := c.aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("ciphertext too short")
+	}
+	plain, err := c.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+//decryptKVs 解密失败的值(如口令变更)被忽略
+func (c *cipherKV) decryptKVs(kvs []core.KV) ([]core.KV, error) {
+	if len(kvs) > 0 && c.aead == nil {
+		return nil, ErrSecretKeyRequired
+	}
+	res := make([]core.KV, 0, len(kvs))
+	for _, kv := range kvs {
+		v, err := c.decrypt(kv.Value)
+		if err != nil {
+			log.Errorf("decrypt %s: %v", kv.Key, err)
+			continue
+		}
+		res = append(res, core.KV{Key: kv.Key, Value: v})
+	}
+	return res, nil
+}
+
+func (c *cipherKV) Put(ctx context.Context, kv core.KV) error {
+	v, err := c.encrypt(kv.Value)
+	if err != nil {
+		return err
+	}
+	return c.KVStore.Put(ctx, core.KV{Key: kv.Key, Value: v})
+}
+
+func (c *cipherKV) PutIfNotModified(ctx context.Context, kv core.KV, key string, op core.KVOption) (bool, error) {
+	v, err := c.encrypt(kv.Value)
+	if err != nil {
+		return false, err
+	}
+	return c.KVStore.PutIfNotModified(ctx, core.KV{Key: kv.Key, Value: v}, key, op)
+}
+
+func (c *cipherKV) Get(ctx context.Context, key string, op core.KVOption) ([]core.KV, error) {
+	kvs, err := c.KVStore.Get(ctx, key, op)
+	if err != nil {
+		return nil, err
+	}
+	return c.decryptKVs(kvs)
+}
+
+func (c *cipherKV) GetWithRev(ctx context.Context, key string, op core.KVOption) ([]core.KV, int64, error) {
+	kvs, rev, err := c.KVStore.GetWithRev(ctx, key, op)
+	if err != nil {
+		return nil, rev, err
+	}
+	kvs, err = c.decryptKVs(kvs)
+	return kvs, rev, err
+}
+
+func (c *cipherKV) Watch(ctx context.Context, key string, updateCh chan core.WatchChan, errCh chan error, op core.KVOption) {
+	ch := make(chan core.WatchChan)
+	go c.KVStore.Watch(ctx, key, ch, errCh, op)
+	for {
+		select {
+		case res := <-ch:
+			v, err := c.decrypt(res.KV.Value)
+			if err != nil {
+				log.Errorf("decrypt %s: %v", res.KV.Key, err)
+				continue
+			}
+			res.KV.Value = v
+			v, err = c.decrypt(res.PrevKV.Value)
+			if err != nil {
+				log.Errorf("decrypt %s: %v", res.PrevKV.Key, err)
+				continue
+			}
+			res.PrevKV.Value = v
+			select {
+			case updateCh <- res:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *cipherKV) Register(ctx context.Context, kv core.KV, lease int64) (core.KVRegister, error) {
+	v, err := c.encrypt(kv.Value)
+	if err != nil {
+		return nil, err
+	}
+	return c.KVStore.Register(ctx, core.KV{Key: kv.Key, Value: v}, lease)
+}
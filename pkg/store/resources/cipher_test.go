@@ -0,0 +1,85 @@
+package resources
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//memKV 内存kv，只实现Put/Get 和带修订版本的读写
+type memKV struct {
+	core.KVStore
+	data map[string]string
+	mod  map[string]int64
+	rev  int64
+}
+
+func (m *memKV) Put(ctx context.Context, kv core.KV) error {
+	m.rev++
+	m.data[kv.Key] = kv.Value
+	if m.mod == nil {
+		m.mod = make(map[string]int64)
+	}
+	m.mod[kv.Key] = m.rev
+	return nil
+}
+
+func (m *memKV) Get(ctx context.Context, key string, op core.KVOption) ([]core.KV, error) {
+	kvs := make([]core.KV, 0)
+	for k, v := range m.data {
+		if strings.HasPrefix(k, key) {
+			kvs = append(kvs, core.KV{Key: k, Value: v})
+		}
+	}
+	return kvs, nil
+}
+
+func (m *memKV) GetWithRev(ctx context.Context, key string, op core.KVOption) ([]core.KV, int64, error) {
+	kvs, err := m.Get(ctx, key, op)
+	return kvs, m.rev, err
+}
+
+func (m *memKV) PutIfNotModified(ctx context.Context, kv core.KV, key string, op core.KVOption) (bool, error) {
+	for k, rev := range m.mod {
+		if (k == key || op.WithPrefix && strings.HasPrefix(k, key)) && rev > op.WithRev {
+			return false, nil
+		}
+	}
+	return true, m.Put(ctx, kv)
+}
+
+func TestCipherStore(t *testing.T) {
+	kv := &memKV{data: make(map[string]string)}
+	ctx := context.Background()
+	secret := &core.Secret{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "db"},
+		Data:         map[string]string{"password": "s3cr3t"},
+	}
+	_, err := NewCipherStore(kv, new(core.Secret), "key1").Put(ctx, secret, &core.PutOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range kv.data {
+		if strings.Contains(v, "s3cr3t") {
+			t.Fatalf("secret stored in plain text: %s", v)
+		}
+	}
+
+	res, err := NewCipherStore(kv, new(core.Secret), "key1").Get(ctx, secret, &core.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.(*core.Secret).Data["password"] != "s3cr3t" {
+		t.Fatalf("unexpected secret %v", res)
+	}
+
+	//口令错误时无法读取
+	if _, err = NewCipherStore(kv, new(core.Secret), "key2").Get(ctx, secret, &core.GetOptions{}); err == nil {
+		t.Fatal("expect error with wrong key")
+	}
+	if _, err = NewCipherStore(kv, new(core.Secret), "").Put(ctx, secret, &core.PutOptions{}); err != ErrSecretKeyRequired {
+		t.Fatalf("expect ErrSecretKeyRequired, got %v", err)
+	}
+}
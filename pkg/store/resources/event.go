@@ -0,0 +1,39 @@
+package resources
+
+import (
+	"context"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+)
+
+//recordEventRetries 同一事件被并发记录时的重试次数
+const recordEventRetries = 5
+
+//RecordEvent 追加事件，与已有事件合并时累加次数并更新最后发生时间
+func RecordEvent(ctx context.Context, store core.ResourceStore, event *core.Event) error {
+	event.GenID()
+	for i := 0; ; i++ {
+		now := time.Now()
+		event.Count = 1
+		event.FirstTimestamp = now
+		res, rev, err := store.GetWithRev(ctx, event, &core.GetOptions{})
+		if err == nil {
+			old := res.(*core.Event)
+			if old.ResourceMeta != nil && old.Name == event.Name && old.ID == event.ID {
+				event.Count = old.Count + 1
+				if !old.FirstTimestamp.IsZero() {
+					event.FirstTimestamp = old.FirstTimestamp
+				}
+			}
+		}
+		event.LastTimestamp = now
+		event.Number = now.UnixNano()
+		//读取后被其他实例记录时重新合并，避免丢失次数
+		_, err = store.Put(ctx, event, &core.PutOptions{GuardRev: rev})
+		if err != e.ErrResourceModified || i >= recordEventRetries {
+			return err
+		}
+	}
+}
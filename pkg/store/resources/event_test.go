@@ -0,0 +1,97 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestRecordEvent(t *testing.T) {
+	kv := &memKV{data: make(map[string]string)}
+	store := NewStore(kv, new(core.Event))
+	ctx := context.Background()
+	newEvent := func(reason, msg string) *core.Event {
+		return &core.Event{
+			ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"},
+			Action:       "create",
+			Status:       core.FailEventStatus,
+			Reason:       reason,
+			Message:      msg,
+		}
+	}
+	for _, msg := range []string{"pull failed: timeout", "pull failed: 503"} {
+		err := RecordEvent(ctx, store, newEvent(core.BackOffEventReason, msg))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := RecordEvent(ctx, store, newEvent("", "started"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ress, err := store.List(ctx, &core.Event{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"}}, &core.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ress) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(ress))
+	}
+	for _, res := range ress {
+		event := res.(*core.Event)
+		if event.Reason != core.BackOffEventReason {
+			continue
+		}
+		if event.Count != 2 || event.Message != "pull failed: 503" {
+			t.Errorf("unexpected merged event: count %d, message %q", event.Count, event.Message)
+		}
+		if event.FirstTimestamp.After(event.LastTimestamp) {
+			t.Errorf("first timestamp after last timestamp")
+		}
+	}
+}
+
+//concurrentKV 第一次条件写入前插入其他实例的写入
+type concurrentKV struct {
+	*memKV
+	other func()
+}
+
+func (m *concurrentKV) PutIfNotModified(ctx context.Context, kv core.KV, key string, op core.KVOption) (bool, error) {
+	if f := m.other; f != nil {
+		m.other = nil
+		f()
+	}
+	return m.memKV.PutIfNotModified(ctx, kv, key, op)
+}
+
+func TestRecordEventConflict(t *testing.T) {
+	kv := &concurrentKV{memKV: &memKV{data: make(map[string]string)}}
+	ctx := context.Background()
+	newEvent := func() *core.Event {
+		return &core.Event{
+			ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"},
+			Action:       "restart",
+			Status:       core.FailEventStatus,
+			Reason:       core.BackOffEventReason,
+		}
+	}
+	kv.other = func() {
+		if err := RecordEvent(ctx, NewStore(kv.memKV, new(core.Event)), newEvent()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//etcd 的修订版本从1 开始
+	kv.Put(ctx, core.KV{Key: "init", Value: "{}"})
+	store := NewStore(kv, new(core.Event))
+	if err := RecordEvent(ctx, store, newEvent()); err != nil {
+		t.Fatal(err)
+	}
+	ress, err := store.List(ctx, &core.Event{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web-0"}}, &core.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ress) != 1 || ress[0].(*core.Event).Count != 2 {
+		t.Fatalf("expected concurrent records merged into count 2, got %+v", ress)
+	}
+}
@@ -2,6 +2,10 @@ package resources
 
 import (
 	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -9,6 +13,9 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+//cacheSaveInterval 监听到变化后写入缓存文件的间隔
+const cacheSaveInterval = 5 * time.Second
+
 type client struct {
 	store    core.KVStore
 	data     map[string]core.Resource
@@ -16,22 +23,31 @@ type client struct {
 	mu       *sync.Mutex
 	ready    bool
 	handle   *core.ResourceEventHandle
+	file     string            //缓存文件，为空时不缓存
+	raw      map[string]string //按存储key 记录的原始值，写入缓存文件
+	dirty    bool              //raw 有未保存的变化
+	rev      int64             //已同步到的修订版本
 }
 
 //NewLister resource lister
 func NewLister(store core.KVStore, resource core.Resource, handle *core.ResourceEventHandle) (core.ResourceLister, error) {
-	c := &client{
-		store:    store,
-		resource: resource,
-		handle:   handle,
-		mu:       new(sync.Mutex),
-	}
+	return NewCachedLister(store, resource, handle, "")
+}
+
+//NewCachedLister 资源同时保存到file，启动时存储不可用则从file 恢复，存储恢复后重新同步
+func NewCachedLister(store core.KVStore, resource core.Resource, handle *core.ResourceEventHandle, file string) (core.ResourceLister, error) {
+	c := newClient(store, resource, handle, file)
 	stopCh := make(chan struct{})
 	go func() {
+		restored := false
 		for {
 			rev, err := c.fetch()
 			if err != nil {
 				log.Error(err)
+				if !restored && !c.ready && c.file != "" {
+					restored = true
+					c.restore()
+				}
 				time.Sleep(time.Second * 5)
 				continue
 			}
@@ -46,17 +62,34 @@ func NewLister(store core.KVStore, resource core.Resource, handle *core.Resource
 	return c, nil
 }
 
+func newClient(store core.KVStore, resource core.Resource, handle *core.ResourceEventHandle, file string) *client {
+	return &client{
+		store:    store,
+		resource: resource,
+		handle:   handle,
+		mu:       new(sync.Mutex),
+		file:     file,
+		raw:      make(map[string]string),
+	}
+}
+
 func (c *client) List() ([]core.Resource, bool) {
+	res, _, ok := c.ListWithRev()
+	return res, ok
+}
+
+func (c *client) ListWithRev() ([]core.Resource, int64, bool) {
 	res := make([]core.Resource, 0)
 	if !c.ready {
-		return res, false
+		return res, 0, false
 	}
 	c.mu.Lock()
 	for _, v := range c.data {
 		res = append(res, v)
 	}
+	rev := c.rev
 	c.mu.Unlock()
-	return res, true
+	return res, rev, true
 }
 
 func (c *client) fetch() (int64, error) {
@@ -64,9 +97,14 @@ func (c *client) fetch() (int64, error) {
 	if err != nil {
 		return rev, err
 	}
+	c.mu.Lock()
+	prev := c.raw
+	c.mu.Unlock()
 	ress := make(map[string]core.Resource, 0)
+	raw := make(map[string]string)
 	for _, kv := range kvs {
-		resource, ok, err := c.parseResource(true, kv, core.KV{})
+		//重新同步时以上次的值作为变更前的值
+		resource, ok, err := c.parseResource(true, kv, core.KV{Key: kv.Key, Value: prev[kv.Key]})
 		if err != nil {
 			return 0, err
 		}
@@ -74,6 +112,7 @@ func (c *client) fetch() (int64, error) {
 			continue
 		}
 		ress[resource.ResourceKey()] = resource
+		raw[kv.Key] = kv.Value
 	}
 	if c.handle.Interceptor != nil {
 		for okey, oldRes := range c.data {
@@ -87,11 +126,76 @@ func (c *client) fetch() (int64, error) {
 	}
 	c.mu.Lock()
 	c.data = ress
+	c.raw = raw
+	c.dirty = true
+	c.rev = rev
 	c.mu.Unlock()
+	c.save()
 	c.scheduler()
 	return rev, nil
 }
 
+//restore 从缓存文件恢复上次同步的资源
+func (c *client) restore() {
+	data, err := ioutil.ReadFile(c.file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Error(err)
+		}
+		return
+	}
+	raws := make(map[string]string)
+	err = json.Unmarshal(data, &raws)
+	if err != nil {
+		log.Errorf("parse cache %s: %v", c.file, err)
+		return
+	}
+	ress := make(map[string]core.Resource)
+	raw := make(map[string]string)
+	for k, v := range raws {
+		resource, ok, err := c.parseResource(true, core.KV{Key: k, Value: v}, core.KV{})
+		if err != nil || !ok {
+			continue
+		}
+		ress[resource.ResourceKey()] = resource
+		raw[k] = v
+	}
+	c.mu.Lock()
+	c.data = ress
+	c.raw = raw
+	c.mu.Unlock()
+	c.ready = true
+	log.Warnf("store unavailable, restored %d %s from %s", len(ress), c.resource.ResourceKind(), c.file)
+	c.scheduler()
+}
+
+//save 有变化时写入缓存文件，先写临时文件再替换，避免中断后文件不完整
+func (c *client) save() {
+	c.mu.Lock()
+	if c.file == "" || !c.dirty {
+		c.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(c.raw)
+	c.dirty = false
+	c.mu.Unlock()
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.file), 0700)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(c.file+".tmp", data, 0600)
+	}
+	if err == nil {
+		err = os.Rename(c.file+".tmp", c.file)
+	}
+	if err != nil {
+		log.Errorf("save cache %s: %v", c.file, err)
+		c.mu.Lock()
+		c.dirty = true
+		c.mu.Unlock()
+	}
+}
+
 func (c *client) parseResource(put bool, kv, prekv core.KV) (core.Resource, bool, error) {
 	var resource core.Resource
 	if kv.Value != "" {
@@ -149,6 +253,8 @@ func (c *client) watch(rev int64, stopCh chan struct{}) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	opt := core.KVOption{WithPrevKV: true, WithPrefix: true, DisableFirst: true, WithRev: rev}
 	go c.store.Watch(ctx, getPrefixKey(c.resource), updateCh, errCh, opt)
+	t := time.NewTicker(cacheSaveInterval)
+	defer t.Stop()
 	for {
 		select {
 		case res := <-updateCh:
@@ -162,19 +268,28 @@ func (c *client) watch(rev int64, stopCh chan struct{}) error {
 			c.mu.Lock()
 			if res.Put {
 				c.data[resource.ResourceKey()] = resource
-
+				c.raw[res.KV.Key] = res.KV.Value
 			} else {
 				delete(c.data, resource.ResourceKey())
+				delete(c.raw, res.KV.Key)
+			}
+			if res.Rev > c.rev {
+				c.rev = res.Rev
 			}
+			c.dirty = true
 			c.mu.Unlock()
 			c.scheduler()
+		case <-t.C:
+			c.save()
 
 		case err := <-errCh:
 			cancel()
+			c.save()
 			log.Error(err)
 			return err
 		case <-stopCh:
 			cancel()
+			c.save()
 			return nil
 		}
 	}
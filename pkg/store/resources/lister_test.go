@@ -0,0 +1,61 @@
+package resources
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestCachedLister(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lister")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "cache", "services.json")
+	kv := &watchKV{memKV: &memKV{data: make(map[string]string)}, rev: 1}
+	web := &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web"}}
+	api := &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "api"}}
+	kv.data[getKey(web)] = web.String()
+	kv.data[getKey(api)] = api.String()
+	c := newClient(kv, new(core.Service), &core.ResourceEventHandle{}, file)
+	if _, err := c.fetch(); err != nil {
+		t.Fatal(err)
+	}
+
+	//存储不可用时从缓存恢复
+	deleted := make([]string, 0)
+	handle := &core.ResourceEventHandle{
+		Interceptor: func(put bool, r, prer core.Resource) (core.Resource, bool, error) {
+			if !put {
+				deleted = append(deleted, prer.(*core.Service).Name)
+			}
+			return nil, true, nil
+		},
+	}
+	c = newClient(kv, new(core.Service), handle, file)
+	if ress, ok := c.List(); ok || len(ress) != 0 {
+		t.Fatalf("lister should not be ready before restore, got %v", ress)
+	}
+	c.restore()
+	if ress, ok := c.List(); !ok || len(ress) != 2 {
+		t.Fatalf("expect 2 services restored, got %v %v", ress, ok)
+	}
+
+	//存储恢复后重新同步，期间删除的资源通知拦截器
+	delete(kv.data, getKey(api))
+	if _, err := c.fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != "api" {
+		t.Fatalf("expect api deleted, got %v", deleted)
+	}
+	c = newClient(kv, new(core.Service), &core.ResourceEventHandle{}, file)
+	c.restore()
+	if ress, _ := c.List(); len(ress) != 1 || ress[0].(*core.Service).Name != "web" {
+		t.Fatalf("cache should be updated after resync, got %v", ress)
+	}
+}
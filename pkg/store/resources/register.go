@@ -30,6 +30,25 @@ func NewRegister(store core.KVStore, resource core.Resource, lease int64) (core.
 	}, nil
 }
 
+//TryLock 获取资源锁，Close 或租约过期后释放，已被持有时返回nil
+func TryLock(store core.KVStore, resource core.Resource, lease int64) (core.ResourceRegister, error) {
+	key := getKey(resource)
+	if !strings.HasPrefix(key, lockPrefixKey) {
+		key = lockPrefixKey + key
+	}
+	lock, err := store.TryLock(context.Background(), core.KV{Key: key}, lease)
+	if err != nil || lock == nil {
+		return nil, err
+	}
+	return &register{
+		kvreg: lock,
+	}, nil
+}
+
 func (r *register) Close() error {
 	return r.kvreg.Close()
 }
+
+func (r *register) Done() <-chan struct{} {
+	return r.kvreg.Done()
+}
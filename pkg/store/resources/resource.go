@@ -39,6 +39,22 @@ func (s *store) List(ctx context.Context, arg core.Resource, opts *core.ListOpti
 	return ress, nil
 }
 
+//ListWithRev 同时返回读取时的修订版本，用于写入时检查列表是否被修改
+func (s *store) ListWithRev(ctx context.Context, arg core.Resource, opts *core.ListOptions) ([]core.Resource, int64, error) {
+	ress := make([]core.Resource, 0)
+	key := getPrefixKey(arg)
+	kvs, rev, err := s.kvstore.GetWithRev(ctx, key, core.KVOption{WithPrefix: true})
+	if err != nil {
+		return ress, rev, err
+	}
+	for _, kv := range kvs {
+		res := s.cur.New()
+		res.Parse(kv.Value)
+		ress = append(ress, res)
+	}
+	return ress, rev, nil
+}
+
 func (s *store) Get(ctx context.Context, arg core.Resource, opts *core.GetOptions) (core.Resource, error) {
 	key := getKey(arg)
 	kvs, err := s.kvstore.Get(ctx, key, core.KVOption{WithPrefix: true})
@@ -53,6 +69,21 @@ func (s *store) Get(ctx context.Context, arg core.Resource, opts *core.GetOption
 	return res, nil
 }
 
+//GetWithRev 同时返回读取时的修订版本，用于写入时检查资源是否被修改
+func (s *store) GetWithRev(ctx context.Context, arg core.Resource, opts *core.GetOptions) (core.Resource, int64, error) {
+	key := getKey(arg)
+	kvs, rev, err := s.kvstore.GetWithRev(ctx, key, core.KVOption{WithPrefix: true})
+	if err != nil {
+		return nil, rev, err
+	}
+	if len(kvs) == 0 {
+		return nil, rev, e.ErrResourceNotFound
+	}
+	res := s.cur.New()
+	res.Parse(kvs[0].Value)
+	return res, rev, nil
+}
+
 func (s *store) Put(ctx context.Context, arg core.Resource, opts *core.PutOptions) (core.Resource, error) {
 	res, err := s.Get(ctx, arg, &core.GetOptions{})
 	if err != nil {
@@ -75,6 +106,22 @@ func (s *store) Put(ctx context.Context, arg core.Resource, opts *core.PutOption
 		Key:   getKey(arg),
 		Value: arg.String(),
 	}
+	if opts != nil && (opts.Guard != nil || opts.GuardRev > 0) {
+		guard := core.KVOption{WithRev: opts.GuardRev}
+		key := v.Key
+		if opts.Guard != nil {
+			key = getPrefixKey(opts.Guard)
+			guard.WithPrefix = true
+		}
+		ok, err := s.kvstore.PutIfNotModified(ctx, v, key, guard)
+		if err != nil {
+			return arg, err
+		}
+		if !ok {
+			return arg, e.ErrResourceModified
+		}
+		return arg, nil
+	}
 	err = s.kvstore.Put(ctx, v)
 	if err != nil {
 		return arg, err
@@ -0,0 +1,38 @@
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/e"
+)
+
+func TestGuardedPut(t *testing.T) {
+	kv := &memKV{data: make(map[string]string)}
+	store := NewStore(kv, new(core.Service))
+	ctx := context.Background()
+	newSvc := func(name string, replicas int) *core.Service {
+		return &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: name}, Replicas: replicas}
+	}
+	store.Put(ctx, newSvc("web", 1), &core.PutOptions{})
+	_, rev, err := store.ListWithRev(ctx, newSvc("", 0), &core.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//只检查写入的资源本身，同前缀的其他资源修改不影响
+	store.Put(ctx, newSvc("web-api", 1), &core.PutOptions{})
+	if _, err := store.Put(ctx, newSvc("web", 2), &core.PutOptions{GuardRev: rev}); err != nil {
+		t.Fatalf("expect put with unmodified resource, got %v", err)
+	}
+	if _, err := store.Put(ctx, newSvc("web", 3), &core.PutOptions{GuardRev: rev}); err != e.ErrResourceModified {
+		t.Fatalf("expect modified resource rejected, got %v", err)
+	}
+	ress, _ := store.List(ctx, newSvc("", 0), &core.ListOptions{})
+	for _, res := range ress {
+		if svc := res.(*core.Service); svc.Name == "web" && svc.Replicas != 2 {
+			t.Fatalf("expect rejected put not written, got %+v", svc)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package resources
+
+import (
+	"context"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	log "github.com/sirupsen/logrus"
+)
+
+//bookmarkInterval 没有变化时输出BOOKMARK 的间隔
+const bookmarkInterval = 30 * time.Second
+
+type watcher struct {
+	kvstore core.KVStore
+	cur     core.Resource
+}
+
+//NewWatcher resource watcher
+func NewWatcher(kvstore core.KVStore, cur core.Resource) core.ResourceWatcher {
+	return &watcher{kvstore, cur}
+}
+
+//NewCipherWatcher 解密并监听资源
+func NewCipherWatcher(kvstore core.KVStore, cur core.Resource, key string) core.ResourceWatcher {
+	return NewWatcher(newCipherKV(kvstore, key), cur)
+}
+
+//Watch 监听arg 前缀下的资源，rev 为0 时先输出已有资源和BOOKMARK；版本已被压缩等错误时返回，调用方需从0 重新监听
+func (w *watcher) Watch(ctx context.Context, arg core.Resource, rev int64, out func(*core.WatchEvent) error) error {
+	key := getPrefixKey(arg)
+	if rev <= 0 {
+		kvs, r, err := w.kvstore.GetWithRev(ctx, key, core.KVOption{WithPrefix: true})
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvs {
+			res := w.cur.New()
+			if err := res.Parse(kv.Value); err != nil {
+				log.Error(err)
+				continue
+			}
+			//列表未输出完时不能从r 恢复，版本只在之后的BOOKMARK 中给出
+			err = out(&core.WatchEvent{Type: core.WatchAdded, Object: res})
+			if err != nil {
+				return err
+			}
+		}
+		rev = r
+		err = out(&core.WatchEvent{Type: core.WatchBookmark, Revision: rev})
+		if err != nil {
+			return err
+		}
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	updateCh := make(chan core.WatchChan)
+	errCh := make(chan error)
+	opt := core.KVOption{WithPrevKV: true, WithPrefix: true, DisableFirst: true, WithRev: rev}
+	go w.kvstore.Watch(wctx, key, updateCh, errCh, opt)
+	t := time.NewTicker(bookmarkInterval)
+	defer t.Stop()
+	for {
+		select {
+		case c := <-updateCh:
+			event, ok := w.event(c)
+			if c.Rev > rev {
+				rev = c.Rev
+			}
+			if !ok {
+				continue
+			}
+			err := out(event)
+			if err != nil {
+				return err
+			}
+		case <-t.C:
+			err := out(&core.WatchEvent{Type: core.WatchBookmark, Revision: rev})
+			if err != nil {
+				return err
+			}
+		case err := <-errCh:
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (w *watcher) event(c core.WatchChan) (*core.WatchEvent, bool) {
+	event := &core.WatchEvent{Revision: c.Rev}
+	value := c.KV.Value
+	switch {
+	case !c.Put:
+		event.Type = core.WatchDeleted
+		value = c.PrevKV.Value
+	case c.PrevKV.Value == "":
+		event.Type = core.WatchAdded
+	default:
+		event.Type = core.WatchModified
+	}
+	res := w.cur.New()
+	if err := res.Parse(value); err != nil {
+		log.Error(err)
+		return nil, false
+	}
+	event.Object = res
+	return event, true
+}
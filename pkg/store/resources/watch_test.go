@@ -0,0 +1,90 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//watchKV 返回固定版本的数据，监听时依次输出events
+type watchKV struct {
+	*memKV
+	rev    int64
+	events []core.WatchChan
+	from   int64
+}
+
+func (m *watchKV) GetWithRev(ctx context.Context, key string, op core.KVOption) ([]core.KV, int64, error) {
+	kvs, err := m.Get(ctx, key, op)
+	return kvs, m.rev, err
+}
+
+func (m *watchKV) Watch(ctx context.Context, key string, updateCh chan core.WatchChan, errCh chan error, op core.KVOption) {
+	m.from = op.WithRev
+	for _, c := range m.events {
+		updateCh <- c
+	}
+	errCh <- errors.New("compacted")
+}
+
+func TestWatcher(t *testing.T) {
+	svc := func(name string, replicas int) string {
+		return (&core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: name}, Replicas: replicas}).String()
+	}
+	kv := &watchKV{memKV: &memKV{data: make(map[string]string)}, rev: 10}
+	web := &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web"}}
+	kv.data[getKey(web)] = svc("web", 1)
+	kv.events = []core.WatchChan{
+		{Put: true, KV: core.KV{Value: svc("api", 1)}, Rev: 11},
+		{Put: true, PrevKV: core.KV{Value: svc("api", 1)}, KV: core.KV{Value: svc("api", 2)}, Rev: 12},
+		{PrevKV: core.KV{Value: svc("web", 1)}, Rev: 13},
+	}
+	w := NewWatcher(kv, new(core.Service))
+	arg := &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default"}}
+	got := make([]string, 0)
+	var last int64
+	err := w.Watch(context.Background(), arg, 0, func(event *core.WatchEvent) error {
+		name := ""
+		if event.Object != nil {
+			name = event.Object.(*core.Service).Name
+		}
+		got = append(got, event.Type+" "+name)
+		if event.Type == core.WatchAdded && event.Revision == 0 && name != "web" {
+			t.Errorf("expected revision on live event %s", name)
+		}
+		if name == "web" && event.Type == core.WatchAdded && event.Revision != 0 {
+			t.Errorf("expected no revision on listed event, got %d", event.Revision)
+		}
+		last = event.Revision
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected watch error")
+	}
+	expected := []string{"ADDED web", "BOOKMARK ", "ADDED api", "MODIFIED api", "DELETED web"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected %v, got %v", expected, got)
+			break
+		}
+	}
+	if kv.from != 10 || last != 13 {
+		t.Errorf("expected watch from 10 and last revision 13, got %d and %d", kv.from, last)
+	}
+
+	//从版本恢复时不输出已有资源
+	got = got[:0]
+	kv.events = nil
+	w.Watch(context.Background(), arg, 12, func(event *core.WatchEvent) error {
+		got = append(got, event.Type)
+		return nil
+	})
+	if len(got) != 0 || kv.from != 12 {
+		t.Errorf("expected resume from 12 without events, got %v from %d", got, kv.from)
+	}
+}
@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+)
+
+//errArchiveTooLarge tar 包超过大小上限
+var errArchiveTooLarge = errors.New("archive exceeds the size limit")
+
+//limitReader 读取超过n 字节时返回errArchiveTooLarge，n 为0 不限制
+type limitReader struct {
+	r        io.Reader
+	n        int64
+	read     int64
+	exceeded bool
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.n > 0 && l.read > l.n {
+		l.exceeded = true
+		return 0, errArchiveTooLarge
+	}
+	return n, err
+}
+
+//archive GET 以tar 包输出容器中的path，PUT 将请求体的tar 包解压到容器的path 目录，limit 为大小上限
+func (d *daemon) archive(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, path := q.Get("id"), q.Get("path")
+	if id == "" || path == "" {
+		http.Error(w, "id and path are required", http.StatusBadRequest)
+		return
+	}
+	limit, _ := strconv.ParseInt(q.Get("limit"), 10, 64)
+	switch r.Method {
+	case http.MethodGet:
+		d.archiveFrom(w, r, id, path, limit)
+	case http.MethodPut:
+		d.archiveTo(w, r, id, path, limit)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (d *daemon) archiveFrom(w http.ResponseWriter, r *http.Request, id, path string, limit int64) {
+	rc, size, err := d.rt.CopyFrom(r.Context(), id, path)
+	if err != nil {
+		http.Error(w, err.Error(), d.archiveStatus(err))
+		return
+	}
+	defer rc.Close()
+	if limit > 0 && size > limit {
+		http.Error(w, fmt.Sprintf("%s is %d bytes, exceeds the limit %d", path, size, limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-tar")
+	if size >= 0 {
+		w.Header().Set("X-File-Size", strconv.FormatInt(size, 10))
+	}
+	_, err = io.Copy(w, &limitReader{r: rc, n: limit})
+	if err != nil {
+		//已开始输出，中断连接使调用方感知传输失败
+		logrus.Errorf("copy %s from %s: %v", path, id, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func (d *daemon) archiveTo(w http.ResponseWriter, r *http.Request, id, path string, limit int64) {
+	body := &limitReader{r: r.Body, n: limit}
+	err := d.rt.CopyTo(r.Context(), id, path, body)
+	if body.exceeded {
+		http.Error(w, errArchiveTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), d.archiveStatus(err))
+		return
+	}
+	fmt.Fprint(w, body.read)
+}
+
+func (d *daemon) archiveStatus(err error) int {
+	if d.rt.IsNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	srv := httptest.NewServer(http.HandlerFunc(d.archive))
+	defer srv.Close()
+	do := func(method, query string, body []byte) (int, string) {
+		req, _ := http.NewRequest(method, srv.URL+"/archive?id=c1&path=/tmp/a"+query, bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	content := bytes.Repeat([]byte("x"), 100)
+	if code, _ := do(http.MethodPut, "&limit=10", content); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized upload, got %d", code)
+	}
+	if code, body := do(http.MethodPut, "&limit=1000", content); code != http.StatusOK || body != "100" {
+		t.Fatalf("unexpected upload response %d %q", code, body)
+	}
+	if !bytes.Equal(rt.archive, content) {
+		t.Fatalf("archive not written to container")
+	}
+	if code, _ := do(http.MethodGet, "&limit=10", nil); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 for oversized download, got %d", code)
+	}
+	if code, body := do(http.MethodGet, "", nil); code != http.StatusOK || body != string(content) {
+		t.Fatalf("unexpected download response %d, %d bytes", code, len(body))
+	}
+}
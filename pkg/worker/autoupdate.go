@@ -0,0 +1,141 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//imageUpdatesFile 检测到更新的镜像digest，保存在工作目录，worker 重启后容器哈希保持不变
+const imageUpdatesFile = "image-updates.json"
+
+func (d *daemon) loadImageUpdates() {
+	data, err := ioutil.ReadFile(filepath.Join(d.node.WorkDir, imageUpdatesFile))
+	if err != nil {
+		return
+	}
+	updates := make(map[string]string)
+	err = json.Unmarshal(data, &updates)
+	if err != nil {
+		logrus.Errorf("load image updates: %v", err)
+		return
+	}
+	for image, digest := range updates {
+		d.imageUpdates.Store(image, digest)
+	}
+}
+
+func (d *daemon) saveImageUpdates() error {
+	updates := make(map[string]string)
+	d.imageUpdates.Range(func(k, v interface{}) bool {
+		updates[k.(string)] = v.(string)
+		return true
+	})
+	data, _ := json.Marshal(updates)
+	err := os.MkdirAll(d.node.WorkDir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.node.WorkDir, imageUpdatesFile), data, 0644)
+}
+
+//imageUpdateDigest 自动更新服务检测到的镜像digest，未检测到更新时为空
+func (d *daemon) imageUpdateDigest(svc *core.ContainerService) string {
+	if !svc.AutoUpdate {
+		return ""
+	}
+	v, ok := d.imageUpdates.Load(svc.Image)
+	if !ok {
+		return ""
+	}
+	return v.(string)
+}
+
+//watchImageUpdates 定期检查autoUpdate 服务的镜像
+func (d *daemon) watchImageUpdates() {
+	if d.node.ImageCheckInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(d.node.ImageCheckInterval)
+	defer t.Stop()
+	for range t.C {
+		d.syncImageUpdates()
+	}
+}
+
+//syncImageUpdates 查询镜像仓库中标签的digest，与运行中的容器不同时记录新digest 并滚动重建
+func (d *daemon) syncImageUpdates() {
+	images := make(map[string][]*core.ContainerService)
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		if svc.AutoUpdate && svc.ImagePullPolicy == core.ImagePullAlways {
+			images[svc.Image] = append(images[svc.Image], svc)
+		}
+		return true
+	})
+	updated := false
+	for image, svcs := range images {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		digest, err := d.rt.RemoteDigest(ctx, image, d.imagePullAuth(svcs[0]))
+		cancel()
+		if err != nil {
+			logrus.Warnf("check image %s: %v", image, err)
+			continue
+		}
+		if v, ok := d.imageUpdates.Load(image); ok && v.(string) == digest {
+			continue
+		}
+		if !d.imageOutdated(svcs, digest) {
+			continue
+		}
+		d.imageUpdates.Store(image, digest)
+		updated = true
+		for _, svc := range svcs {
+			d.addEvent(d.cserviceToEndpoint(svc), core.ImageUpdateEventAction, core.SuccessEventStatus, image+" updated to "+digest)
+		}
+	}
+	if !updated {
+		return
+	}
+	err := d.saveImageUpdates()
+	if err != nil {
+		logrus.Error(err)
+	}
+	restarts := make([]recreate, 0)
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		if svc.AutoUpdate && d.configHash(svc) != svc.Labels[core.HashLabelKey] {
+			restarts = append(restarts, recreate{k, svc})
+		}
+		return true
+	})
+	d.rollingRecreate(restarts, core.ImageUpdateEventAction, "image updated, recreating")
+}
+
+//imageOutdated 是否有运行中的容器使用的不是该digest
+func (d *daemon) imageOutdated(svcs []*core.ContainerService, digest string) bool {
+	names := make(map[string]bool)
+	for _, svc := range svcs {
+		names[svc.Name] = true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, edp := range d.endpointCache {
+		if !names[d.containerNameByEdp(edp)] {
+			continue
+		}
+		//容器的digest 为name@sha256:... 形式
+		if !strings.HasSuffix(edp.Status.ImageDigest, "@"+digest) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+	"github.com/sirupsen/logrus"
+)
+
+//recreateLockLease 重建锁的租约，持有的worker 退出后其他节点可以继续
+const recreateLockLease = 30
+
+var (
+	//configRolloutTimeout 一个节点滚动重建等待端点就绪的总时间
+	configRolloutTimeout = 5 * time.Minute
+	//recreateLockRetry 等待其他节点重建完成的间隔
+	recreateLockRetry = 2 * time.Second
+)
+
+func (d *daemon) getConfigMap(namespace, name string) (*core.ConfigMap, error) {
+	if d.cfgLister == nil {
+		return nil, fmt.Errorf("configmap %s.%s not found", name, namespace)
+	}
+	ress, _ := d.cfgLister.List()
+	for _, res := range ress {
+		cfg := res.(*core.ConfigMap)
+		if cfg.Namespace == namespace && cfg.Name == name {
+			return cfg, nil
+		}
+	}
+	return nil, fmt.Errorf("configmap %s.%s not found", name, namespace)
+}
+
+//configHash 容器哈希，包含注入环境变量或变更时需重建的引用配置，以及自动更新检测到的镜像digest
+func (d *daemon) configHash(svc *core.ContainerService) string {
+	ns := d.getEndpointByContainerName(svc.Name).Namespace
+	data := make([]interface{}, 0)
+	for _, ref := range svc.ConfigMapRefs {
+		if ref.IsMount() && !ref.RestartOnChange {
+			continue
+		}
+		cfg, err := d.getConfigMap(ns, ref.Name)
+		switch {
+		case err != nil:
+			data = append(data, nil)
+		case ref.Key != "":
+			data = append(data, cfg.Data[ref.Key])
+		default:
+			data = append(data, cfg.Data)
+		}
+	}
+	if digest := d.imageUpdateDigest(svc); digest != "" {
+		data = append(data, digest)
+	}
+	if len(data) == 0 {
+		return svc.SpecHash
+	}
+	return md5Values(svc.SpecHash, data)
+}
+
+func (d *daemon) configMapRefDir(edp *core.Endpoint, name string) string {
+	return filepath.Join(d.node.WorkDir, "configmap", edp.Namespace, edp.Service, ".refs", name)
+}
+
+//configMapMounts 写入挂载的引用配置，返回挂载及文件是否有变化
+func (d *daemon) configMapMounts(edp *core.Endpoint, svc *core.ContainerService) ([]Mount, bool, error) {
+	mounts := make([]Mount, 0)
+	changed := false
+	for _, ref := range svc.ConfigMapRefs {
+		if !ref.IsMount() {
+			continue
+		}
+		cfg, err := d.getConfigMap(edp.Namespace, ref.Name)
+		if err != nil {
+			return nil, false, err
+		}
+		dir := d.configMapRefDir(edp, ref.Name)
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return nil, false, err
+		}
+		data := cfg.Data
+		if ref.Key != "" {
+			v, ok := cfg.Data[ref.Key]
+			if !ok {
+				return nil, false, fmt.Errorf("key %s not found in configmap %s.%s", ref.Key, ref.Name, edp.Namespace)
+			}
+			data = map[string]string{ref.Key: v}
+		}
+		for k, v := range data {
+			c, err := writeFileIfChanged(filepath.Join(dir, filepath.Base(k)), v)
+			if err != nil {
+				return nil, false, err
+			}
+			changed = changed || c
+		}
+		source := dir
+		if ref.Key != "" {
+			source = filepath.Join(dir, filepath.Base(ref.Key))
+		} else {
+			//删除已不存在的键
+			files, _ := ioutil.ReadDir(dir)
+			for _, f := range files {
+				if _, ok := data[f.Name()]; !ok {
+					os.Remove(filepath.Join(dir, f.Name()))
+					changed = true
+				}
+			}
+		}
+		mounts = append(mounts, Mount{Source: source, Target: ref.Path})
+	}
+	return mounts, changed, nil
+}
+
+//writeFileIfChanged 原地写入，保持inode 不变，单文件挂载的容器可以看到更新
+func writeFileIfChanged(path, data string) (bool, error) {
+	old, err := ioutil.ReadFile(path)
+	if err == nil && bytes.Equal(old, []byte(data)) {
+		return false, nil
+	}
+	return true, ioutil.WriteFile(path, []byte(data), 0644)
+}
+
+//configMapEnv 注入为环境变量的引用配置
+func (d *daemon) configMapEnv(edp *core.Endpoint, svc *core.ContainerService) ([]string, error) {
+	env := make([]string, 0)
+	for _, ref := range svc.ConfigMapRefs {
+		if ref.IsMount() {
+			continue
+		}
+		cfg, err := d.getConfigMap(edp.Namespace, ref.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ref.Key == "" {
+			for k, v := range cfg.Data {
+				env = append(env, k+"="+v)
+			}
+			continue
+		}
+		v, ok := cfg.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("key %s not found in configmap %s.%s", ref.Key, ref.Name, edp.Namespace)
+		}
+		name := ref.Env
+		if name == "" {
+			name = ref.Key
+		}
+		env = append(env, name+"="+v)
+	}
+	return env, nil
+}
+
+//watchConfigMaps ConfigMap 变更时同步引用的服务
+func (d *daemon) watchConfigMaps() {
+	for range d.cfgTrigger {
+		d.syncConfigMaps()
+	}
+}
+
+//syncConfigMaps 更新挂载的配置文件，哈希变化的端点滚动重建
+func (d *daemon) syncConfigMaps() {
+	restarts := make([]recreate, 0)
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		if len(svc.ConfigMapRefs) == 0 {
+			return true
+		}
+		edp := d.cserviceToEndpoint(svc)
+		_, changed, err := d.configMapMounts(edp, svc)
+		if err != nil {
+			logrus.Error(err)
+			d.addEvent(edp, core.ConfigEventAction, core.FailEventStatus, err.Error())
+			return true
+		}
+		if changed {
+			d.addEvent(edp, core.ConfigEventAction, core.SuccessEventStatus, "configmap files updated")
+		}
+		if d.configHash(svc) != svc.Labels[core.HashLabelKey] {
+			restarts = append(restarts, recreate{k, svc})
+		}
+		return true
+	})
+	d.rollingRecreate(restarts, core.ConfigEventAction, "configmap changed, recreating")
+}
+
+//recreate 待重建的缓存服务
+type recreate struct {
+	key interface{}
+	svc *core.ContainerService
+}
+
+//rollingRecreate 按最新哈希重建端点，不同服务并行，同一服务等待就绪后再重建下一个
+func (d *daemon) rollingRecreate(restarts []recreate, action, reason string) {
+	groups := make(map[string][]recreate)
+	for _, r := range restarts {
+		edp := d.cserviceToEndpoint(r.svc)
+		key := edp.Namespace + "/" + edp.Service
+		groups[key] = append(groups[key], r)
+	}
+	var wg sync.WaitGroup
+	for _, rs := range groups {
+		wg.Add(1)
+		go func(rs []recreate) {
+			defer wg.Done()
+			d.recreateService(rs, action, reason)
+		}(rs)
+	}
+	wg.Wait()
+}
+
+//recreateService 持有服务的重建锁，逐个重建本节点的端点，某个端点未就绪时停止该服务的重建
+func (d *daemon) recreateService(restarts []recreate, action, reason string) {
+	lock := d.lockRecreate(restarts[0])
+	if lock == nil {
+		return
+	}
+	defer lock.Close()
+	deadline := time.Now().Add(configRolloutTimeout)
+	for _, r := range restarts {
+		if v, ok := d.svcCache.Load(r.key); !ok || v != r.svc {
+			continue
+		}
+		select {
+		case <-lock.Done():
+			logrus.Warnf("recreate lock of %s lost", r.svc.Name)
+			return
+		default:
+		}
+		svc := new(core.ContainerService)
+		*svc = *r.svc
+		svc.Labels = make(map[string]string)
+		for k, v := range r.svc.Labels {
+			svc.Labels[k] = v
+		}
+		hash := d.configHash(svc)
+		svc.Labels[core.HashLabelKey] = hash
+		edp := d.cserviceToEndpoint(svc)
+		d.addEvent(edp, action, core.InProgressEventStatus, reason)
+		d.svcCache.Store(r.key, svc)
+		d.enqueue(svc.Name)
+		if svc.Hold {
+			//滚动更新中，由controller 放开
+			continue
+		}
+		if !d.waitEndpointReady(svc.Name, hash, deadline) {
+			d.addEvent(edp, action, core.FailEventStatus, "timeout waiting for endpoint ready")
+			return
+		}
+		d.addEvent(edp, action, core.SuccessEventStatus, "")
+	}
+}
+
+//recreateLock 服务的重建锁
+func (d *daemon) recreateLock(svc *core.ContainerService) core.Resource {
+	edp := d.cserviceToEndpoint(svc)
+	return &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Namespace:  edp.Namespace,
+			Name:       edp.Service,
+			ObjectKind: &core.ResourceObjectKind{IsLock: true},
+		},
+		Service: "recreate",
+	}
+}
+
+//lockRecreate 获取服务的重建锁，集群内同一时间只有一个节点重建该服务，服务已更新时返回nil
+func (d *daemon) lockRecreate(r recreate) core.ResourceRegister {
+	res := d.recreateLock(r.svc)
+	for {
+		if v, ok := d.svcCache.Load(r.key); !ok || v != r.svc {
+			return nil
+		}
+		lock, err := resStore.TryLock(d.store, res, recreateLockLease)
+		if err != nil {
+			logrus.Error(err)
+		}
+		if lock != nil {
+			return lock
+		}
+		time.Sleep(recreateLockRetry)
+	}
+}
+
+//waitEndpointReady 等待本节点容器以指定哈希运行并就绪
+func (d *daemon) waitEndpointReady(name, hash string, deadline time.Time) bool {
+	for time.Now().Before(deadline) {
+		d.mu.Lock()
+		ready := false
+		for _, edp := range d.endpointCache {
+			if d.containerNameByEdp(edp) == name {
+				ready = edp.Labels[core.HashLabelKey] == hash && edp.Status.IsReady()
+				break
+			}
+		}
+		d.mu.Unlock()
+		if ready {
+			return true
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return false
+}
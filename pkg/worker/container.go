@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//Create 准备卷、配置文件、环境变量后通过运行时创建容器
+func (d *daemon) Create(ctx context.Context, cached *core.ContainerService) (string, error) {
+	//复制一份，避免多次创建时重复追加环境变量
+	svc := new(core.ContainerService)
+	*svc = *cached
+	svc.Environment = append([]string{}, cached.Environment...)
+	svc.Labels = make(map[string]string)
+	for k, v := range cached.Labels {
+		svc.Labels[k] = v
+	}
+	edp := d.getEndpointByContainerName(svc.Name)
+	mounts, err := d.volumeMounts(edp, svc.Volumes)
+	if err != nil {
+		return "", err
+	}
+	spec := &ContainerSpec{
+		ContainerService: svc,
+		Mounts:           mounts,
+		DNS:              []string{d.node.IP},
+	}
+	for k, v := range svc.ConfigMap {
+		cfgPath := d.node.WorkDir + "/configmap/" + edp.Namespace + "/" + edp.Service + "/" + strings.TrimPrefix(k, "/")
+		err := os.MkdirAll(filepath.Dir(cfgPath), 0755)
+		if err != nil {
+			return "", err
+		}
+		data, err := d.resolveVault(v)
+		if err != nil {
+			return "", fmt.Errorf("configmap %s: %v", k, err)
+		}
+		if data != v {
+			//包含密钥的文件只允许属主读写
+			err = writeSecretFile(cfgPath, data)
+		} else {
+			err = ioutil.WriteFile(cfgPath, []byte(data), 0644)
+		}
+		if err != nil {
+			return "", err
+		}
+		spec.Mounts = append(spec.Mounts, Mount{
+			Target: k,
+			Source: cfgPath,
+		})
+	}
+	cfgMounts, _, err := d.configMapMounts(edp, svc)
+	if err != nil {
+		return "", err
+	}
+	spec.Mounts = append(spec.Mounts, cfgMounts...)
+	cfgEnv, err := d.configMapEnv(edp, svc)
+	if err != nil {
+		return "", err
+	}
+	svc.Environment = append(svc.Environment, cfgEnv...)
+	secretMounts, err := d.secretMounts(edp, svc)
+	if err != nil {
+		return "", err
+	}
+	spec.Mounts = append(spec.Mounts, secretMounts...)
+	secretEnv, err := d.secretEnv(edp, svc)
+	if err != nil {
+		return "", err
+	}
+	svc.Environment = append(svc.Environment, secretEnv...)
+	for i, env := range svc.Environment {
+		svc.Environment[i], err = d.resolveVault(env)
+		if err != nil {
+			return "", fmt.Errorf("environment %s: %v", strings.SplitN(env, "=", 2)[0], err)
+		}
+	}
+	if svc.Port == nil {
+		svc.Port = new(core.ContainerPort)
+	}
+	if svc.Port.ContainerPort == 0 {
+		port, err := getFreePort()
+		if err != nil {
+			return "", err
+		}
+		svc.Port.ContainerPort = port
+	}
+	if svc.Port.Protocol == "" {
+		svc.Port.Protocol = "tcp"
+	}
+	oarsEnv := []string{
+		fmt.Sprintf("OARS_SERVICE_PORT=%d", svc.Port.ContainerPort),
+		fmt.Sprintf("OARS_HOST_MAC=%s", d.node.MAC),
+		fmt.Sprintf("OARS_HOST_IP=%s", d.node.IP),
+		fmt.Sprintf("OARS_HOST_NAME=%s", d.node.Hostname),
+		fmt.Sprintf("OARS_HOST_INTERFACE=%s", d.node.Interface),
+	}
+	svc.Environment = append(svc.Environment, oarsEnv...)
+
+	if svc.Resources == nil {
+		svc.Resources = new(core.ContainerResource)
+	}
+	svc.Labels[core.ServicePortLabelKey] = fmt.Sprintf("%d", svc.Port.ContainerPort)
+	if svc.NetworkMode == "" {
+		svc.NetworkMode = "bridge"
+	}
+	if digest, err := d.rt.ImageDigest(ctx, svc.Image); err == nil && digest != "" {
+		svc.Labels[core.ImageDigestLabelKey] = digest
+	}
+	err = d.runInitContainers(ctx, svc, edp, oarsEnv)
+	if err != nil {
+		return "", err
+	}
+	if d.node.Loki.Enabled {
+		labels := fmt.Sprintf("container_name={{.Name}},namespace=%s,service=%s,endpoint=%s", edp.Namespace, edp.Service, edp.Name)
+		spec.LogDriver = d.node.Loki.Drive
+		spec.LogOptions = map[string]string{
+			"loki-url":             d.node.Loki.URL,
+			"max-size":             d.node.Loki.MaxSize,
+			"max-file":             d.node.Loki.MaxFile,
+			"loki-external-labels": labels,
+		}
+	}
+	return d.rt.Create(ctx, spec)
+}
+
+//volumeMounts 解析卷配置，相对路径的卷位于工作目录下，同一服务共享
+func (d *daemon) volumeMounts(edp *core.Endpoint, volumes []string) ([]Mount, error) {
+	mounts := make([]Mount, 0, len(volumes))
+	for _, v := range volumes {
+		ms := strings.Split(v, ":")
+		if len(ms) != 2 {
+			return nil, errors.New("volumes format error")
+		}
+		srcPath := ms[0]
+		if !filepath.IsAbs(srcPath) {
+			srcPath = fmt.Sprintf("%s/volume/%s/%s/%s", d.node.WorkDir, edp.Namespace, edp.Service, srcPath)
+		}
+		os.MkdirAll(srcPath, 0777)
+		mounts = append(mounts, Mount{
+			Target: ms[1],
+			Source: srcPath,
+		})
+	}
+	return mounts, nil
+}
@@ -0,0 +1,593 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/utils/netutils"
+	"github.com/oars-sigs/oars-cloud/pkg/worker/metrics"
+)
+
+//containerdRuntime containerd 运行时，通过执行nerdctl 命令管理容器，需要安装支持inspect --mode dockercompat 的nerdctl；
+//限制：事件只用于触发全量同步，不提供容器资源指标和拉取进度，exec 不分配tty
+type containerdRuntime struct {
+	cfg core.ContainerdConfig
+}
+
+func newContainerdRuntime(cfg core.ContainerdConfig) (*containerdRuntime, error) {
+	_, err := exec.LookPath(cfg.Nerdctl)
+	if err != nil {
+		return nil, err
+	}
+	return &containerdRuntime{cfg: cfg}, nil
+}
+
+func (r *containerdRuntime) command(ctx context.Context, args ...string) *exec.Cmd {
+	args = append([]string{"--address", r.cfg.Address, "--namespace", r.cfg.Namespace}, args...)
+	return exec.CommandContext(ctx, r.cfg.Nerdctl, args...)
+}
+
+//run 执行nerdctl 命令并返回标准输出
+func (r *containerdRuntime) run(ctx context.Context, stdin io.Reader, args ...string) (string, error) {
+	cmd := r.command(ctx, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return "", err
+		}
+		return "", fmt.Errorf("%s: %s", args[0], msg)
+	}
+	return stdout.String(), nil
+}
+
+func (r *containerdRuntime) Create(ctx context.Context, spec *ContainerSpec) (string, error) {
+	svc := spec.ContainerService
+	args := []string{"create", "--name", svc.Name}
+	for k, v := range svc.Labels {
+		args = append(args, "--label", k+"="+v)
+	}
+	for _, env := range svc.Environment {
+		args = append(args, "--env", env)
+	}
+	for _, m := range spec.Mounts {
+		args = append(args, "--volume", m.Source+":"+m.Target)
+	}
+	for _, p := range svc.Ports {
+		args = append(args, "--publish", p)
+	}
+	for _, dns := range spec.DNS {
+		args = append(args, "--dns", dns)
+	}
+	for _, c := range svc.CapAdd {
+		args = append(args, "--cap-add", c)
+	}
+	for _, c := range svc.CapDrop {
+		args = append(args, "--cap-drop", c)
+	}
+	for _, h := range svc.ExtraHosts {
+		args = append(args, "--add-host", h)
+	}
+	for _, opt := range svc.SecurityOpt {
+		args = append(args, "--security-opt", opt)
+	}
+	for k, v := range svc.Sysctls {
+		args = append(args, "--sysctl", k+"="+v)
+	}
+	if svc.NetworkMode != "" {
+		args = append(args, "--network", svc.NetworkMode)
+	}
+	if svc.Restart != "" {
+		args = append(args, "--restart", svc.Restart)
+	}
+	if svc.Privileged {
+		args = append(args, "--privileged")
+	}
+	if svc.Pid != "" {
+		args = append(args, "--pid", svc.Pid)
+	}
+	if svc.WorkingDir != "" {
+		args = append(args, "--workdir", svc.WorkingDir)
+	}
+	if svc.StopSignal != "" {
+		args = append(args, "--stop-signal", svc.StopSignal)
+	}
+	if svc.Resources.CPU > 0 {
+		args = append(args, "--cpus", fmt.Sprintf("%g", svc.Resources.CPU))
+	}
+	if svc.Resources.Memory > 0 {
+		args = append(args, "--memory", fmt.Sprintf("%d", svc.Resources.MemoryBytes()))
+	}
+	if spec.LogDriver != "" {
+		args = append(args, "--log-driver", spec.LogDriver)
+		for k, v := range spec.LogOptions {
+			args = append(args, "--log-opt", k+"="+v)
+		}
+	}
+	cmd := svc.Command
+	if len(svc.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", svc.Entrypoint[0])
+		cmd = append(append([]string{}, svc.Entrypoint[1:]...), svc.Command...)
+	}
+	args = append(args, svc.Image)
+	args = append(args, cmd...)
+	out, err := r.run(ctx, nil, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
+
+func (r *containerdRuntime) Start(ctx context.Context, id string) error {
+	_, err := r.run(ctx, nil, "start", id)
+	return err
+}
+
+func (r *containerdRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	_, err := r.run(ctx, nil, "stop", "--time", strconv.Itoa(int(timeout.Seconds())), id)
+	return err
+}
+
+func (r *containerdRuntime) Remove(ctx context.Context, id string) error {
+	_, err := r.run(ctx, nil, "rm", "--force", id)
+	return err
+}
+
+func (r *containerdRuntime) Restart(ctx context.Context, id string) error {
+	_, err := r.run(ctx, nil, "restart", "--time", "30", id)
+	return err
+}
+
+func (r *containerdRuntime) List(ctx context.Context) ([]Container, error) {
+	out, err := r.run(ctx, nil, "ps", "--all", "--quiet", "--no-trunc")
+	if err != nil {
+		return nil, err
+	}
+	ids := strings.Fields(out)
+	if len(ids) == 0 {
+		return []Container{}, nil
+	}
+	cjs, err := r.inspect(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Container, 0, len(cjs))
+	for _, cj := range cjs {
+		if cj.ContainerJSONBase == nil {
+			continue
+		}
+		c := Container{
+			ID:       cj.ID,
+			Name:     strings.TrimPrefix(cj.Name, "/"),
+			Image:    cj.Image,
+			Networks: make(map[string]ContainerNetwork),
+		}
+		if cj.Config != nil {
+			c.Labels = cj.Config.Labels
+			c.Image = cj.Config.Image
+		}
+		if cj.State != nil {
+			c.State = cj.State.Status
+			c.Status = cj.State.Status
+			c.Detail = containerState(cj)
+		}
+		if cj.NetworkSettings != nil {
+			for name, netw := range cj.NetworkSettings.Networks {
+				c.Networks[name] = ContainerNetwork{IP: netw.IPAddress, Gateway: netw.Gateway}
+			}
+			if len(c.Networks) == 0 && cj.NetworkSettings.IPAddress != "" {
+				c.Networks["bridge"] = ContainerNetwork{IP: cj.NetworkSettings.IPAddress, Gateway: cj.NetworkSettings.Gateway}
+			}
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func (r *containerdRuntime) Inspect(ctx context.Context, id string) (*ContainerState, error) {
+	cjs, err := r.inspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cjs) == 0 {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	return containerState(cjs[0]), nil
+}
+
+func (r *containerdRuntime) InspectConfig(ctx context.Context, id string) (*ContainerConfig, error) {
+	cjs, err := r.inspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(cjs) == 0 {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	return containerConfig(cjs[0]), nil
+}
+
+//containerdTopics containerd 事件主题对应的docker 事件名称
+var containerdTopics = map[string]string{
+	"/containers/create": "create",
+	"/containers/delete": "destroy",
+	"/tasks/start":       "start",
+	"/tasks/exit":        "die",
+	"/tasks/oom":         "oom",
+	"/tasks/paused":      "pause",
+	"/tasks/resumed":     "unpause",
+}
+
+//Events nerdctl events 没有容器名称，ID 取自事件内容，事件仅用于触发同步
+func (r *containerdRuntime) Events(ctx context.Context, out func(ContainerEvent)) error {
+	cmd := r.command(ctx, "events", "--format", "{{json .}}")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		var ev struct {
+			Namespace string
+			Topic     string
+			Event     string //事件内容的json
+		}
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil || (ev.Namespace != "" && ev.Namespace != r.cfg.Namespace) {
+			continue
+		}
+		if action, ok := containerdTopics[ev.Topic]; ok {
+			out(ContainerEvent{ID: containerdEventID(ev.Topic, ev.Event), Action: action})
+		}
+	}
+	err = cmd.Wait()
+	if err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+//containerdEventID 事件内容中的容器ID，容器事件为id，任务事件为container_id
+func containerdEventID(topic, event string) string {
+	var payload struct {
+		ID          string `json:"id"`
+		ContainerID string `json:"container_id"`
+	}
+	if json.Unmarshal([]byte(event), &payload) != nil {
+		return ""
+	}
+	if strings.HasPrefix(topic, "/tasks/") {
+		return payload.ContainerID
+	}
+	return payload.ID
+}
+
+//Stats nerdctl stats 只有格式化后的文本，不提供容器资源指标
+func (r *containerdRuntime) Stats(ctx context.Context) ([]*metrics.ContainerMetrics, error) {
+	return nil, errors.New("container metrics are not supported by the containerd runtime")
+}
+
+//inspect 以docker 兼容格式查看容器
+func (r *containerdRuntime) inspect(ctx context.Context, ids ...string) ([]types.ContainerJSON, error) {
+	out, err := r.run(ctx, nil, append([]string{"inspect", "--mode", "dockercompat"}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	cjs := make([]types.ContainerJSON, 0)
+	err = json.Unmarshal([]byte(out), &cjs)
+	if err != nil {
+		return nil, err
+	}
+	return cjs, nil
+}
+
+func (r *containerdRuntime) ImageExist(ctx context.Context, image string) (bool, error) {
+	out, err := r.run(ctx, nil, "images", "--quiet", image)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != "", nil
+}
+
+func (r *containerdRuntime) ImageDigest(ctx context.Context, image string) (string, error) {
+	out, err := r.run(ctx, nil, "image", "inspect", "--mode", "dockercompat", image)
+	if err != nil {
+		return "", err
+	}
+	imgs := make([]types.ImageInspect, 0)
+	err = json.Unmarshal([]byte(out), &imgs)
+	if err != nil {
+		return "", err
+	}
+	if len(imgs) == 0 {
+		return "", fmt.Errorf("no such image: %s", image)
+	}
+	return repoDigest(image, imgs[0].RepoDigests), nil
+}
+
+//RemoteDigest nerdctl 不支持查询远程digest，直接请求镜像仓库
+func (r *containerdRuntime) RemoteDigest(ctx context.Context, image, auth string) (string, error) {
+	return registryDigest(ctx, image, auth)
+}
+
+func (r *containerdRuntime) ImageList(ctx context.Context) ([]Image, error) {
+	out, err := r.run(ctx, nil, "images", "--quiet", "--no-trunc")
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, id := range strings.Fields(out) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []Image{}, nil
+	}
+	out, err = r.run(ctx, nil, append([]string{"image", "inspect", "--mode", "dockercompat"}, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	imgs := make([]types.ImageInspect, 0)
+	err = json.Unmarshal([]byte(out), &imgs)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Image, 0, len(imgs))
+	for _, img := range imgs {
+		created, _ := time.Parse(time.RFC3339Nano, img.Created)
+		res = append(res, Image{
+			ID:       img.ID,
+			RepoTags: img.RepoTags,
+			Size:     img.Size,
+			Created:  created,
+		})
+	}
+	return res, nil
+}
+
+func (r *containerdRuntime) ImageRemove(ctx context.Context, id string) error {
+	_, err := r.run(ctx, nil, "rmi", id)
+	return err
+}
+
+func (r *containerdRuntime) ImageRoot(ctx context.Context) (string, error) {
+	return r.cfg.Root, nil
+}
+
+//ImagePull nerdctl 没有结构化的进度输出，只在完成时回调
+func (r *containerdRuntime) ImagePull(ctx context.Context, image, auth string, progress func(PullProgress)) error {
+	distributionRef, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return err
+	}
+	if auth != "" {
+		err = r.login(ctx, reference.Domain(distributionRef), auth)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = r.run(ctx, nil, "pull", "--quiet", distributionRef.String())
+	if err == nil && progress != nil {
+		progress(PullProgress{Status: "Download complete"})
+	}
+	return err
+}
+
+//login 使用registryAuth 生成的凭证登录镜像仓库
+func (r *containerdRuntime) login(ctx context.Context, registry, auth string) error {
+	username, password, err := decodeRegistryAuth(auth)
+	if err != nil {
+		return err
+	}
+	_, err = r.run(ctx, strings.NewReader(password), "login", "--username", username, "--password-stdin", registry)
+	return err
+}
+
+func (r *containerdRuntime) Log(ctx context.Context, id, tail, since string) (string, error) {
+	args := []string{"logs"}
+	if tail != "" {
+		args = append(args, "--tail", tail)
+	}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	args = append(args, id)
+	cmd := r.command(ctx, args...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("logs: %s", strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func (r *containerdRuntime) LogStream(ctx context.Context, id string, opt *core.EndpointLogOpt, out func(*core.EndpointLogLine) error) error {
+	args := []string{"logs", "--timestamps"}
+	if opt.Tail != "" {
+		args = append(args, "--tail", opt.Tail)
+	}
+	if opt.Since != "" {
+		args = append(args, "--since", opt.Since)
+	}
+	if opt.Until != "" {
+		args = append(args, "--until", opt.Until)
+	}
+	if opt.Follow {
+		args = append(args, "--follow")
+	}
+	args = append(args, id)
+	out = syncLogOut(out)
+	stdout := &logLineWriter{stream: "stdout", out: out}
+	stderr := &logLineWriter{stream: "stderr", out: out}
+	cmd := r.command(ctx, args...)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	err := cmd.Run()
+	if err != nil {
+		return err
+	}
+	err = stdout.Flush()
+	if err != nil {
+		return err
+	}
+	return stderr.Flush()
+}
+
+//Exec nerdctl 的tty 需要终端，此处不分配tty
+func (r *containerdRuntime) Exec(ctx context.Context, id string, opt *core.EndpointExecOpt) (ExecConn, error) {
+	args := []string{"exec", "--interactive"}
+	if opt.User != "" {
+		args = append(args, "--user", opt.User)
+	}
+	for _, env := range opt.Env {
+		args = append(args, "--env", env)
+	}
+	args = append(args, id)
+	c := r.command(ctx, append(args, opt.Cmd...)...)
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	c.Stdout = pw
+	c.Stderr = pw
+	err = c.Start()
+	if err != nil {
+		return nil, err
+	}
+	conn := &cmdConn{cmd: c, stdin: stdin, stdout: pr, done: make(chan struct{})}
+	go func() {
+		conn.err = c.Wait()
+		close(conn.done)
+		pw.CloseWithError(conn.err)
+	}()
+	return conn, nil
+}
+
+func (r *containerdRuntime) ExecRun(ctx context.Context, id string, cmd []string) (int, string, error) {
+	c := r.command(ctx, append([]string{"exec", id}, cmd...)...)
+	out, err := c.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), string(out), nil
+		}
+		return 0, "", err
+	}
+	return 0, string(out), nil
+}
+
+//CopyFrom 在容器中执行tar 打包，需要容器中有tar
+func (r *containerdRuntime) CopyFrom(ctx context.Context, id, p string) (io.ReadCloser, int64, error) {
+	p = path.Clean(p)
+	c := r.command(ctx, "exec", id, "tar", "cf", "-", "-C", path.Dir(p), path.Base(p))
+	var stderr bytes.Buffer
+	c.Stderr = &stderr
+	pr, pw := io.Pipe()
+	c.Stdout = pw
+	err := c.Start()
+	if err != nil {
+		return nil, 0, err
+	}
+	go func() {
+		err := c.Wait()
+		if err != nil && stderr.Len() > 0 {
+			err = fmt.Errorf("tar: %s", strings.TrimSpace(stderr.String()))
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, -1, nil
+}
+
+//CopyTo 在容器中执行tar 解包，需要容器中有tar
+func (r *containerdRuntime) CopyTo(ctx context.Context, id, p string, content io.Reader) error {
+	_, err := r.run(ctx, content, "exec", "--interactive", id, "tar", "xf", "-", "-C", path.Clean(p))
+	return err
+}
+
+func (r *containerdRuntime) CreateNetwork(ctx context.Context, name, driver, subnet string) error {
+	gateway, err := netutils.FirstSubnetIP(subnet)
+	if err != nil {
+		return err
+	}
+	_, err = r.run(ctx, nil, "network", "create", "--driver", driver, "--subnet", subnet, "--gateway", gateway, name)
+	return err
+}
+
+func (r *containerdRuntime) ListNetworks(ctx context.Context) ([]string, error) {
+	out, err := r.run(ctx, nil, "network", "ls", "--format", "{{.Name}}")
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+func (r *containerdRuntime) IsNotFound(err error) bool {
+	return strings.Contains(err.Error(), "no such container") || strings.Contains(err.Error(), "not found")
+}
+
+//cmdConn 将nerdctl exec 进程包装为ExecConn
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.Reader
+	done   chan struct{}
+	err    error
+}
+
+func (c *cmdConn) Read(p []byte) (int, error) {
+	return c.stdout.Read(p)
+}
+
+func (c *cmdConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *cmdConn) Close() error {
+	c.stdin.Close()
+	if c.cmd.Process != nil {
+		c.cmd.Process.Kill()
+	}
+	return nil
+}
+
+func (c *cmdConn) Resize(rows, cols uint) error {
+	return errors.New("tty is not supported by containerd runtime")
+}
+
+//Signal 发送给nerdctl exec 进程
+func (c *cmdConn) Signal(sig syscall.Signal) error {
+	return c.cmd.Process.Signal(sig)
+}
+
+func (c *cmdConn) ExitCode() (int, error) {
+	<-c.done
+	var exitErr *exec.ExitError
+	if errors.As(c.err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, c.err
+}
@@ -0,0 +1,19 @@
+package worker
+
+import "testing"
+
+func TestContainerdEventID(t *testing.T) {
+	cases := []struct {
+		topic, event, id string
+	}{
+		{"/tasks/exit", `{"container_id":"c1","id":"c1","pid":10,"exit_status":1}`, "c1"},
+		{"/tasks/oom", `{"container_id":"c2"}`, "c2"},
+		{"/containers/create", `{"id":"c3","image":"nginx"}`, "c3"},
+		{"/containers/delete", ``, ""},
+	}
+	for _, c := range cases {
+		if got := containerdEventID(c.topic, c.event); got != c.id {
+			t.Errorf("%s: expected %q, got %q", c.topic, c.id, got)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//apiStoppedFile 通过api 停止的容器，保存在工作目录，worker 重启后仍不按重启策略拉起
+const apiStoppedFile = "api-stopped.json"
+
+const (
+	crashLoopBackoffBase = 10 * time.Second
+	crashLoopBackoffMax  = 5 * time.Minute
+	//crashLoopResetAfter 运行超过该时间后退出不再视为崩溃循环
+	crashLoopResetAfter = 10 * time.Minute
+)
+
+//inspectCache 容器状态未变化时复用inspect 结果
+type inspectCache struct {
+	state  string
+	status string
+	detail *ContainerState
+}
+
+//restartState 容器的退避重启状态，worker 重启后从头计算
+type restartState struct {
+	crashes   int       //连续崩溃次数
+	restarts  int       //worker 重启的次数
+	waiting   bool      //已记录本次退出，等待退避结束
+	next      time.Time //退避结束时间
+	delay     time.Duration
+	lastStart time.Time
+	observed  bool //已记录运行时的重启次数
+	seen      int  //运行时按重启策略重启的次数
+}
+
+//containerDetail 获取容器状态详情，List 未提供时inspect
+func (d *daemon) containerDetail(ctx context.Context, cn Container) *ContainerState {
+	if cn.Detail != nil {
+		return cn.Detail
+	}
+	if v, ok := d.states.Load(cn.ID); ok {
+		c := v.(*inspectCache)
+		if c.state == cn.State && c.status == cn.Status {
+			return c.detail
+		}
+	}
+	detail, err := d.rt.Inspect(ctx, cn.ID)
+	if err != nil {
+		logrus.Warnf("inspect %s: %v", cn.Name, err)
+		return nil
+	}
+	d.states.Store(cn.ID, &inspectCache{state: cn.State, status: cn.Status, detail: detail})
+	return detail
+}
+
+//setContainerDetail 将退出码、OOM、重启次数和起止时间写入端点状态
+func (d *daemon) setContainerDetail(edp *core.Endpoint, detail *ContainerState) {
+	status := edp.Status
+	if detail != nil {
+		status.ExitCode = detail.ExitCode
+		status.OOMKilled = detail.OOMKilled
+		status.RestartCount = detail.RestartCount
+		if !detail.StartedAt.IsZero() {
+			status.StartedAt = detail.StartedAt.Unix()
+		}
+		if !detail.FinishedAt.IsZero() {
+			status.FinishedAt = detail.FinishedAt.Unix()
+		}
+	}
+	if v, ok := d.restarts.Load(status.ID); ok {
+		status.RestartCount += v.(*restartState).restarts
+	}
+}
+
+//syncRestarts 重启策略由运行时执行，worker 通过重启次数发现崩溃循环并在其上退避；
+//旧版本以no 创建、策略在标签中的容器仍由worker 重启
+func (d *daemon) syncRestarts(edps map[string]*core.Endpoint, now time.Time) {
+	for id, edp := range edps {
+		if _, ok := d.stopped.Load(id); ok {
+			continue
+		}
+		v, _ := d.restarts.LoadOrStore(id, new(restartState))
+		rs := v.(*restartState)
+		policy := edp.Labels[core.RestartPolicyLabelKey]
+		if policy == "" {
+			d.syncRuntimeRestart(id, edp, rs, now)
+			continue
+		}
+		if edp.Status.State != "exited" {
+			rs.waiting = false
+			continue
+		}
+		if !rs.waiting {
+			if !shouldRestart(policy, edp.Status.ExitCode, rs.crashes) {
+				continue
+			}
+			if ranLongEnough(edp.Status, rs.lastStart, now) {
+				rs.crashes = 0
+			}
+			rs.delay = crashLoopDelay(rs.crashes)
+			rs.crashes++
+			rs.waiting = true
+			rs.next = now.Add(rs.delay)
+			if rs.delay > 0 {
+				d.addReasonEvent(edp, core.RestartEventAction, core.FailEventStatus, core.BackOffEventReason,
+					fmt.Sprintf("back-off %s restarting failed container, %s", rs.delay, exitReason(edp.Status)))
+			}
+		}
+		if now.Before(rs.next) {
+			edp.Status.State = core.CrashLoopBackOffState
+			edp.Status.StateDetail = fmt.Sprintf("back-off %s restarting failed container, %s", rs.delay, exitReason(edp.Status))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := d.rt.Start(ctx, id)
+		cancel()
+		if err != nil {
+			logrus.Error(err)
+			d.addEvent(edp, core.RestartEventAction, core.FailEventStatus, err.Error())
+			continue
+		}
+		d.states.Delete(id)
+		rs.waiting = false
+		rs.restarts++
+		rs.lastStart = now
+		edp.Status.State = "running"
+		edp.Status.RestartCount++
+		d.addEvent(edp, core.RestartEventAction, core.SuccessEventStatus, "restarted after "+exitReason(edp.Status))
+	}
+}
+
+//syncRuntimeRestart 运行时重启次数增加视为一次崩溃，连续崩溃且运行时正在等待重启时
+//停止容器取消运行时的重启，退避结束后由worker 启动；worker 未运行时仍由运行时按策略重启
+func (d *daemon) syncRuntimeRestart(id string, edp *core.Endpoint, rs *restartState, now time.Time) {
+	count := edp.Status.RestartCount - rs.restarts
+	if rs.waiting {
+		if edp.Status.State != "exited" {
+			//已被手动启动
+			rs.waiting = false
+			rs.seen = count
+			return
+		}
+		if now.Before(rs.next) {
+			edp.Status.State = core.CrashLoopBackOffState
+			edp.Status.StateDetail = fmt.Sprintf("back-off %s restarting failed container, %s", rs.delay, exitReason(edp.Status))
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err := d.rt.Start(ctx, id)
+		cancel()
+		if err != nil {
+			logrus.Error(err)
+			d.addEvent(edp, core.RestartEventAction, core.FailEventStatus, err.Error())
+			return
+		}
+		d.states.Delete(id)
+		rs.waiting = false
+		rs.restarts++
+		rs.lastStart = now
+		rs.seen = count
+		edp.Status.State = "running"
+		edp.Status.RestartCount++
+		d.addEvent(edp, core.RestartEventAction, core.SuccessEventStatus, "restarted after "+exitReason(edp.Status))
+		return
+	}
+	if !rs.observed || count <= rs.seen {
+		//首次观察或运行时重置了重启次数
+		rs.observed = true
+		rs.seen = count
+		return
+	}
+	if !rs.lastStart.IsZero() && now.Sub(rs.lastStart) >= crashLoopResetAfter {
+		rs.crashes = 0
+	}
+	//两次同步之间可能重启了多次
+	rs.crashes += count - rs.seen - 1
+	rs.seen = count
+	rs.lastStart = now
+	rs.delay = crashLoopDelay(rs.crashes)
+	rs.crashes++
+	if rs.delay == 0 || edp.Status.State != "restarting" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := d.rt.Stop(ctx, id, defaultStopTimeout)
+	cancel()
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	d.states.Delete(id)
+	rs.waiting = true
+	rs.next = now.Add(rs.delay)
+	edp.Status.State = core.CrashLoopBackOffState
+	edp.Status.StateDetail = fmt.Sprintf("back-off %s restarting failed container, %s", rs.delay, exitReason(edp.Status))
+	d.addReasonEvent(edp, core.RestartEventAction, core.FailEventStatus, core.BackOffEventReason, edp.Status.StateDetail)
+}
+
+//pruneContainerStates 清理已删除容器的缓存
+func (d *daemon) pruneContainerStates(edps map[string]*core.Endpoint) {
+	for _, m := range []*sync.Map{&d.states, &d.restarts} {
+		m.Range(func(k, v interface{}) bool {
+			if _, ok := edps[k.(string)]; !ok {
+				m.Delete(k)
+			}
+			return true
+		})
+	}
+	pruned := false
+	d.stopped.Range(func(k, v interface{}) bool {
+		if _, ok := edps[k.(string)]; !ok {
+			d.stopped.Delete(k)
+			pruned = true
+		}
+		return true
+	})
+	if pruned {
+		err := d.saveStopped()
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+//setStopped 记录或清除容器的api 停止标记
+func (d *daemon) setStopped(id string, stopped bool) {
+	if stopped {
+		d.stopped.Store(id, true)
+	} else {
+		d.stopped.Delete(id)
+	}
+	err := d.saveStopped()
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+func (d *daemon) loadStopped() {
+	data, err := ioutil.ReadFile(filepath.Join(d.node.WorkDir, apiStoppedFile))
+	if err != nil {
+		return
+	}
+	ids := make([]string, 0)
+	err = json.Unmarshal(data, &ids)
+	if err != nil {
+		logrus.Errorf("load api stopped containers: %v", err)
+		return
+	}
+	for _, id := range ids {
+		d.stopped.Store(id, true)
+	}
+}
+
+func (d *daemon) saveStopped() error {
+	ids := make([]string, 0)
+	d.stopped.Range(func(k, v interface{}) bool {
+		ids = append(ids, k.(string))
+		return true
+	})
+	data, _ := json.Marshal(ids)
+	err := os.MkdirAll(d.node.WorkDir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.node.WorkDir, apiStoppedFile), data, 0644)
+}
+
+//shouldRestart 按docker 重启策略判断，on-failure:N 限制连续崩溃次数
+func shouldRestart(policy string, exitCode, crashes int) bool {
+	switch {
+	case policy == "always" || policy == "unless-stopped":
+		return true
+	case policy == "on-failure":
+		return exitCode != 0
+	case strings.HasPrefix(policy, "on-failure:"):
+		max, err := strconv.Atoi(strings.TrimPrefix(policy, "on-failure:"))
+		if err != nil {
+			return exitCode != 0
+		}
+		return exitCode != 0 && crashes < max
+	}
+	return false
+}
+
+//crashLoopDelay 第一次退出立即重启，之后从10s 起倍增，最长5m
+func crashLoopDelay(crashes int) time.Duration {
+	if crashes == 0 {
+		return 0
+	}
+	delay := crashLoopBackoffBase
+	for i := 1; i < crashes && delay < crashLoopBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > crashLoopBackoffMax {
+		delay = crashLoopBackoffMax
+	}
+	return delay
+}
+
+//ranLongEnough 退出前运行的时间是否超过crashLoopResetAfter，运行时未提供起止时间时按worker 最后重启时间计算
+func ranLongEnough(status *core.EndpointStatus, lastStart, now time.Time) bool {
+	if status.StartedAt > 0 && status.FinishedAt >= status.StartedAt {
+		return time.Duration(status.FinishedAt-status.StartedAt)*time.Second >= crashLoopResetAfter
+	}
+	return !lastStart.IsZero() && now.Sub(lastStart) >= crashLoopResetAfter
+}
+
+func exitReason(status *core.EndpointStatus) string {
+	reason := fmt.Sprintf("exit code %d", status.ExitCode)
+	if status.OOMKilled {
+		reason += ", OOMKilled"
+	}
+	return reason
+}
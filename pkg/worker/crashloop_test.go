@@ -0,0 +1,185 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestSyncRestarts(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	create := func(name, policy string) string {
+		id, err := rt.Create(context.Background(), &ContainerSpec{ContainerService: &core.ContainerService{
+			Name: name,
+			Labels: map[string]string{
+				core.CreatorLabelKey:       "oars",
+				core.RestartPolicyLabelKey: policy,
+			},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rt.Start(context.Background(), id)
+		return id
+	}
+	web := create("oars_default_web_web-0", "always")
+	task := create("oars_default_task_task-0", "on-failure")
+	edps := func() map[string]*core.Endpoint {
+		cs, _ := rt.List(context.Background())
+		res := make(map[string]*core.Endpoint)
+		for _, cn := range cs {
+			edp := d.cantainerToEndpoint(cn)
+			d.setContainerDetail(edp, d.containerDetail(context.Background(), cn))
+			res[cn.ID] = edp
+		}
+		return res
+	}
+	state := func(id string) string {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		return rt.containers[id].State
+	}
+	t0 := time.Now()
+
+	//第一次退出立即重启
+	rt.exit(web, 1)
+	rt.exit(task, 0)
+	d.syncRestarts(edps(), t0)
+	if state(web) != "running" || state(task) != "exited" {
+		t.Fatalf("expect web restarted and task kept exited, got %s %s", state(web), state(task))
+	}
+
+	//再次退出后退避10s
+	rt.exit(web, 137)
+	es := edps()
+	d.syncRestarts(es, t0.Add(time.Second))
+	if state(web) != "exited" || es[web].Status.State != core.CrashLoopBackOffState || es[web].Status.ExitCode != 137 {
+		t.Fatalf("expect CrashLoopBackOff, got %+v", es[web].Status)
+	}
+	d.syncRestarts(edps(), t0.Add(5*time.Second))
+	if state(web) != "exited" {
+		t.Fatal("restarted before back-off elapsed")
+	}
+	es = edps()
+	d.syncRestarts(es, t0.Add(12*time.Second))
+	if state(web) != "running" || es[web].Status.RestartCount != 2 {
+		t.Fatalf("expect restarted twice after back-off, got %s %+v", state(web), es[web].Status)
+	}
+
+	//退避时间倍增
+	rt.exit(web, 1)
+	d.syncRestarts(edps(), t0.Add(13*time.Second))
+	d.syncRestarts(edps(), t0.Add(30*time.Second))
+	if state(web) != "exited" {
+		t.Fatal("expect back-off doubled to 20s")
+	}
+	d.syncRestarts(edps(), t0.Add(34*time.Second))
+	if state(web) != "running" {
+		t.Fatal("expect restarted after 20s back-off")
+	}
+
+	//通过api 停止的容器不重启
+	dir, err := ioutil.TempDir("", "oars-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d.node.WorkDir = dir
+	d.setStopped(web, true)
+	rt.exit(web, 0)
+	d.syncRestarts(edps(), t0.Add(time.Hour))
+	if state(web) != "exited" {
+		t.Fatal("stopped container should not be restarted")
+	}
+
+	//worker 重启后仍不重启
+	d = newFakeDaemon(rt)
+	d.node.WorkDir = dir
+	d.loadStopped()
+	d.syncRestarts(edps(), time.Now())
+	if state(web) != "exited" {
+		t.Fatal("stopped container restarted after worker restart")
+	}
+
+	//容器删除后清除标记
+	d.pruneContainerStates(map[string]*core.Endpoint{})
+	d = newFakeDaemon(rt)
+	d.node.WorkDir = dir
+	d.loadStopped()
+	if _, ok := d.stopped.Load(web); ok {
+		t.Fatal("stopped mark of removed container not pruned")
+	}
+}
+
+func TestSyncRuntimeRestarts(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	id, _ := rt.Create(context.Background(), &ContainerSpec{ContainerService: &core.ContainerService{
+		Name:    "oars_default_web_web-0",
+		Restart: "always",
+		Labels:  map[string]string{core.CreatorLabelKey: "oars"},
+	}})
+	rt.Start(context.Background(), id)
+	syncAt := func(now time.Time) *core.Endpoint {
+		cs, _ := rt.List(context.Background())
+		edp := d.cantainerToEndpoint(cs[0])
+		d.setContainerDetail(edp, d.containerDetail(context.Background(), cs[0]))
+		d.syncRestarts(map[string]*core.Endpoint{id: edp}, now)
+		return edp
+	}
+	state := func() string {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		return rt.containers[id].State
+	}
+	t0 := time.Now()
+	syncAt(t0)
+
+	//第一次崩溃由运行时重启，worker 不再重复启动
+	rt.crash(id, 1)
+	syncAt(t0.Add(time.Second))
+	if state() != "restarting" {
+		t.Fatalf("expect restart left to runtime, got %s", state())
+	}
+	rt.Start(context.Background(), id)
+	syncAt(t0.Add(2 * time.Second))
+
+	//连续崩溃时取消运行时的重启并退避10s
+	rt.crash(id, 137)
+	edp := syncAt(t0.Add(3 * time.Second))
+	if state() != "exited" || edp.Status.State != core.CrashLoopBackOffState {
+		t.Fatalf("expect CrashLoopBackOff, got %s %+v", state(), edp.Status)
+	}
+	syncAt(t0.Add(8 * time.Second))
+	if state() != "exited" {
+		t.Fatal("started before back-off elapsed")
+	}
+	edp = syncAt(t0.Add(14 * time.Second))
+	if state() != "running" || edp.Status.RestartCount != 3 {
+		t.Fatalf("expect started once after back-off, got %s %+v", state(), edp.Status)
+	}
+
+	//运行时按策略放弃后不由worker 重启
+	rt.exit(id, 1)
+	syncAt(t0.Add(time.Hour))
+	if state() != "exited" {
+		t.Fatal("exited container restarted by worker")
+	}
+}
+
+func TestCrashLoopDelay(t *testing.T) {
+	expected := []time.Duration{0, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 5 * time.Minute, 5 * time.Minute}
+	for i, delay := range expected {
+		if got := crashLoopDelay(i); got != delay {
+			t.Errorf("crashes %d: expected %s, got %s", i, delay, got)
+		}
+	}
+	if shouldRestart("on-failure:2", 1, 2) || !shouldRestart("on-failure:2", 1, 1) || shouldRestart("no", 1, 0) {
+		t.Error("unexpected restart policy result")
+	}
+}
@@ -1,52 +1,85 @@
 package worker
 
 import (
+	"os"
+	"os/signal"
 	"sync"
-
-	"github.com/docker/docker/client"
+	"syscall"
+	"time"
 
 	"github.com/oars-sigs/oars-cloud/core"
 	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
 	"github.com/oars-sigs/oars-cloud/pkg/worker/metrics"
+
+	"github.com/sirupsen/logrus"
 )
 
 type daemon struct {
-	c             *client.Client
+	rt            Runtime
 	store         core.KVStore
 	svcLister     core.ResourceLister
 	edpLister     core.ResourceLister
 	nodeEdpLister core.ResourceLister
 	cfgLister     core.ResourceLister
+	cfgTrigger    chan struct{}
+	secretLister  core.ResourceLister
 	edpstore      core.ResourceStore
 	eventstore    core.ResourceStore
+	queue         *workQueue    //containers to sync
+	stateTrigger  chan struct{} //refresh container states
+	svcEvents     *broadcaster  //service lister changes
+	edpEvents     *broadcaster  //endpoint lister changes
+	stopCh        chan struct{} //closed on shutdown
+	nodeReg       core.ResourceRegister
 	mu            *sync.Mutex
 	endpointCache map[string]*core.Endpoint //current node endpoints
 	svcCache      sync.Map                  //current node services
 	node          *core.NodeConfig
+	secretKey     string
 	sysConfig     *core.SystemConfig
-	ready         bool
+	ready         bool //容器缓存已刷新，由mu 保护
+	edpUnsynced   bool //endpoint status failed to write to store
 	vault         *VaultClient
+	probes        sync.Map //running probe workers
+	readiness     sync.Map //readiness probe results
+	jobs          sync.Map //job states
+	waiting       sync.Map //containers waiting for dependencies
+	misplaced     sync.Map //endpoints on a node no longer matching the service
+	pulls         sync.Map //image pull states
+	imageUpdates  sync.Map //auto update image digests
+	imageUsed     sync.Map //image last used time
+	states        sync.Map //container inspect cache
+	restarts      sync.Map //crash loop backoff states
+	stopped       sync.Map //containers stopped by api, saved in WorkDir
+	baselines     sync.Map //container config digests at creation
+	drifts        sync.Map //reported config drifts
 }
 
 //Start ...
-func Start(store core.KVStore, node core.NodeConfig) error {
-	cli, err := client.NewEnvClient()
+func Start(store core.KVStore, node core.NodeConfig, secretKey string) error {
+	rt, err := newRuntime(&node)
 	if err != nil {
 		return err
 	}
 	edpstore := resStore.NewStore(store, new(core.Endpoint))
 	eventstore := resStore.NewStore(store, new(core.Event))
 	d := &daemon{
-		c:             cli,
+		rt:            rt,
 		store:         store,
 		node:          &node,
 		mu:            new(sync.Mutex),
 		endpointCache: make(map[string]*core.Endpoint),
 		edpstore:      edpstore,
 		eventstore:    eventstore,
+		secretKey:     secretKey,
+		queue:         newWorkQueue(time.Second, 5*time.Minute),
+		stateTrigger:  make(chan struct{}, 1),
+		svcEvents:     new(broadcaster),
+		edpEvents:     new(broadcaster),
+		stopCh:        make(chan struct{}),
 	}
 	if node.Vault.Address != "" {
-		c, err := newVault(node.Vault.Address, node.Vault.TOKEN)
+		c, err := newVault(node.Vault)
 		if err != nil {
 			return err
 		}
@@ -56,10 +89,18 @@ func Start(store core.KVStore, node core.NodeConfig) error {
 	if err != nil {
 		return err
 	}
+	err = d.cacheSecret()
+	if err != nil {
+		return err
+	}
 	err = d.cacheEndpoint()
 	if err != nil {
 		return err
 	}
+	d.loadImageUpdates()
+	d.loadDriftBaselines()
+	d.loadStopped()
+	d.startShutdownStopped()
 	err = d.cacheService()
 	if err != nil {
 		return err
@@ -69,12 +110,29 @@ func Start(store core.KVStore, node core.NodeConfig) error {
 		return err
 	}
 	go d.run()
+	go d.watchConfigMaps()
+	go d.watchImageUpdates()
+	go d.imageGC()
+	go d.watchDrift()
 	go d.dnsServer()
-	err = startLVS(d.svcLister, d.edpLister)
+	err = startLVS(d.svcLister, d.edpLister, d.svcEvents.subscribe(), d.edpEvents.subscribe())
 	if err != nil {
 		return err
 	}
-	go metrics.Start(cli, node)
-	err = d.reg()
-	return err
+	go metrics.Start(rt, node)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- d.reg()
+	}()
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err = <-errCh:
+		return err
+	case sig := <-sigc:
+		//再次收到信号时直接退出
+		signal.Stop(sigc)
+		logrus.Infof("received %s, shutting down", sig)
+		return d.shutdown()
+	}
 }
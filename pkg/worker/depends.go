@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"strings"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//serviceKeys 所有服务，格式为service.namespace
+func (d *daemon) serviceKeys() map[string]bool {
+	keys := make(map[string]bool)
+	if d.svcLister == nil {
+		return keys
+	}
+	ress, _ := d.svcLister.List()
+	for _, res := range ress {
+		svc := res.(*core.Service)
+		keys[strings.Split(svc.Name, "@")[0]+"."+svc.Namespace] = true
+	}
+	return keys
+}
+
+//unreadyDependencies 返回未就绪的依赖
+//依赖为同服务的端点名时要求该端点就绪，为service.namespace 时要求服务至少有一个就绪端点
+func (d *daemon) unreadyDependencies(svc *core.ContainerService) []string {
+	if len(svc.DependsOn) == 0 {
+		return nil
+	}
+	if d.edpLister == nil {
+		return svc.DependsOn
+	}
+	ress, ok := d.edpLister.List()
+	if !ok {
+		return svc.DependsOn
+	}
+	self := d.getEndpointByContainerName(svc.Name)
+	svcKeys := d.serviceKeys()
+	unready := make([]string, 0)
+	for _, dep := range svc.DependsOn {
+		ns, service, name := self.Namespace, self.Service, dep
+		if svcKeys[dep] {
+			i := strings.LastIndex(dep, ".")
+			service, ns, name = dep[:i], dep[i+1:], ""
+		}
+		ready := false
+		for _, res := range ress {
+			edp := res.(*core.Endpoint)
+			if edp.Namespace != ns || edp.Service != service || (name != "" && edp.Name != name) {
+				continue
+			}
+			if edp.Status.IsReady() {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			unready = append(unready, dep)
+		}
+	}
+	return unready
+}
+
+//sortByDependencies 按依赖关系排序，被依赖的容器在前，返回排序结果和存在循环依赖的容器
+func sortByDependencies(svcs []*core.ContainerService) ([]*core.ContainerService, []*core.ContainerService) {
+	index := make(map[string]int)
+	for i, svc := range svcs {
+		index[svc.Name] = i
+	}
+	//deps[i] 为svcs[i] 依赖的本批容器
+	deps := make([][]int, len(svcs))
+	for i, svc := range svcs {
+		ns := strings.Split(svc.Name, "_")
+		for _, dep := range svc.DependsOn {
+			if j, ok := index["oars_"+ns[1]+"_"+ns[2]+"_"+dep]; ok && j != i {
+				deps[i] = append(deps[i], j)
+				continue
+			}
+			k := strings.LastIndex(dep, ".")
+			if k < 0 {
+				continue
+			}
+			prefix := "oars_" + dep[k+1:] + "_" + dep[:k] + "_"
+			for j, other := range svcs {
+				if j != i && strings.HasPrefix(other.Name, prefix) {
+					deps[i] = append(deps[i], j)
+				}
+			}
+		}
+	}
+	sorted := make([]*core.ContainerService, 0, len(svcs))
+	done := make([]bool, len(svcs))
+	for progress := true; progress; {
+		progress = false
+		for i, svc := range svcs {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for _, j := range deps[i] {
+				if !done[j] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				done[i] = true
+				progress = true
+				sorted = append(sorted, svc)
+			}
+		}
+	}
+	cyclic := make([]*core.ContainerService, 0)
+	for i, svc := range svcs {
+		if !done[i] {
+			cyclic = append(cyclic, svc)
+		}
+	}
+	return sorted, cyclic
+}
+
+//setWaiting 记录容器等待原因，原因变化时才产生事件
+func (d *daemon) setWaiting(edp *core.Endpoint, name, status, reason string) {
+	if v, ok := d.waiting.Load(name); ok && v.(string) == reason {
+		return
+	}
+	d.waiting.Store(name, reason)
+	d.addEvent(edp, core.DependencyEventAction, status, reason)
+}
@@ -41,7 +41,7 @@ func (d *daemon) dnsHandle(w dns.ResponseWriter, req *dns.Msg) {
 		resources, _ := d.edpLister.List()
 		for _, resource := range resources {
 			endpoint := resource.(*core.Endpoint)
-			if endpoint.Status.State == "running" {
+			if endpoint.Status.IsReady() {
 				if endpoint.Service+"."+endpoint.Namespace == dom {
 					addrs = append(addrs, endpoint.Status.IP)
 				}
@@ -75,7 +75,7 @@ func (d *daemon) dnsHandle(w dns.ResponseWriter, req *dns.Msg) {
 		m.Answer = make([]dns.RR, 0)
 		for _, addr := range addrs {
 			rr := new(dns.A)
-			rr.Hdr = dns.RR_Header{Name: domain, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 86400}
+			rr.Hdr = dns.RR_Header{Name: domain, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 10}
 			rr.A = net.ParseIP(addr)
 			m.Answer = append(m.Answer, rr)
 		}
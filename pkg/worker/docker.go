@@ -1,87 +1,59 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 
 	"github.com/oars-sigs/oars-cloud/core"
 	"github.com/oars-sigs/oars-cloud/pkg/utils/netutils"
+	"github.com/oars-sigs/oars-cloud/pkg/worker/metrics"
 )
 
-func (d *daemon) Create(ctx context.Context, svc *core.ContainerService) (string, error) {
-	edp := d.getEndpointByContainerName(svc.Name)
-	mounts := make([]mount.Mount, 0)
-	for _, v := range svc.Volumes {
-		ms := strings.Split(v, ":")
-		if len(ms) != 2 {
-			return "", errors.New("volumes format error")
-		}
-		srcPath := ms[0]
-		if !filepath.IsAbs(srcPath) {
-			srcPath = fmt.Sprintf("%s/volume/%s/%s/%s", d.node.WorkDir, edp.Namespace, edp.Service, srcPath)
-		}
-		os.MkdirAll(srcPath, 0777)
-		mounts = append(mounts, mount.Mount{
-			Target: ms[1],
-			Source: srcPath,
-			Type:   mount.Type("bind"),
-		})
+//dockerRuntime docker 运行时
+type dockerRuntime struct {
+	c *client.Client
+}
+
+func newDockerRuntime() (*dockerRuntime, error) {
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		return nil, err
 	}
-	for k, v := range svc.ConfigMap {
-		cfgPath := d.node.WorkDir + "/configmap/" + edp.Namespace + "/" + edp.Service + "/" + strings.TrimPrefix(k, "/")
-		err := os.MkdirAll(filepath.Dir(cfgPath), 0755)
-		if err != nil {
-			return "", err
-		}
-		err = ioutil.WriteFile(cfgPath, []byte(v), 0644)
-		if err != nil {
-			return "", err
-		}
+	return &dockerRuntime{c: cli}, nil
+}
+
+func (d *dockerRuntime) Create(ctx context.Context, spec *ContainerSpec) (string, error) {
+	svc := spec.ContainerService
+	mounts := make([]mount.Mount, 0, len(spec.Mounts))
+	for _, m := range spec.Mounts {
 		mounts = append(mounts, mount.Mount{
-			Target: k,
-			Source: cfgPath,
+			Target: m.Target,
+			Source: m.Source,
 			Type:   mount.Type("bind"),
 		})
 	}
-	if svc.Port == nil {
-		svc.Port = new(core.ContainerPort)
-	}
-	if svc.Port.ContainerPort == 0 {
-		port, err := getFreePort()
-		if err != nil {
-			return "", err
-		}
-		svc.Port.ContainerPort = port
-	}
-	if svc.Port.Protocol == "" {
-		svc.Port.Protocol = "tcp"
-	}
-	if svc.Environment == nil {
-		svc.Environment = make([]string, 0)
-	}
-	svc.Environment = append(svc.Environment, fmt.Sprintf("OARS_SERVICE_PORT=%d", svc.Port.ContainerPort))
-	svc.Environment = append(svc.Environment, fmt.Sprintf("OARS_HOST_MAC=%s", d.node.MAC))
-	svc.Environment = append(svc.Environment, fmt.Sprintf("OARS_HOST_IP=%s", d.node.IP))
-	svc.Environment = append(svc.Environment, fmt.Sprintf("OARS_HOST_NAME=%s", d.node.Hostname))
-	svc.Environment = append(svc.Environment, fmt.Sprintf("OARS_HOST_INTERFACE=%s", d.node.Interface))
-
-	if svc.Resources == nil {
-		svc.Resources = new(core.ContainerResource)
-	}
 	ports := make(nat.PortMap)
 	portSet := make(nat.PortSet)
 	for _, p := range svc.Ports {
@@ -123,21 +95,15 @@ func (d *daemon) Create(ctx context.Context, svc *core.ContainerService) (string
 		ExposedPorts: portSet,
 	}
 
-	cfg.Labels[core.ServicePortLabelKey] = fmt.Sprintf("%d", svc.Port.ContainerPort)
-	netMode := "bridge"
-	if svc.NetworkMode != "" {
-		netMode = svc.NetworkMode
-	}
-
 	hostCfg := &container.HostConfig{
 		RestartPolicy: container.RestartPolicy{
 			Name: svc.Restart,
 		},
-		NetworkMode: container.NetworkMode(netMode),
+		NetworkMode: container.NetworkMode(svc.NetworkMode),
 		Mounts:      mounts,
-		DNS:         []string{d.node.IP},
+		DNS:         spec.DNS,
 		Resources: container.Resources{
-			Memory:   svc.Resources.Memory * 1024,
+			Memory:   svc.Resources.MemoryBytes(),
 			CPUQuota: int64(svc.Resources.CPU * float64(100000)),
 		},
 		CapAdd:       strslice.StrSlice(svc.CapAdd),
@@ -149,19 +115,12 @@ func (d *daemon) Create(ctx context.Context, svc *core.ContainerService) (string
 		Sysctls:      svc.Sysctls,
 		PortBindings: ports,
 	}
-	if d.node.Loki.Enabled {
-		labels := fmt.Sprintf("container_name={{.Name}},namespace=%s,service=%s,endpoint=%s", edp.Namespace, edp.Service, edp.Name)
+	if spec.LogDriver != "" {
 		hostCfg.LogConfig = container.LogConfig{
-			Type: d.node.Loki.Drive,
-			Config: map[string]string{
-				"loki-url":             d.node.Loki.URL,
-				"max-size":             d.node.Loki.MaxSize,
-				"max-file":             d.node.Loki.MaxFile,
-				"loki-external-labels": labels,
-			},
+			Type:   spec.LogDriver,
+			Config: spec.LogOptions,
 		}
 	}
-	//hostCfg.DNS = append(hostCfg.DNS, d.node.UpDNS...)
 	ct, err := d.c.ContainerCreate(ctx, cfg, hostCfg, nil, svc.Name)
 	if err != nil {
 		return "", err
@@ -169,94 +128,232 @@ func (d *daemon) Create(ctx context.Context, svc *core.ContainerService) (string
 	return ct.ID, err
 }
 
-func (d *daemon) ImagePull(ctx context.Context, svc *core.ContainerService) error {
-	if svc.ImagePullPolicy == "" {
-		svc.ImagePullPolicy = core.ImagePullIfNotPresent
-	}
-	if svc.ImagePullPolicy == core.ImagePullAlways || svc.ImagePullPolicy == core.ImagePullIfNotPresent {
-		pullFlag := true
-		if svc.ImagePullPolicy == core.ImagePullIfNotPresent {
-			imgs, err := d.c.ImageList(ctx, types.ImageListOptions{})
-			if err != nil {
-				return err
-			}
-			imgExist := false
-			for _, img := range imgs {
-				for _, tag := range img.RepoTags {
-					if tag == svc.Image {
-						imgExist = true
-					}
-				}
-			}
-			pullFlag = !imgExist
-		}
-		if pullFlag {
-			distributionRef, err := reference.ParseNormalizedNamed(svc.Image)
-			if err != nil {
-				return err
-			}
-			fs, err := d.c.ImagePull(ctx, distributionRef.String(), types.ImagePullOptions{RegistryAuth: svc.ImagePullAuth})
-			if err != nil {
-				return err
-			}
-			defer fs.Close()
-			_, err = d.c.ImageLoad(ctx, fs, false)
-			if err != nil {
-				return err
-			}
+//ImageExist 由docker 解析镜像名，支持短名称和digest 引用
+func (d *dockerRuntime) ImageExist(ctx context.Context, image string) (bool, error) {
+	_, _, err := d.c.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return false, nil
 		}
+		return false, err
 	}
-	return nil
+	return true, nil
 }
 
-func (d *daemon) ImageRef(ctx context.Context, image string) (string, error) {
-	distributionRef, err := reference.ParseNormalizedNamed(image)
+func (d *dockerRuntime) ImageDigest(ctx context.Context, image string) (string, error) {
+	img, _, err := d.c.ImageInspectWithRaw(ctx, image)
 	if err != nil {
 		return "", err
 	}
-	return distributionRef.String(), nil
+	return repoDigest(image, img.RepoDigests), nil
 }
 
-func (d *daemon) ImageList(ctx context.Context) error {
+//RemoteDigest 由docker daemon 查询镜像仓库，使用daemon 的镜像仓库配置
+func (d *dockerRuntime) RemoteDigest(ctx context.Context, image, auth string) (string, error) {
+	res, err := d.c.DistributionInspect(ctx, image, auth)
+	if err != nil {
+		return "", err
+	}
+	return res.Descriptor.Digest.String(), nil
+}
+
+func (d *dockerRuntime) ImageList(ctx context.Context) ([]Image, error) {
 	imgs, err := d.c.ImageList(ctx, types.ImageListOptions{})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	res := make([]Image, 0, len(imgs))
 	for _, img := range imgs {
-		fmt.Println(img.RepoTags)
+		res = append(res, Image{
+			ID:       img.ID,
+			RepoTags: img.RepoTags,
+			Size:     img.Size,
+			Created:  time.Unix(img.Created, 0),
+		})
 	}
-	return nil
+	return res, nil
+}
+
+func (d *dockerRuntime) ImageRemove(ctx context.Context, id string) error {
+	_, err := d.c.ImageRemove(ctx, id, types.ImageRemoveOptions{PruneChildren: true})
+	return err
 }
 
-func (d *daemon) Start(ctx context.Context, id string) error {
+//ImageRoot docker 数据目录，镜像层所在的磁盘
+func (d *dockerRuntime) Stats(ctx context.Context) ([]*metrics.ContainerMetrics, error) {
+	return metrics.DockerStats(ctx, d.c)
+}
+
+func (d *dockerRuntime) ImageRoot(ctx context.Context) (string, error) {
+	info, err := d.c.Info(ctx)
+	if err != nil {
+		return "", err
+	}
+	return info.DockerRootDir, nil
+}
+
+//ImagePull 解析拉取的json 流，按层汇总进度
+func (d *dockerRuntime) ImagePull(ctx context.Context, image, auth string, progress func(PullProgress)) error {
+	distributionRef, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return err
+	}
+	fs, err := d.c.ImagePull(ctx, distributionRef.String(), types.ImagePullOptions{RegistryAuth: auth})
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+	type layer struct{ current, total int64 }
+	layers := make(map[string]*layer)
+	dec := json.NewDecoder(fs)
+	for {
+		var msg jsonmessage.JSONMessage
+		err := dec.Decode(&msg)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if msg.ID != "" && msg.Progress != nil && msg.Status == "Downloading" {
+			layers[msg.ID] = &layer{msg.Progress.Current, msg.Progress.Total}
+		}
+		if msg.ID != "" && (msg.Status == "Download complete" || msg.Status == "Already exists") {
+			if l, ok := layers[msg.ID]; ok {
+				l.current = l.total
+			}
+		}
+		if progress == nil {
+			continue
+		}
+		p := PullProgress{Status: msg.Status}
+		for _, l := range layers {
+			p.Current += l.current
+			p.Total += l.total
+		}
+		progress(p)
+	}
+}
+
+func (d *dockerRuntime) Start(ctx context.Context, id string) error {
 	return d.c.ContainerStart(ctx, id, types.ContainerStartOptions{})
 }
 
-func (d *daemon) Stop(ctx context.Context, id string) error {
-	timeout := 10 * time.Second
+func (d *dockerRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
 	return d.c.ContainerStop(ctx, id, &timeout)
 }
 
-func (d *daemon) Remove(ctx context.Context, id string) error {
-	d.Stop(ctx, id)
+func (d *dockerRuntime) Remove(ctx context.Context, id string) error {
+	d.Stop(ctx, id, defaultStopTimeout)
 	return d.c.ContainerRemove(ctx, id, types.ContainerRemoveOptions{Force: true})
 
 }
 
-func (d *daemon) List(ctx context.Context) ([]types.Container, error) {
-	return d.c.ContainerList(context.Background(), types.ContainerListOptions{All: true})
+func (d *dockerRuntime) List(ctx context.Context) ([]Container, error) {
+	cs, err := d.c.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Container, 0, len(cs))
+	for _, cn := range cs {
+		c := Container{
+			ID:       cn.ID,
+			Name:     strings.TrimPrefix(cn.Names[0], "/"),
+			Image:    cn.Image,
+			ImageID:  cn.ImageID,
+			Labels:   cn.Labels,
+			State:    cn.State,
+			Status:   cn.Status,
+			Networks: make(map[string]ContainerNetwork),
+		}
+		if cn.NetworkSettings != nil {
+			for name, netw := range cn.NetworkSettings.Networks {
+				c.Networks[name] = ContainerNetwork{IP: netw.IPAddress, Gateway: netw.Gateway}
+			}
+		}
+		res = append(res, c)
+	}
+	return res, nil
+}
+
+func (d *dockerRuntime) Inspect(ctx context.Context, id string) (*ContainerState, error) {
+	cj, err := d.c.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return containerState(cj), nil
+}
+
+//containerState 从docker inspect 结果中取出状态
+func containerState(cj types.ContainerJSON) *ContainerState {
+	state := new(ContainerState)
+	if cj.ContainerJSONBase == nil || cj.State == nil {
+		return state
+	}
+	state.Status = cj.State.Status
+	state.ExitCode = cj.State.ExitCode
+	state.OOMKilled = cj.State.OOMKilled
+	state.RestartCount = cj.RestartCount
+	state.StartedAt, _ = time.Parse(time.RFC3339Nano, cj.State.StartedAt)
+	state.FinishedAt, _ = time.Parse(time.RFC3339Nano, cj.State.FinishedAt)
+	return state
+}
+
+func (d *dockerRuntime) InspectConfig(ctx context.Context, id string) (*ContainerConfig, error) {
+	cj, err := d.c.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return containerConfig(cj), nil
+}
+
+//containerConfig 从docker inspect 结果中取出配置
+func containerConfig(cj types.ContainerJSON) *ContainerConfig {
+	cfg := new(ContainerConfig)
+	if cj.Config != nil {
+		cfg.Image = cj.Config.Image
+		cfg.Env = cj.Config.Env
+		cfg.Labels = cj.Config.Labels
+	}
+	if cj.ContainerJSONBase != nil && cj.HostConfig != nil {
+		cfg.Memory = cj.HostConfig.Memory
+		cfg.CPUQuota = cj.HostConfig.CPUQuota
+	}
+	for _, m := range cj.Mounts {
+		if m.Type == mount.TypeBind {
+			cfg.Mounts = append(cfg.Mounts, Mount{Source: m.Source, Target: m.Destination})
+		}
+	}
+	return cfg
 }
 
-func (d *daemon) Inspect(ctx context.Context, id string) (types.ContainerJSON, error) {
-	return d.c.ContainerInspect(context.Background(), id)
+func (d *dockerRuntime) Events(ctx context.Context, out func(ContainerEvent)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	msgs, errs := d.c.Events(ctx, types.EventsOptions{Filters: filters.NewArgs(filters.Arg("type", "container"))})
+	for {
+		select {
+		case msg := <-msgs:
+			out(ContainerEvent{
+				ID:     msg.Actor.ID,
+				Name:   strings.TrimPrefix(msg.Actor.Attributes["name"], "/"),
+				Action: msg.Action,
+			})
+		case err := <-errs:
+			return err
+		}
+	}
 }
 
-func (d *daemon) Restart(ctx context.Context, id string) error {
+func (d *dockerRuntime) Restart(ctx context.Context, id string) error {
 	timeout := 30 * time.Second
 	return d.c.ContainerRestart(ctx, id, &timeout)
 }
 
-func (d *daemon) Log(ctx context.Context, id, tail, since string) (string, error) {
+func (d *dockerRuntime) Log(ctx context.Context, id, tail, since string) (string, error) {
 	r, err := d.c.ContainerLogs(ctx, id, types.ContainerLogsOptions{
 		Tail:       tail,
 		Since:      since,
@@ -267,38 +364,217 @@ func (d *daemon) Log(ctx context.Context, id, tail, since string) (string, error
 		return "", err
 	}
 	defer r.Close()
-	data, err := ioutil.ReadAll(r)
+	var out bytes.Buffer
+	_, err = stdcopy.StdCopy(&out, &out, r)
 	if err != nil {
 		return "", err
 	}
-	return string(data), nil
+	return out.String(), nil
 }
-func (d *daemon) Exec(id string, cmd string) (types.HijackedResponse, error) {
-	ctx := context.Background()
-	resp := types.HijackedResponse{}
+
+//LogStream 分离stdout 和stderr，按行输出带时间戳的日志
+func (d *dockerRuntime) LogStream(ctx context.Context, id string, opt *core.EndpointLogOpt, out func(*core.EndpointLogLine) error) error {
+	r, err := d.c.ContainerLogs(ctx, id, types.ContainerLogsOptions{
+		Tail:       opt.Tail,
+		Since:      opt.Since,
+		Until:      opt.Until,
+		Follow:     opt.Follow,
+		Timestamps: true,
+		ShowStdout: true,
+		ShowStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	stdout := &logLineWriter{stream: "stdout", out: out}
+	stderr := &logLineWriter{stream: "stderr", out: out}
+	_, err = stdcopy.StdCopy(stdout, stderr, r)
+	if err != nil {
+		return err
+	}
+	err = stdout.Flush()
+	if err != nil {
+		return err
+	}
+	return stderr.Flush()
+}
+
+func (d *dockerRuntime) Exec(ctx context.Context, id string, opt *core.EndpointExecOpt) (ExecConn, error) {
 	opts := types.ExecConfig{
+		User:         opt.User,
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
-		Tty:          true,
-		Cmd:          strings.Split(cmd, " "),
+		Tty:          opt.Tty,
+		Env:          opt.Env,
+		Cmd:          opt.Cmd,
 		Detach:       false,
 	}
 	idResp, err := d.c.ContainerExecCreate(ctx, id, opts)
 	if err != nil {
-		return resp, err
+		return nil, err
 	}
-	resp, err = d.c.ContainerExecAttach(ctx, idResp.ID, types.ExecStartCheck{
+	resp, err := d.c.ContainerExecAttach(ctx, idResp.ID, types.ExecStartCheck{
 		Detach: false,
-		Tty:    true,
+		Tty:    opt.Tty,
 	})
 	if err != nil {
-		return resp, err
+		return nil, err
+	}
+	c := &hijackedConn{HijackedResponse: resp, d: d, cid: id, id: idResp.ID, out: resp.Reader}
+	if !opt.Tty {
+		//非tty 时输出带stdout、stderr 头
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, resp.Reader)
+			pw.CloseWithError(err)
+		}()
+		c.out = pr
+	}
+	if opt.Rows > 0 && opt.Cols > 0 {
+		c.Resize(opt.Rows, opt.Cols)
 	}
-	return resp, err
+	return c, nil
+}
+
+//hijackedConn 将docker hijack 连接包装为ExecConn
+type hijackedConn struct {
+	types.HijackedResponse
+	d   *dockerRuntime
+	cid string //容器ID
+	id  string //exec ID
+	out io.Reader
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.out.Read(p)
+}
+
+func (c *hijackedConn) Write(p []byte) (int, error) {
+	return c.Conn.Write(p)
 }
 
-func (d *daemon) CreateNetwork(name, driver, subnet string) error {
+func (c *hijackedConn) Close() error {
+	return c.Conn.Close()
+}
+
+func (c *hijackedConn) Resize(rows, cols uint) error {
+	return c.d.c.ContainerExecResize(context.Background(), c.id, types.ResizeOptions{Height: rows, Width: cols})
+}
+
+//Signal docker 不支持向exec 进程发信号，在容器中执行kill 发送，
+//进程在容器pid 命名空间中的pid 从/proc 读取，worker 看不到该进程时不支持
+func (c *hijackedConn) Signal(sig syscall.Signal) error {
+	ctx := context.Background()
+	inspect, err := c.d.c.ContainerExecInspect(ctx, c.id)
+	if err != nil {
+		return err
+	}
+	if !inspect.Running || inspect.Pid <= 0 {
+		return errors.New("exec process is not running")
+	}
+	pid, err := containerPid(procRoot, inspect.Pid, c.cid)
+	if err != nil {
+		return err
+	}
+	code, out, err := c.d.ExecRun(ctx, c.cid, []string{"kill", "-" + strconv.Itoa(int(sig)), strconv.Itoa(pid)})
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return fmt.Errorf("kill exited with code %d: %s", code, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+//procRoot worker 可见的proc 文件系统
+var procRoot = "/proc"
+
+//containerPid 主机pid 在容器pid 命名空间中的pid，
+//通过cgroup 确认进程属于该容器，避免worker 不在主机pid 命名空间时误认其他进程
+func containerPid(proc string, pid int, containerID string) (int, error) {
+	unsupported := fmt.Errorf("signal is not supported: exec process %d is not visible to the worker", pid)
+	dir := filepath.Join(proc, strconv.Itoa(pid))
+	cgroup, err := ioutil.ReadFile(filepath.Join(dir, "cgroup"))
+	if err != nil || containerID == "" || !strings.Contains(string(cgroup), containerID) {
+		return 0, unsupported
+	}
+	status, err := ioutil.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return 0, unsupported
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+		//最后一个为最内层命名空间中的pid
+		fields := strings.Fields(strings.TrimPrefix(line, "NSpid:"))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.Atoi(fields[len(fields)-1])
+	}
+	return 0, unsupported
+}
+
+//ExitCode 输出结束时进程可能尚未标记为退出，稍作等待
+func (c *hijackedConn) ExitCode() (int, error) {
+	for i := 0; ; i++ {
+		inspect, err := c.d.c.ContainerExecInspect(context.Background(), c.id)
+		if err != nil {
+			return 0, err
+		}
+		if !inspect.Running || i >= 10 {
+			return inspect.ExitCode, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+//ExecRun 在容器中执行命令，返回退出码和输出
+func (d *dockerRuntime) ExecRun(ctx context.Context, id string, cmd []string) (int, string, error) {
+	idResp, err := d.c.ContainerExecCreate(ctx, id, types.ExecConfig{
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	resp, err := d.c.ContainerExecAttach(ctx, idResp.ID, types.ExecStartCheck{})
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Close()
+	var out bytes.Buffer
+	_, err = stdcopy.StdCopy(&out, &out, resp.Reader)
+	if err != nil {
+		return 0, "", err
+	}
+	inspect, err := d.c.ContainerExecInspect(ctx, idResp.ID)
+	if err != nil {
+		return 0, "", err
+	}
+	return inspect.ExitCode, out.String(), nil
+}
+
+func (d *dockerRuntime) CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, int64, error) {
+	rc, stat, err := d.c.CopyFromContainer(ctx, id, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if stat.Mode.IsDir() {
+		return rc, -1, nil
+	}
+	return rc, stat.Size, nil
+}
+
+func (d *dockerRuntime) CopyTo(ctx context.Context, id, path string, content io.Reader) error {
+	return d.c.CopyToContainer(ctx, id, path, content, types.CopyToContainerOptions{})
+}
+
+func (d *dockerRuntime) CreateNetwork(ctx context.Context, name, driver, subnet string) error {
 	gateway, err := netutils.FirstSubnetIP(subnet)
 	if err != nil {
 		return err
@@ -316,12 +592,12 @@ func (d *daemon) CreateNetwork(name, driver, subnet string) error {
 		},
 		CheckDuplicate: true,
 	}
-	_, err = d.c.NetworkCreate(context.Background(), name, nc)
+	_, err = d.c.NetworkCreate(ctx, name, nc)
 	return err
 }
 
-func (d *daemon) ListNetworks() ([]string, error) {
-	nets, err := d.c.NetworkList(context.Background(), types.NetworkListOptions{})
+func (d *dockerRuntime) ListNetworks(ctx context.Context) ([]string, error) {
+	nets, err := d.c.NetworkList(ctx, types.NetworkListOptions{})
 	if err != nil {
 		return nil, err
 	}
@@ -332,13 +608,6 @@ func (d *daemon) ListNetworks() ([]string, error) {
 	return res, err
 }
 
-var (
-	errNotFound = errors.New("No such container")
-)
-
-func (d *daemon) dockerError(err error) error {
-	if strings.Contains(err.Error(), "No such container") {
-		return errNotFound
-	}
-	return err
+func (d *dockerRuntime) IsNotFound(err error) bool {
+	return strings.Contains(err.Error(), "No such container")
 }
@@ -4,26 +4,21 @@ import (
 	"context"
 	"os"
 	"testing"
-
-	"github.com/docker/docker/client"
 )
 
 func TestDocker(t *testing.T) {
 	os.Setenv("DOCKER_HOST", "tcp://188.8.5.14:2375")
-	cli, err := client.NewEnvClient()
+	rt, err := newDockerRuntime()
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	d := daemon{
-		c: cli,
-	}
 	ctx := context.Background()
 	//d.ImagePull(context.Background())
-	l, err := d.List(ctx)
+	l, err := rt.List(ctx)
 	for _, c := range l {
-		for kind, netw := range c.NetworkSettings.Networks {
-			t.Log(c.Names, kind, netw)
+		for kind, netw := range c.Networks {
+			t.Log(c.Name, kind, netw)
 		}
 
 	}
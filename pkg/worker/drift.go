@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//driftBaselinesFile 容器创建时的配置摘要，保存在工作目录，worker 重启后仍可检查漂移
+const driftBaselinesFile = "drift-baselines.json"
+
+//driftBaseline 环境变量和挂载包含解析后的密钥和分配的端口，无法由服务重新渲染，创建时记录摘要作为基准
+type driftBaseline struct {
+	Env    string `json:"env"`
+	Mounts string `json:"mounts"`
+}
+
+func newDriftBaseline(cfg *ContainerConfig) driftBaseline {
+	env := append([]string{}, cfg.Env...)
+	sort.Strings(env)
+	mounts := make([]string, 0, len(cfg.Mounts))
+	for _, m := range cfg.Mounts {
+		mounts = append(mounts, m.Source+":"+m.Target)
+	}
+	sort.Strings(mounts)
+	return driftBaseline{Env: md5Values(env), Mounts: md5Values(mounts)}
+}
+
+func (d *daemon) loadDriftBaselines() {
+	data, err := ioutil.ReadFile(filepath.Join(d.node.WorkDir, driftBaselinesFile))
+	if err != nil {
+		return
+	}
+	baselines := make(map[string]driftBaseline)
+	err = json.Unmarshal(data, &baselines)
+	if err != nil {
+		logrus.Errorf("load drift baselines: %v", err)
+		return
+	}
+	for id, b := range baselines {
+		d.baselines.Store(id, b)
+	}
+}
+
+func (d *daemon) saveDriftBaselines() error {
+	baselines := make(map[string]driftBaseline)
+	d.baselines.Range(func(k, v interface{}) bool {
+		baselines[k.(string)] = v.(driftBaseline)
+		return true
+	})
+	data, _ := json.Marshal(baselines)
+	err := os.MkdirAll(d.node.WorkDir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.node.WorkDir, driftBaselinesFile), data, 0644)
+}
+
+//recordDriftBaseline 记录新建容器的配置摘要
+func (d *daemon) recordDriftBaseline(ctx context.Context, id string) {
+	cfg, err := d.rt.InspectConfig(ctx, id)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	d.baselines.Store(id, newDriftBaseline(cfg))
+	err = d.saveDriftBaselines()
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+//watchDrift 定期检查容器配置是否被手动修改
+func (d *daemon) watchDrift() {
+	if d.node.DriftCheckInterval <= 0 {
+		return
+	}
+	t := time.NewTicker(d.node.DriftCheckInterval)
+	for range t.C {
+		d.checkDrift(context.Background())
+	}
+}
+
+//checkDrift 对比容器实际配置与服务定义，有漂移时产生事件，driftPolicy 为repair 时重建
+func (d *daemon) checkDrift(ctx context.Context) {
+	d.mu.Lock()
+	edps := make(map[string]*core.Endpoint, len(d.endpointCache))
+	for k, edp := range d.endpointCache {
+		if edp.Status.ID != "" {
+			edps[k] = edp
+		}
+	}
+	d.mu.Unlock()
+	changed := false
+	for key, edp := range edps {
+		id := edp.Status.ID
+		svc := d.getContainerSvc(d.containerNameByEdp(edp))
+		//等待同步的容器由syncContainer 处理
+		if svc == nil || isJob(svc) || svc.Labels[core.HashLabelKey] != edp.Labels[core.HashLabelKey] {
+			continue
+		}
+		cfg, err := d.rt.InspectConfig(ctx, id)
+		if err != nil {
+			if !d.rt.IsNotFound(err) {
+				logrus.Error(err)
+			}
+			continue
+		}
+		if _, ok := d.baselines.Load(id); !ok {
+			//创建于记录基准之前的容器，以当前配置为基准
+			d.baselines.Store(id, newDriftBaseline(cfg))
+			changed = true
+		}
+		drifts := d.containerDrift(id, svc, cfg)
+		if len(drifts) == 0 {
+			d.drifts.Delete(id)
+			continue
+		}
+		msg := strings.Join(drifts, ", ") + " changed outside of oars"
+		if svc.DriftPolicy == core.DriftPolicyRepair && !svc.Hold {
+			if d.repairDrift(ctx, key, edp, msg) {
+				d.baselines.Delete(id)
+				changed = true
+			}
+			continue
+		}
+		if v, ok := d.drifts.Load(id); ok && v.(string) == msg {
+			continue
+		}
+		d.drifts.Store(id, msg)
+		d.addEvent(edp, core.DriftEventAction, core.FailEventStatus, msg)
+	}
+	if d.pruneDrift(ctx) {
+		changed = true
+	}
+	if changed {
+		err := d.saveDriftBaselines()
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+}
+
+//pruneDrift 清理已删除容器的记录
+func (d *daemon) pruneDrift(ctx context.Context) bool {
+	cs, err := d.rt.List(ctx)
+	if err != nil {
+		logrus.Error(err)
+		return false
+	}
+	exist := make(map[string]bool)
+	for _, cn := range cs {
+		exist[cn.ID] = true
+	}
+	pruned := false
+	d.baselines.Range(func(k, v interface{}) bool {
+		if !exist[k.(string)] {
+			d.baselines.Delete(k)
+			pruned = true
+		}
+		return true
+	})
+	d.drifts.Range(func(k, v interface{}) bool {
+		if !exist[k.(string)] {
+			d.drifts.Delete(k)
+		}
+		return true
+	})
+	return pruned
+}
+
+//containerDrift 返回与服务定义不一致的配置项
+func (d *daemon) containerDrift(id string, svc *core.ContainerService, cfg *ContainerConfig) []string {
+	drifts := make([]string, 0)
+	if cfg.Image != svc.Image {
+		drifts = append(drifts, "image")
+	}
+	for k, v := range svc.Labels {
+		if cfg.Labels[k] != v {
+			drifts = append(drifts, "labels")
+			break
+		}
+	}
+	if v, ok := d.baselines.Load(id); ok {
+		baseline := newDriftBaseline(cfg)
+		if baseline.Env != v.(driftBaseline).Env {
+			drifts = append(drifts, "env")
+		}
+		if baseline.Mounts != v.(driftBaseline).Mounts {
+			drifts = append(drifts, "mounts")
+		}
+	}
+	res := svc.Resources
+	if res == nil {
+		res = new(core.ContainerResource)
+	}
+	if cfg.Memory != res.MemoryBytes() || cfg.CPUQuota != int64(res.CPU*float64(100000)) {
+		drifts = append(drifts, "resources")
+	}
+	return drifts
+}
+
+//repairDrift 删除漂移的容器，由syncContainer 按服务定义重建
+func (d *daemon) repairDrift(ctx context.Context, key string, edp *core.Endpoint, msg string) bool {
+	d.addEvent(edp, core.DriftEventAction, core.InProgressEventStatus, msg+", recreating")
+	err := d.rt.Remove(ctx, edp.Status.ID)
+	if err != nil && !d.rt.IsNotFound(err) {
+		logrus.Error(err)
+		d.addEvent(edp, core.DriftEventAction, core.FailEventStatus, err.Error())
+		return false
+	}
+	d.drifts.Delete(edp.Status.ID)
+	d.mu.Lock()
+	delete(d.endpointCache, key)
+	d.mu.Unlock()
+	d.enqueue(d.containerNameByEdp(edp))
+	d.addEvent(edp, core.DriftEventAction, core.SuccessEventStatus, "")
+	return true
+}
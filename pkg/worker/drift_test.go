@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestCheckDrift(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	dir, err := ioutil.TempDir("", "oars-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d.node.WorkDir = dir
+	svc := &core.ContainerService{
+		Name:        "oars_default_web_web-0",
+		Image:       "nginx:latest",
+		Environment: []string{"LEVEL=info"},
+		Resources:   &core.ContainerResource{Memory: 1024},
+		Labels: map[string]string{
+			core.CreatorLabelKey: "oars",
+			core.HashLabelKey:    "v1",
+		},
+	}
+	d.svcCache.Store(svc.Name, svc)
+	syncAll(t, d)
+	syncContainers(t, d)
+	cs, _ := rt.List(context.Background())
+	if len(cs) != 1 {
+		t.Fatalf("expect container created, got %+v", cs)
+	}
+	id := cs[0].ID
+	ctx := context.Background()
+	d.checkDrift(ctx)
+	if _, ok := d.drifts.Load(id); ok {
+		t.Fatal("unexpected drift for new container")
+	}
+
+	//docker update 修改资源、手动重建修改环境变量
+	rt.configs[id].Memory = 0
+	rt.configs[id].Env = append(rt.configs[id].Env, "DEBUG=1")
+	d.checkDrift(ctx)
+	if v, ok := d.drifts.Load(id); !ok || v.(string) != "env, resources changed outside of oars" {
+		t.Fatalf("expect env and resources drift, got %v", v)
+	}
+
+	//基准在worker 重启后仍有效
+	d2 := newFakeDaemon(rt)
+	d2.node.WorkDir = dir
+	d2.loadDriftBaselines()
+	if _, ok := d2.baselines.Load(id); !ok {
+		t.Fatal("expect baseline loaded from work dir")
+	}
+
+	svc.DriftPolicy = core.DriftPolicyRepair
+	d.checkDrift(ctx)
+	if cs, _ := rt.List(ctx); len(cs) != 0 {
+		t.Fatalf("expect drifted container removed, got %+v", cs)
+	}
+	syncAll(t, d)
+	syncContainers(t, d)
+	cs, _ = rt.List(ctx)
+	if len(cs) != 1 || cs[0].ID == id {
+		t.Fatalf("expect container recreated, got %+v", cs)
+	}
+	d.checkDrift(ctx)
+	if _, ok := d.baselines.Load(id); ok {
+		t.Fatal("baseline of removed container should be pruned")
+	}
+	if _, ok := d.drifts.Load(cs[0].ID); ok {
+		t.Fatal("unexpected drift for recreated container")
+	}
+}
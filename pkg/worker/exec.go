@@ -0,0 +1,319 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	dsignal "github.com/docker/docker/pkg/signal"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024 * 1024 * 10,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
+//defaultShell 未指定命令时优先使用bash
+var defaultShell = []string{"sh", "-c", "if command -v bash >/dev/null 2>&1; then exec bash; else exec sh; fi"}
+
+//parseExecOpt 解析exec 参数，cmd、env 可重复，tty 默认开启
+func parseExecOpt(q url.Values) (*core.EndpointExecOpt, error) {
+	opt := &core.EndpointExecOpt{
+		Cmd:  q["cmd"],
+		Env:  q["env"],
+		User: q.Get("user"),
+		Tty:  q.Get("tty") != "false",
+	}
+	if len(opt.Cmd) == 0 {
+		opt.Cmd = defaultShell
+	}
+	for _, p := range []struct {
+		name string
+		v    *uint
+	}{{"rows", &opt.Rows}, {"cols", &opt.Cols}} {
+		s := q.Get(p.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(s, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %s", p.name, s)
+		}
+		*p.v = uint(n)
+	}
+	return opt, nil
+}
+
+//execSession 一次exec 的websocket 连接，二进制消息为终端数据，文本消息为控制帧
+type execSession struct {
+	ws   *websocket.Conn
+	conn ExecConn
+	rec  *execRecorder
+	mu   sync.Mutex
+}
+
+func (s *execSession) write(mt int, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ws.WriteMessage(mt, data)
+}
+
+func (s *execSession) control(c *core.ExecControl) error {
+	data, _ := json.Marshal(c)
+	return s.write(websocket.TextMessage, data)
+}
+
+//input 转发终端输入并处理控制帧，不是控制帧的文本消息作为输入以兼容旧客户端
+func (s *execSession) input() {
+	defer s.conn.Close()
+	for {
+		mt, data, err := s.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if mt == websocket.TextMessage {
+			var c core.ExecControl
+			if json.Unmarshal(data, &c) == nil && (c.Type == core.ExecResize || c.Type == core.ExecSignal) {
+				err := s.handleControl(&c)
+				if err != nil {
+					s.control(&core.ExecControl{Type: core.ExecError, Message: err.Error()})
+				}
+				continue
+			}
+		}
+		s.rec.input(data)
+		_, err = s.conn.Write(data)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *execSession) handleControl(c *core.ExecControl) error {
+	switch c.Type {
+	case core.ExecResize:
+		if c.Rows == 0 || c.Cols == 0 {
+			return fmt.Errorf("invalid size %dx%d", c.Cols, c.Rows)
+		}
+		s.rec.resize(c.Rows, c.Cols)
+		return s.conn.Resize(c.Rows, c.Cols)
+	case core.ExecSignal:
+		sig, err := dsignal.ParseSignal(c.Signal)
+		if err != nil {
+			return err
+		}
+		s.rec.marker("signal " + c.Signal)
+		return s.conn.Signal(sig)
+	}
+	return nil
+}
+
+//output 转发输出，结束后发送退出码
+func (s *execSession) output() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.conn.Read(buf)
+		if n > 0 {
+			s.rec.output(buf[:n])
+			if werr := s.write(websocket.BinaryMessage, buf[:n]); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	code, err := s.conn.ExitCode()
+	if err != nil {
+		s.control(&core.ExecControl{Type: core.ExecError, Message: err.Error()})
+	} else {
+		s.control(&core.ExecControl{Type: core.ExecExit, Code: code})
+	}
+	s.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func (d *daemon) exec(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	defer c.Close()
+	s := &execSession{ws: c}
+	q := r.URL.Query()
+	id := q.Get("id")
+	opt, err := parseExecOpt(q)
+	if err != nil {
+		s.control(&core.ExecControl{Type: core.ExecError, Message: err.Error()})
+		return
+	}
+	s.conn, err = d.rt.Exec(context.Background(), id, opt)
+	if err != nil {
+		s.control(&core.ExecControl{Type: core.ExecError, Message: err.Error()})
+		return
+	}
+	defer s.conn.Close()
+	s.rec, err = newExecRecorder(d.node.ExecRecordDir, id, opt)
+	if err != nil {
+		logrus.Errorf("exec record: %v", err)
+	}
+	defer s.rec.Close()
+	go s.input()
+	s.output()
+}
+
+//execRecorder 以asciicast v2 格式记录会话的输入输出，信号记录为标记，nil 时不记录
+type execRecorder struct {
+	mu       sync.Mutex
+	f        *os.File
+	start    time.Time
+	pending  []byte //输出末尾不完整的UTF-8 字符
+	pendingI []byte //输入末尾不完整的UTF-8 字符
+}
+
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint              `json:"width"`
+	Height    uint              `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+//newExecRecorder 录像文件名为开始时间和容器ID
+func newExecRecorder(dir, id string, opt *core.EndpointExecOpt) (*execRecorder, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	short := id
+	if len(short) > 12 {
+		short = short[:12]
+	}
+	name := fmt.Sprintf("%s-%s.cast", start.Format("20060102T150405.000000000"), short)
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	header := asciicastHeader{
+		Version:   2,
+		Width:     opt.Cols,
+		Height:    opt.Rows,
+		Timestamp: start.Unix(),
+		Command:   strings.Join(opt.Cmd, " "),
+		Title:     id,
+	}
+	if header.Width == 0 || header.Height == 0 {
+		header.Width, header.Height = 80, 24
+	}
+	if opt.User != "" {
+		header.Env = map[string]string{"USER": opt.User}
+	}
+	data, _ := json.Marshal(header)
+	_, err = f.Write(append(data, '\n'))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &execRecorder{f: f, start: start}, nil
+}
+
+func (r *execRecorder) event(code, data string) {
+	line, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), code, data})
+	_, err := r.f.Write(append(line, '\n'))
+	if err != nil {
+		logrus.Errorf("exec record: %v", err)
+	}
+}
+
+func (r *execRecorder) output(p []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stream("o", &r.pending, p)
+}
+
+func (r *execRecorder) input(p []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stream("i", &r.pendingI, p)
+}
+
+//stream 记录完整的UTF-8 字符，末尾不完整的部分留到下次
+func (r *execRecorder) stream(code string, pending *[]byte, p []byte) {
+	data := append(*pending, p...)
+	n := len(data)
+	for i := n - 1; i >= 0 && i >= n-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				n = i
+			}
+			break
+		}
+	}
+	*pending = append([]byte(nil), data[n:]...)
+	if n > 0 {
+		r.event(code, string(data[:n]))
+	}
+}
+
+func (r *execRecorder) marker(label string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("m", label)
+}
+
+func (r *execRecorder) resize(rows, cols uint) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *execRecorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.pendingI) > 0 {
+		r.event("i", string(r.pendingI))
+		r.pendingI = nil
+	}
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	return r.f.Close()
+}
@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//fakeExecConn 输出由测试写入out，输入和控制记录到ch
+type fakeExecConn struct {
+	out *io.PipeReader
+	ch  chan string
+}
+
+func (c *fakeExecConn) Read(p []byte) (int, error) { return c.out.Read(p) }
+func (c *fakeExecConn) Write(p []byte) (int, error) {
+	c.ch <- "stdin " + string(p)
+	return len(p), nil
+}
+func (c *fakeExecConn) Close() error { return nil }
+func (c *fakeExecConn) Resize(rows, cols uint) error {
+	c.ch <- fmt.Sprintf("resize %dx%d", cols, rows)
+	return nil
+}
+func (c *fakeExecConn) Signal(sig syscall.Signal) error {
+	c.ch <- fmt.Sprintf("signal %d", sig)
+	return nil
+}
+func (c *fakeExecConn) ExitCode() (int, error) { return 3, nil }
+
+func TestExec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pr, pw := io.Pipe()
+	conn := &fakeExecConn{out: pr, ch: make(chan string, 10)}
+	rt := newFakeRuntime()
+	rt.execConn = conn
+	d := newFakeDaemon(rt)
+	d.node.ExecRecordDir = dir
+	srv := httptest.NewServer(http.HandlerFunc(d.exec))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/exec?id=c1&cmd=ls&cmd=-l&env=A=1&user=root&rows=24&cols=80"
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	expect := func(s string) {
+		select {
+		case got := <-conn.ch:
+			if got != s {
+				t.Fatalf("expected %q, got %q", s, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for %q", s)
+		}
+	}
+	ws.WriteMessage(websocket.BinaryMessage, []byte("pwd\n"))
+	expect("stdin pwd\n")
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","rows":40,"cols":120}`))
+	expect("resize 120x40")
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"signal","signal":"SIGINT"}`))
+	expect("signal 2")
+	//不是控制帧的文本作为输入
+	ws.WriteMessage(websocket.TextMessage, []byte("exit\n"))
+	expect("stdin exit\n")
+	opt := rt.execOpt
+	if strings.Join(opt.Cmd, " ") != "ls -l" || opt.User != "root" || len(opt.Env) != 1 || !opt.Tty {
+		t.Fatalf("unexpected exec opt %+v", opt)
+	}
+
+	pw.Write([]byte("hello \xe4\xb8"))
+	pw.Write([]byte("\xad\n"))
+	pw.Close()
+	out := ""
+	var exit core.ExecControl
+	for {
+		mt, data, err := ws.ReadMessage()
+		if err != nil {
+			break
+		}
+		if mt == websocket.BinaryMessage {
+			out += string(data)
+			continue
+		}
+		json.Unmarshal(data, &exit)
+	}
+	if out != "hello 中\n" || exit.Type != core.ExecExit || exit.Code != 3 {
+		t.Fatalf("unexpected output %q, control %+v", out, exit)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*-c1.cast"))
+	if len(files) != 1 {
+		t.Fatalf("expected 1 record, got %v", files)
+	}
+	f, err := os.Open(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	var header asciicastHeader
+	json.Unmarshal(scanner.Bytes(), &header)
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Command != "ls -l" {
+		t.Fatalf("unexpected header %s", scanner.Text())
+	}
+	events := make([]string, 0)
+	for scanner.Scan() {
+		var e []interface{}
+		json.Unmarshal(scanner.Bytes(), &e)
+		events = append(events, e[1].(string)+" "+e[2].(string))
+	}
+	expected := []string{"i pwd\n", "r 120x40", "m signal SIGINT", "i exit\n", "o hello ", "o 中\n"}
+	if strings.Join(events, "|") != strings.Join(expected, "|") {
+		t.Fatalf("expected events %q, got %q", expected, events)
+	}
+}
+
+func TestExecContainerPid(t *testing.T) {
+	proc, err := ioutil.TempDir("", "proc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(proc)
+	dir := filepath.Join(proc, "1234")
+	os.MkdirAll(dir, 0755)
+	ioutil.WriteFile(filepath.Join(dir, "cgroup"), []byte("0::/system.slice/docker-abc123.scope\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "status"), []byte("Name:\tsh\nPid:\t1234\nNSpid:\t1234\t7\n"), 0644)
+
+	pid, err := containerPid(proc, 1234, "abc123")
+	if err != nil || pid != 7 {
+		t.Fatalf("expect pid 7 in container, got %d %v", pid, err)
+	}
+	//进程不属于该容器或不可见时不发送
+	if _, err := containerPid(proc, 1234, "def456"); err == nil {
+		t.Fatal("expect error for process of another container")
+	}
+	if _, err := containerPid(proc, 4321, "abc123"); err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Fatalf("expect unsupported error, got %v", err)
+	}
+}
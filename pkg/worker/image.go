@@ -0,0 +1,157 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+const pullProgressInterval = 5 * time.Second
+
+//pullState 端点拉取镜像的进度和失败重试状态
+type pullState struct {
+	mu       sync.Mutex
+	image    string
+	progress string
+	failed   int
+	next     time.Time //失败后下次拉取的最早时间
+	lastErr  string
+}
+
+func (p *pullState) detail() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed > 0 && time.Now().Before(p.next) {
+		return fmt.Sprintf("ImagePullBackOff: %s", p.lastErr)
+	}
+	return p.progress
+}
+
+func (d *daemon) getPullState(svc *core.ContainerService) *pullState {
+	v, _ := d.pulls.LoadOrStore(svc.Name, &pullState{image: svc.Image})
+	p := v.(*pullState)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.image != svc.Image {
+		//镜像变更，重新计算重试
+		*p = pullState{image: svc.Image}
+	}
+	return p
+}
+
+//pullBackoff 返回拉取失败后还需等待的时间
+func (d *daemon) pullBackoff(svc *core.ContainerService) time.Duration {
+	p := d.getPullState(svc)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failed == 0 {
+		return 0
+	}
+	return time.Until(p.next)
+}
+
+//pullFailed 记录拉取失败，返回重试间隔
+func (d *daemon) pullFailed(svc *core.ContainerService, err error) time.Duration {
+	p := d.getPullState(svc)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failed++
+	backoff := expBackoff(p.failed)
+	p.next = time.Now().Add(backoff)
+	p.lastErr = err.Error()
+	return backoff
+}
+
+//pullSucceeded 拉取成功后清除状态
+func (d *daemon) pullSucceeded(svc *core.ContainerService) {
+	d.pulls.Delete(svc.Name)
+}
+
+//putPullStatus 将拉取进度或退避原因写入端点状态，旧容器存在时保留其运行状态
+func (d *daemon) putPullStatus(svc *core.ContainerService) {
+	v, ok := d.pulls.Load(svc.Name)
+	//初始化容器没有端点
+	if !ok || d.getContainerSvc(svc.Name) == nil {
+		return
+	}
+	edp := d.cserviceToEndpoint(svc)
+	d.mu.Lock()
+	for _, e := range d.endpointCache {
+		if d.containerNameByEdp(e) == svc.Name {
+			meta, status := *e.ResourceMeta, *e.Status
+			edp = &core.Endpoint{
+				ResourceMeta: &meta,
+				Kind:         e.Kind,
+				Service:      e.Service,
+				Labels:       e.Labels,
+				Status:       &status,
+			}
+			break
+		}
+	}
+	d.mu.Unlock()
+	edp.Status.StateDetail = v.(*pullState).detail()
+	_, err := d.edpstore.Put(context.Background(), edp, &core.PutOptions{})
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+//imagePullAuth 未指定凭证时使用系统配置的镜像仓库凭证
+func (d *daemon) imagePullAuth(svc *core.ContainerService) string {
+	if svc.ImagePullAuth != "" || d.sysConfig == nil {
+		return svc.ImagePullAuth
+	}
+	for _, registry := range d.sysConfig.ImageRegistry {
+		if strings.HasPrefix(svc.Image, registry.Address+"/") {
+			return registryAuth(registry.Username, registry.Password)
+		}
+	}
+	return ""
+}
+
+//ImagePull 按拉取策略拉取镜像，拉取进度记录在端点状态中，并定期产生事件
+func (d *daemon) ImagePull(ctx context.Context, svc *core.ContainerService) error {
+	svc.ImagePullAuth = d.imagePullAuth(svc)
+	if svc.ImagePullPolicy == "" {
+		svc.ImagePullPolicy = core.ImagePullIfNotPresent
+	}
+	if svc.ImagePullPolicy != core.ImagePullAlways && svc.ImagePullPolicy != core.ImagePullIfNotPresent {
+		return nil
+	}
+	if svc.ImagePullPolicy == core.ImagePullIfNotPresent {
+		exist, err := d.rt.ImageExist(ctx, svc.Image)
+		if err != nil {
+			return err
+		}
+		if exist {
+			return nil
+		}
+	}
+	p := d.getPullState(svc)
+	edp := d.cserviceToEndpoint(svc)
+	var last time.Time
+	progress := func(pp PullProgress) {
+		msg := "pulling " + svc.Image
+		if pp.Total > 0 {
+			msg = fmt.Sprintf("%s: %s/%s (%d%%)", msg, units.HumanSize(float64(pp.Current)), units.HumanSize(float64(pp.Total)), pp.Current*100/pp.Total)
+		}
+		p.mu.Lock()
+		p.progress = msg
+		p.mu.Unlock()
+		if time.Since(last) < pullProgressInterval {
+			return
+		}
+		last = time.Now()
+		d.addReasonEvent(edp, core.ImagePullEventAction, core.InProgressEventStatus, core.PullingEventReason, msg)
+		d.putPullStatus(svc)
+	}
+	return d.rt.ImagePull(ctx, svc.Image, svc.ImagePullAuth, progress)
+}
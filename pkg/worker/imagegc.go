@@ -0,0 +1,180 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/go-units"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/worker/metrics"
+)
+
+const imageGCInterval = 5 * time.Minute
+
+//diskUsage 镜像所在磁盘的使用情况
+var diskUsage = disk.Usage
+
+//imageGC 定期检查磁盘使用率并回收镜像
+func (d *daemon) imageGC() {
+	if d.node.ImageGCHigh <= 0 {
+		return
+	}
+	t := time.NewTicker(imageGCInterval)
+	defer t.Stop()
+	for range t.C {
+		err := d.gcImages(context.Background())
+		if err != nil {
+			logrus.Errorf("image gc: %v", err)
+		}
+	}
+}
+
+//gcImages 磁盘使用率超过高水位时，按最近使用时间从早到晚删除未被使用的镜像，直到低于低水位
+func (d *daemon) gcImages(ctx context.Context) error {
+	imgs, err := d.rt.ImageList(ctx)
+	if err != nil {
+		return err
+	}
+	cs, err := d.rt.List(ctx)
+	if err != nil {
+		return err
+	}
+	inUse := d.imagesInUse(cs)
+	now := time.Now()
+	candidates := make([]Image, 0)
+	for _, img := range imgs {
+		if imageInUse(img, inUse) {
+			d.imageUsed.Store(img.ID, now)
+			continue
+		}
+		candidates = append(candidates, img)
+	}
+	root, err := d.rt.ImageRoot(ctx)
+	if err != nil {
+		return err
+	}
+	usage, err := diskUsage(root)
+	if err != nil {
+		return err
+	}
+	if usage.UsedPercent < float64(d.node.ImageGCHigh) {
+		return nil
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return d.imageLastUsed(candidates[i]).Before(d.imageLastUsed(candidates[j]))
+	})
+	before := usage.Used
+	removed := make([]string, 0)
+	for _, img := range candidates {
+		if usage.UsedPercent < float64(d.node.ImageGCLow) {
+			break
+		}
+		err := d.rt.ImageRemove(ctx, img.ID)
+		if err != nil {
+			logrus.Warnf("image gc: remove %s: %v", imageName(img), err)
+			continue
+		}
+		d.imageUsed.Delete(img.ID)
+		removed = append(removed, imageName(img))
+		usage, err = diskUsage(root)
+		if err != nil {
+			return err
+		}
+	}
+	var reclaimed uint64
+	if usage.Used < before {
+		reclaimed = before - usage.Used
+	}
+	metrics.ImageGCReclaimedBytes.WithLabelValues(d.node.Hostname).Add(float64(reclaimed))
+	metrics.ImageGCRemovedImages.WithLabelValues(d.node.Hostname).Add(float64(len(removed)))
+	msg := fmt.Sprintf("removed %d images, reclaimed %s", len(removed), units.HumanSize(float64(reclaimed)))
+	if len(removed) > 0 {
+		msg += ": " + strings.Join(removed, ", ")
+	}
+	if usage.UsedPercent >= float64(d.node.ImageGCLow) {
+		msg = fmt.Sprintf("disk usage %.1f%% is still above %d%%, %s", usage.UsedPercent, d.node.ImageGCLow, msg)
+		d.addEvent(d.nodeResource(), core.ImageGCEventAction, core.FailEventStatus, msg)
+		return nil
+	}
+	d.addEvent(d.nodeResource(), core.ImageGCEventAction, core.SuccessEventStatus, msg)
+	return nil
+}
+
+//imagesInUse oars 创建的容器及本节点服务使用的镜像
+func (d *daemon) imagesInUse(cs []Container) map[string]bool {
+	inUse := make(map[string]bool)
+	for _, c := range cs {
+		if c.Labels[core.CreatorLabelKey] != "oars" {
+			continue
+		}
+		inUse[normalizeImage(c.Image)] = true
+		if c.ImageID != "" {
+			inUse[c.ImageID] = true
+		}
+	}
+	//尚未创建容器的服务
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		inUse[normalizeImage(svc.Image)] = true
+		for _, init := range svc.InitContainers {
+			inUse[normalizeImage(init.Image)] = true
+		}
+		return true
+	})
+	return inUse
+}
+
+func imageInUse(img Image, inUse map[string]bool) bool {
+	if inUse[img.ID] {
+		return true
+	}
+	for _, tag := range img.RepoTags {
+		if inUse[normalizeImage(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+//imageLastUsed worker 启动后未见过使用的镜像按创建时间排序
+func (d *daemon) imageLastUsed(img Image) time.Time {
+	if v, ok := d.imageUsed.Load(img.ID); ok {
+		return v.(time.Time)
+	}
+	return img.Created
+}
+
+func normalizeImage(image string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return image
+	}
+	return reference.TagNameOnly(named).String()
+}
+
+func imageName(img Image) string {
+	for _, tag := range img.RepoTags {
+		if tag != "<none>:<none>" {
+			return tag
+		}
+	}
+	return img.ID
+}
+
+//nodeResource 本节点，用于节点级事件
+func (d *daemon) nodeResource() *core.Endpoint {
+	return &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Name:      d.node.Hostname,
+			Namespace: "system",
+		},
+		Service: "node",
+	}
+}
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestGCImages(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	d.node.ImageGCHigh = 70
+	d.node.ImageGCLow = 60
+	//每个镜像占用100 字节，磁盘共500 字节
+	diskUsage = func(path string) (*disk.UsageStat, error) {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		used := uint64(100 * len(rt.images))
+		return &disk.UsageStat{Total: 500, Used: used, UsedPercent: float64(used) * 100 / 500}, nil
+	}
+	defer func() { diskUsage = disk.Usage }()
+	now := time.Now()
+	for i, image := range []string{"web:v1", "old:v1", "older:v1", "new:v1"} {
+		rt.images[image] = true
+		rt.created[image] = now.Add(-time.Duration(i) * time.Hour)
+	}
+	rt.created["new:v1"] = now
+	_, err := rt.Create(context.Background(), &ContainerSpec{ContainerService: &core.ContainerService{
+		Name:   "oars_default_web_web-0",
+		Image:  "web:v1",
+		Labels: map[string]string{core.CreatorLabelKey: "oars"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.gcImages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//80% 超过高水位，删除最早使用的两个镜像后低于低水位
+	if rt.images["older:v1"] || rt.images["old:v1"] {
+		t.Fatalf("expect least recently used images removed, got %v", rt.images)
+	}
+	if !rt.images["web:v1"] || !rt.images["new:v1"] {
+		t.Fatalf("expect used and recent images kept, got %v", rt.images)
+	}
+	//低于高水位，不回收
+	err = d.gcImages(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rt.images["new:v1"] {
+		t.Fatal("expect no gc below high threshold")
+	}
+}
@@ -0,0 +1,84 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+const initContainerTimeout = 10 * time.Minute
+
+//runInitContainers 依次运行初始化容器，全部成功退出后返回
+func (d *daemon) runInitContainers(ctx context.Context, svc *core.ContainerService, edp *core.Endpoint, env []string) error {
+	for i := range svc.InitContainers {
+		init := svc.InitContainers[i]
+		init.Name = fmt.Sprintf("%s_init-%d", svc.Name, i)
+		init.Environment = append(append([]string{}, init.Environment...), env...)
+		if init.NetworkMode == "" {
+			init.NetworkMode = svc.NetworkMode
+		}
+		err := d.runInitContainer(ctx, &init, edp)
+		if err != nil {
+			d.addEvent(edp, core.InitEventAction, core.FailEventStatus, err.Error())
+			return err
+		}
+	}
+	if len(svc.InitContainers) > 0 {
+		d.addEvent(edp, core.InitEventAction, core.SuccessEventStatus, "")
+	}
+	return nil
+}
+
+//runInitContainer 运行初始化容器并等待退出，不带creator 标签，不会被当作端点
+func (d *daemon) runInitContainer(ctx context.Context, init *core.ContainerService, edp *core.Endpoint) error {
+	//清理上次残留的容器
+	err := d.rt.Remove(ctx, init.Name)
+	if err != nil && !d.rt.IsNotFound(err) {
+		return err
+	}
+	err = d.ImagePull(ctx, init)
+	if err != nil {
+		return fmt.Errorf("init container %s: %v", init.Name, err)
+	}
+	mounts, err := d.volumeMounts(edp, init.Volumes)
+	if err != nil {
+		return err
+	}
+	init.Restart = "no"
+	if init.Resources == nil {
+		init.Resources = new(core.ContainerResource)
+	}
+	id, err := d.rt.Create(ctx, &ContainerSpec{
+		ContainerService: init,
+		Mounts:           mounts,
+		DNS:              []string{d.node.IP},
+	})
+	if err != nil {
+		return fmt.Errorf("init container %s: %v", init.Name, err)
+	}
+	defer d.rt.Remove(context.Background(), id)
+	d.addEvent(edp, core.InitEventAction, core.InProgressEventStatus, "running "+init.Name)
+	err = d.rt.Start(ctx, id)
+	if err != nil {
+		return fmt.Errorf("init container %s: %v", init.Name, err)
+	}
+	deadline := time.Now().Add(initContainerTimeout)
+	for {
+		state, err := d.rt.Inspect(ctx, id)
+		if err != nil {
+			return fmt.Errorf("init container %s: %v", init.Name, err)
+		}
+		if state.Status == "exited" || state.Status == "dead" {
+			if state.ExitCode != 0 {
+				return fmt.Errorf("init container %s exited with code %d\n%s", init.Name, state.ExitCode, d.jobLog(ctx, id))
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("init container %s did not finish in %s", init.Name, initContainerTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
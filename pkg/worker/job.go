@@ -0,0 +1,271 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+const jobLogTail = "50"
+
+//jobState 任务端点的运行状态
+type jobState struct {
+	mu       sync.Mutex
+	hash     string
+	status   core.JobStatus
+	pending  bool            //需要创建容器运行
+	next     time.Time       //失败重试的最早时间
+	schedule cron.Schedule   //定时任务的调度
+	nextRun  time.Time       //下次定时运行时间
+	recorded map[string]bool //已记录退出的容器
+}
+
+//isJob 是否为任务或定时任务
+func isJob(svc *core.ContainerService) bool {
+	return svc.Kind == core.JobServiceKind || svc.Kind == core.CronJobServiceKind
+}
+
+//getJobState 获取任务状态，配置变更后重新开始
+func (d *daemon) getJobState(svc *core.ContainerService) *jobState {
+	hash := svc.Labels[core.HashLabelKey]
+	if v, ok := d.jobs.Load(svc.Name); ok && v.(*jobState).hash == hash {
+		return v.(*jobState)
+	}
+	now := time.Now()
+	st := &jobState{
+		hash:     hash,
+		recorded: make(map[string]bool),
+		status:   core.JobStatus{Phase: core.JobPending},
+	}
+	if svc.Kind == core.CronJobServiceKind {
+		//未经admin 校验直接写入存储的服务可能缺少cronJob
+		err := errors.New("cronJob is required")
+		if svc.CronJob != nil {
+			st.schedule, err = cron.ParseStandard(svc.CronJob.Schedule)
+		}
+		if err != nil {
+			logrus.Errorf("cronjob %s: %v", svc.Name, err)
+			d.addEvent(d.cserviceToEndpoint(svc), core.JobEventAction, core.FailEventStatus, err.Error())
+		} else {
+			st.nextRun = st.schedule.Next(now)
+		}
+	} else {
+		st.pending = true
+		st.status.StartTime = now.Unix()
+	}
+	d.restoreJobState(svc, st)
+	if v, loaded := d.jobs.LoadOrStore(svc.Name, st); loaded {
+		if v.(*jobState).hash == hash {
+			return v.(*jobState)
+		}
+		d.jobs.Store(svc.Name, st)
+	}
+	return st
+}
+
+//restoreJobState worker 重启后从已上报的端点状态恢复
+func (d *daemon) restoreJobState(svc *core.ContainerService, st *jobState) {
+	if d.nodeEdpLister == nil {
+		return
+	}
+	ress, ok := d.nodeEdpLister.List()
+	if !ok {
+		return
+	}
+	for _, res := range ress {
+		edp := res.(*core.Endpoint)
+		if d.containerNameByEdp(edp) != svc.Name || edp.Labels[core.HashLabelKey] != st.hash ||
+			edp.Status == nil || edp.Status.Job == nil {
+			continue
+		}
+		st.status = *edp.Status.Job
+		switch st.status.Phase {
+		case core.JobComplete, core.JobFailed:
+			st.pending = false
+			if edp.Status.ID != "" {
+				st.recorded[edp.Status.ID] = true
+			}
+		case core.JobRunning:
+			st.pending = true
+		}
+		return
+	}
+}
+
+//jobPending 任务是否需要创建容器，非任务服务总是需要
+func (d *daemon) jobPending(svc *core.ContainerService) bool {
+	if !isJob(svc) {
+		return true
+	}
+	st := d.getJobState(svc)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.pending && !time.Now().Before(st.next)
+}
+
+//syncJobs 根据容器退出情况推进任务状态
+func (d *daemon) syncJobs(edps map[string]*core.Endpoint) {
+	now := time.Now()
+	active := make(map[string]bool)
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		if !isJob(svc) {
+			return true
+		}
+		active[svc.Name] = true
+		var edp *core.Endpoint
+		for _, e := range edps {
+			if d.containerNameByEdp(e) == svc.Name {
+				edp = e
+				break
+			}
+		}
+		d.syncJob(svc, d.getJobState(svc), edp, now)
+		return true
+	})
+	d.jobs.Range(func(k, v interface{}) bool {
+		if !active[k.(string)] {
+			d.jobs.Delete(k)
+		}
+		return true
+	})
+}
+
+func (d *daemon) syncJob(svc *core.ContainerService, st *jobState, edp *core.Endpoint, now time.Time) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	ctx := context.Background()
+	event := d.cserviceToEndpoint(svc)
+
+	//定时触发
+	if svc.Kind == core.CronJobServiceKind && st.schedule != nil && !now.Before(st.nextRun) {
+		st.nextRun = st.schedule.Next(now)
+		switch {
+		case svc.CronJob.Suspend:
+		case edp != nil && edp.Status.State == "running":
+			d.addEvent(event, core.JobEventAction, core.FailEventStatus, "previous run is still active, skip schedule")
+		default:
+			st.status = core.JobStatus{Phase: core.JobPending, StartTime: now.Unix(), LastScheduleTime: now.Unix()}
+			st.pending = true
+			st.next = time.Time{}
+			if edp != nil {
+				d.removeJobContainer(ctx, edp)
+			}
+			d.addEvent(event, core.JobEventAction, core.InProgressEventStatus, "scheduled at "+now.Format(time.RFC3339))
+			return
+		}
+	}
+	if edp == nil || edp.Status.ID == "" || edp.Labels[core.HashLabelKey] != st.hash {
+		return
+	}
+	id := edp.Status.ID
+	switch edp.Status.State {
+	case "running", "restarting":
+		if !st.pending {
+			return
+		}
+		st.status.Phase = core.JobRunning
+		if svc.Job == nil || svc.Job.ActiveDeadlineSeconds <= 0 || st.status.StartTime == 0 {
+			return
+		}
+		if now.Unix()-st.status.StartTime <= svc.Job.ActiveDeadlineSeconds {
+			return
+		}
+		err := d.rt.Stop(ctx, id, defaultStopTimeout)
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+		st.recorded[id] = true
+		st.pending = false
+		st.status.Phase = core.JobFailed
+		st.status.Reason = "DeadlineExceeded"
+		st.status.CompletionTime = now.Unix()
+		d.addEvent(event, core.JobEventAction, core.FailEventStatus,
+			fmt.Sprintf("job exceeded active deadline %ds\n%s", svc.Job.ActiveDeadlineSeconds, d.jobLog(ctx, id)))
+	case "exited", "dead":
+		if st.recorded[id] || !st.pending {
+			return
+		}
+		state, err := d.rt.Inspect(ctx, id)
+		if err != nil {
+			logrus.Error(err)
+			return
+		}
+		st.recorded[id] = true
+		st.status.LastExitCode = state.ExitCode
+		logs := d.jobLog(ctx, id)
+		completions := svc.Job.GetCompletions()
+		if state.ExitCode == 0 {
+			st.status.Succeeded++
+			if st.status.Succeeded >= completions {
+				st.pending = false
+				st.status.Phase = core.JobComplete
+				st.status.CompletionTime = now.Unix()
+				d.addEvent(event, core.JobEventAction, core.SuccessEventStatus,
+					fmt.Sprintf("job completed (%d/%d), exit code 0\n%s", st.status.Succeeded, completions, logs))
+				return
+			}
+			d.addEvent(event, core.JobEventAction, core.InProgressEventStatus,
+				fmt.Sprintf("run succeeded (%d/%d), exit code 0\n%s", st.status.Succeeded, completions, logs))
+		} else {
+			st.status.Failed++
+			if st.status.Failed > svc.Job.GetBackoffLimit() {
+				st.pending = false
+				st.status.Phase = core.JobFailed
+				st.status.Reason = "BackoffLimitExceeded"
+				st.status.CompletionTime = now.Unix()
+				d.addEvent(event, core.JobEventAction, core.FailEventStatus,
+					fmt.Sprintf("job failed after %d attempts, exit code %d\n%s", st.status.Failed, state.ExitCode, logs))
+				return
+			}
+			backoff := expBackoff(st.status.Failed)
+			st.next = now.Add(backoff)
+			d.addEvent(event, core.JobEventAction, core.FailEventStatus,
+				fmt.Sprintf("run failed (%d/%d), exit code %d, retry in %s\n%s", st.status.Failed, svc.Job.GetBackoffLimit(), state.ExitCode, backoff, logs))
+		}
+		st.status.Phase = core.JobPending
+		//删除容器，由syncContainer 创建下一次运行
+		d.removeJobContainer(ctx, edp)
+	}
+}
+
+func (d *daemon) removeJobContainer(ctx context.Context, edp *core.Endpoint) {
+	err := d.rt.Remove(ctx, edp.Status.ID)
+	if err != nil && !d.rt.IsNotFound(err) {
+		logrus.Error(err)
+	}
+}
+
+//jobLog 容器最后的日志
+func (d *daemon) jobLog(ctx context.Context, id string) string {
+	l, err := d.rt.Log(ctx, id, jobLogTail, "")
+	if err != nil {
+		return err.Error()
+	}
+	return strings.TrimSpace(l)
+}
+
+//setJobStatus 设置端点的任务状态
+func (d *daemon) setJobStatus(edp *core.Endpoint) {
+	v, ok := d.jobs.Load(d.containerNameByEdp(edp))
+	if !ok {
+		return
+	}
+	st := v.(*jobState)
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if edp.Labels[core.HashLabelKey] != "" && edp.Labels[core.HashLabelKey] != st.hash {
+		return
+	}
+	status := st.status
+	edp.Status.Job = &status
+}
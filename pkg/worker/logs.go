@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//logLineWriter 将日志流按行拆分，行首为运行时加的时间戳
+type logLineWriter struct {
+	stream string
+	buf    []byte
+	out    func(*core.EndpointLogLine) error
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		err := w.emit(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+//Flush 输出最后不完整的一行
+func (w *logLineWriter) Flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	line := string(w.buf)
+	w.buf = nil
+	return w.emit(line)
+}
+
+func (w *logLineWriter) emit(line string) error {
+	ts, msg := "", line
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if _, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			ts, msg = line[:i], line[i+1:]
+		}
+	}
+	return w.out(&core.EndpointLogLine{Stream: w.stream, Time: ts, Log: strings.TrimSuffix(msg, "\r")})
+}
+
+//syncLogOut stdout 和stderr 并发写入时串行输出
+func syncLogOut(out func(*core.EndpointLogLine) error) func(*core.EndpointLogLine) error {
+	var mu sync.Mutex
+	return func(l *core.EndpointLogLine) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return out(l)
+	}
+}
+
+//logs 以SSE 输出容器日志，每行为一个EndpointLogLine，总是带时间戳以便合并
+func (d *daemon) logs(w http.ResponseWriter, r *http.Request) {
+	opt := &core.EndpointLogOpt{
+		ID:     r.FormValue("id"),
+		Tail:   r.FormValue("tail"),
+		Since:  r.FormValue("since"),
+		Until:  r.FormValue("until"),
+		Follow: r.FormValue("follow") == "true",
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	err := d.rt.LogStream(r.Context(), opt.ID, opt, func(l *core.EndpointLogLine) error {
+		data, _ := json.Marshal(l)
+		_, err := fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return err
+	})
+	if err != nil && r.Context().Err() == nil {
+		fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.Replace(err.Error(), "\n", " ", -1))
+	}
+}
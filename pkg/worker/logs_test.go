@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestLogLineWriter(t *testing.T) {
+	lines := make([]*core.EndpointLogLine, 0)
+	w := &logLineWriter{stream: "stderr", out: func(l *core.EndpointLogLine) error {
+		lines = append(lines, l)
+		return nil
+	}}
+	w.Write([]byte("2021-06-01T10:00:00.000000001Z hello "))
+	w.Write([]byte("world\n2021-06-01T10:00:01Z second\r\nno timestamp"))
+	w.Flush()
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, got %d", len(lines))
+	}
+	if lines[0].Time != "2021-06-01T10:00:00.000000001Z" || lines[0].Log != "hello world" || lines[0].Stream != "stderr" {
+		t.Fatalf("unexpected line %+v", lines[0])
+	}
+	if lines[1].Log != "second" {
+		t.Fatalf("unexpected line %+v", lines[1])
+	}
+	if lines[2].Time != "" || lines[2].Log != "no timestamp" {
+		t.Fatalf("unexpected line %+v", lines[2])
+	}
+}
@@ -24,7 +24,7 @@ type lvs struct {
 	edpLister  core.ResourceLister
 }
 
-func startLVS(svcLister, edpLister core.ResourceLister) error {
+func startLVS(svcLister, edpLister core.ResourceLister, svcTrigger, edpTrigger <-chan struct{}) error {
 	links, err := netlink.LinkList()
 	if err != nil {
 		return err
@@ -58,20 +58,23 @@ func startLVS(svcLister, edpLister core.ResourceLister) error {
 		edpLister:  edpLister,
 		ipvsClient: ipvsClient,
 	}
-	go l.start()
+	go l.start(svcTrigger, edpTrigger)
 	return nil
 
 }
 
-func (l *lvs) start() {
-	t := time.NewTicker(time.Second * 30)
+//start 服务或端点变化时同步ipvs，定时全量同步兜底
+func (l *lvs) start(svcTrigger, edpTrigger <-chan struct{}) {
+	t := time.NewTicker(resyncPeriod)
 	for {
 		select {
+		case <-svcTrigger:
+		case <-edpTrigger:
 		case <-t.C:
-			err := l.syncService()
-			if err != nil {
-				logrus.Error(err)
-			}
+		}
+		err := l.syncService()
+		if err != nil {
+			logrus.Error(err)
 		}
 	}
 }
@@ -113,14 +116,7 @@ func (l *lvs) syncService() error {
 			}
 		}
 
-		dstIPs := make([]string, 0)
-		for _, res := range edpRess {
-			edp := res.(*core.Endpoint)
-			if edp.Service == svc.Name && edp.Status.State == "running" {
-				dstIPs = append(dstIPs, edp.Status.IP)
-			}
-		}
-		l.addService(svc.VirtualServer, dstIPs, ipvsSvcs)
+		l.addService(svc.VirtualServer, readyEndpointIPs(edpRess, svc), ipvsSvcs)
 	}
 
 	//gc lvs servers
@@ -335,7 +331,7 @@ func reconcileRouters(link string, nodes []core.Node, dstRange string) (err erro
 		logrus.Info("delete route ", r)
 		_, cidr, _ := net.ParseCIDR(r)
 		if err = netlink.RouteDel(&netlink.Route{Dst: cidr}); err != nil {
-			logrus.Error("failed to del route %v", err)
+			logrus.Errorf("failed to del route %v", err)
 		}
 	}
 
@@ -344,7 +340,7 @@ func reconcileRouters(link string, nodes []core.Node, dstRange string) (err erro
 		_, cidr, _ := net.ParseCIDR(r.ContainerCIDR)
 		gw := net.ParseIP(r.IP)
 		if err = netlink.RouteReplace(&netlink.Route{Dst: cidr, LinkIndex: nic.Attrs().Index, Scope: netlink.SCOPE_UNIVERSE, Gw: gw}); err != nil {
-			logrus.Error("failed to add route %v", err)
+			logrus.Errorf("failed to add route %v", err)
 		}
 	}
 
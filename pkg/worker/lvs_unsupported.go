@@ -6,7 +6,7 @@ import (
 	"github.com/oars-sigs/oars-cloud/core"
 )
 
-func startLVS(svcLister, edpLister core.ResourceLister) error {
+func startLVS(svcLister, edpLister core.ResourceLister, svcTrigger, edpTrigger <-chan struct{}) error {
 	return nil
 }
 
@@ -1,30 +1,49 @@
 package metrics
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
-	"github.com/docker/docker/client"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/oars-sigs/oars-cloud/core"
 )
 
+//Source 运行中容器的资源统计，由容器运行时提供
+type Source interface {
+	Stats(ctx context.Context) ([]*ContainerMetrics, error)
+}
+
 // Exporter Sets up all the runtime and metrics
 type Exporter struct {
 	containerMetrics map[string]*prometheus.Desc
 	node             core.NodeConfig
-	c                *client.Client
+	src              Source
 }
 
-func Start(c *client.Client, node core.NodeConfig) {
+var (
+	//ImageGCReclaimedBytes 镜像回收释放的磁盘空间
+	ImageGCReclaimedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_image_gc_reclaimed_bytes_total",
+		Help: "Disk bytes reclaimed by image garbage collection on the specified node",
+	}, []string{"hostname"})
+	//ImageGCRemovedImages 镜像回收删除的镜像数
+	ImageGCRemovedImages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "node_image_gc_removed_images_total",
+		Help: "Images removed by image garbage collection on the specified node",
+	}, []string{"hostname"})
+)
+
+//Start 输出节点和容器指标，容器指标来自src
+func Start(src Source, node core.NodeConfig) {
 	exporter := Exporter{
 		containerMetrics: Return(),
 		node:             node,
-		c:                c,
+		src:              src,
 	}
-	prometheus.MustRegister(&exporter)
+	prometheus.MustRegister(&exporter, ImageGCReclaimedBytes, ImageGCRemovedImages)
 	http.Handle("/metrics", promhttp.Handler())
 	http.ListenAndServe(fmt.Sprintf(":%d", node.MetricsPort), nil)
 }
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"context"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -18,16 +19,11 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect function, called on by Prometheus Client library
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
-	go e.setNodeMetrics(ch)
-
-	metrics, err := e.asyncRetrieveMetrics()
+	e.setNodeMetrics(ch)
 
+	metrics, err := e.src.Stats(context.Background())
 	if err != nil {
-		logrus.Error("Errors in collection")
-	}
-
-	if len(metrics) == 0 {
-		logrus.Info("No valid container metrics to process")
+		logrus.Errorf("collect container metrics: %v", err)
 		return
 	}
 
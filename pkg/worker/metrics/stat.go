@@ -1,7 +1,6 @@
 package metrics
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 
@@ -51,83 +50,49 @@ type ContainerMetrics struct {
 	} `json:"precpu_stats"`
 }
 
-func (e *Exporter) asyncRetrieveMetrics() ([]*ContainerMetrics, error) {
+//DockerStats 通过docker stats 获取运行中容器的资源统计
+func DockerStats(ctx context.Context, cli *client.Client) ([]*ContainerMetrics, error) {
 	// Obtain a list of running containers only
 	// Docker stats API won't return stats for containers not in the running state
-	containers, err := e.c.ContainerList(context.Background(), types.ContainerListOptions{All: false})
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: false})
 	if err != nil {
-		logrus.Errorf("Error obtaining container listing: %v", err)
 		return nil, err
 	}
 
 	// Channels used to enable concurrent requests
 	ch := make(chan *ContainerMetrics, len(containers))
-	ContainerMetrics := []*ContainerMetrics{}
-
-	// Check that there are indeed containers running we can obtain stats for
-	if len(containers) == 0 {
-		logrus.Errorf("No Containers returnedx from Docker socket, error: %v", err)
-		return ContainerMetrics, err
-
-	}
-
-	// range through the returned containers to obtain the statistics
-	// Done due to there not yet being a '--all' option for the cli.ContainerMetrics function in the engine
 	for _, c := range containers {
-
-		go func(cli *client.Client, id, name string) {
-			retrieveContainerMetrics(*cli, id, name, ch)
-
-		}(e.c, c.ID, c.Names[0][1:])
-
+		go retrieveContainerMetrics(ctx, cli, c.ID, c.Names[0][1:], ch)
 	}
-
-	for {
-		select {
-		case r := <-ch:
-
-			ContainerMetrics = append(ContainerMetrics, r)
-
-			if len(ContainerMetrics) == len(containers) {
-				return ContainerMetrics, nil
-			}
+	res := make([]*ContainerMetrics, 0, len(containers))
+	for range containers {
+		//获取失败的容器返回nil
+		if m := <-ch; m != nil {
+			res = append(res, m)
 		}
-
 	}
-
+	return res, nil
 }
 
-func retrieveContainerMetrics(cli client.Client, id, name string, ch chan<- *ContainerMetrics) {
-
-	stats, err := cli.ContainerStats(context.Background(), id, false)
+func retrieveContainerMetrics(ctx context.Context, cli *client.Client, id, name string, ch chan<- *ContainerMetrics) {
+	stats, err := cli.ContainerStats(ctx, id, false)
 	if err != nil {
 		logrus.Errorf("Error obtaining container stats for %s, error: %v", id, err)
+		ch <- nil
 		return
 	}
+	defer stats.Body.Close()
 
-	s := bufio.NewScanner(stats.Body)
-
-	for s.Scan() {
-
-		var c *ContainerMetrics
-
-		err := json.Unmarshal(s.Bytes(), &c)
-		if err != nil {
-			logrus.Errorf("Could not unmarshal the response from the docker engine for container %s. Error: %v", id, err)
-			continue
-		}
-
-		// Set the container name and ID fields of the ContainerMetrics struct
-		// so we can correctly report on the container when looping through later
-		c.ID = id
-		c.Name = name
-
-		ch <- c
-	}
-
-	if s.Err() != nil {
-		logrus.Errorf("Error handling Stats.body from Docker engine. Error: %v", s.Err())
+	var c *ContainerMetrics
+	err = json.NewDecoder(stats.Body).Decode(&c)
+	if err != nil || c == nil {
+		logrus.Errorf("Could not unmarshal the response from the docker engine for container %s. Error: %v", id, err)
+		ch <- nil
 		return
 	}
-
+	// Set the container name and ID fields of the ContainerMetrics struct
+	// so we can correctly report on the container when looping through later
+	c.ID = id
+	c.Name = name
+	ch <- c
 }
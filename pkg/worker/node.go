@@ -14,6 +14,50 @@ import (
 
 func (d *daemon) initNode() error {
 	d.configNodeInfo()
+	err := d.initNetwork()
+	if err != nil {
+		return err
+	}
+	go d.registerNode()
+	return nil
+}
+
+//registerRetryDelay 注册节点失败的重试间隔
+var registerRetryDelay = retryDelay
+
+//registerNode 注册节点端点，存储不可用时持续重试，租约失效(如存储长时间不可用)后重新注册
+func (d *daemon) registerNode() {
+	for {
+		err := d.putNode()
+		if err != nil {
+			logrus.Errorf("register node: %v, retry in %s", err, registerRetryDelay)
+			select {
+			case <-time.After(registerRetryDelay):
+			case <-d.stopCh:
+				return
+			}
+			continue
+		}
+		d.mu.Lock()
+		reg := d.nodeReg
+		d.mu.Unlock()
+		if reg == nil {
+			return
+		}
+		select {
+		case <-reg.Done():
+			//退出时撤销租约
+			if d.stopping() {
+				return
+			}
+			logrus.Warn("node registration lease lost, registering again")
+		case <-d.stopCh:
+			return
+		}
+	}
+}
+
+func (d *daemon) putNode() error {
 	nodeInfo, err := metrics.GetNodeInfo()
 	if err != nil {
 		return err
@@ -25,6 +69,7 @@ func (d *daemon) initNode() error {
 		},
 		Kind:    "runtime",
 		Service: "node",
+		Labels:  d.nodeLabels(),
 		Status: &core.EndpointStatus{
 			ID:       d.node.Hostname,
 			Port:     d.node.Port,
@@ -39,6 +84,13 @@ func (d *daemon) initNode() error {
 			},
 		},
 	}
+	if old, err := d.edpstore.Get(context.Background(), endpoint, &core.GetOptions{}); err == nil {
+		//保留cordon 和排空状态
+		if old.(*core.Endpoint).Name == endpoint.Name {
+			endpoint.Unschedulable = old.(*core.Endpoint).Unschedulable
+			endpoint.Drain = old.(*core.Endpoint).Drain
+		}
+	}
 	_, err = d.edpstore.Put(context.Background(), endpoint, &core.PutOptions{})
 	if err != nil {
 		return err
@@ -46,69 +98,115 @@ func (d *daemon) initNode() error {
 	endpoint.ResourceMeta.ObjectKind = &core.ResourceObjectKind{
 		IsRegister: true,
 	}
-	_, err = resStore.NewRegister(d.store, endpoint, 10)
+	reg, err := resStore.NewRegister(d.store, endpoint, 10)
 	if err != nil {
 		return err
 	}
-	if d.node.ContainerCIDR != "" {
-		//config network
-		go d.configNetwork()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopping() {
+		return reg.Close()
+	}
+	d.nodeReg = reg
+	return nil
+}
 
-		ns, err := d.ListNetworks()
-		if err != nil {
-			return err
-		}
-		for _, n := range ns {
-			if n == d.node.ContainerNetwork {
-				return nil
-			}
-		}
-		err = d.CreateNetwork(d.node.ContainerNetwork, "bridge", d.node.ContainerCIDR)
-		if err != nil {
-			return err
+//initNetwork 创建容器网络，不依赖存储
+func (d *daemon) initNetwork() error {
+	if d.node.ContainerCIDR == "" {
+		return nil
+	}
+	//config network
+	go d.configNetwork(d.edpEvents.subscribe())
+
+	ns, err := d.rt.ListNetworks(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, n := range ns {
+		if n == d.node.ContainerNetwork {
+			return nil
 		}
+	}
+	return d.rt.CreateNetwork(context.Background(), d.node.ContainerNetwork, "bridge", d.node.ContainerCIDR)
+}
+
+//nodeLabels 节点标签，包含主机名标签
+func (d *daemon) nodeLabels() map[string]string {
+	labels := make(map[string]string)
+	for k, v := range d.node.Labels {
+		labels[k] = v
+	}
+	labels[core.HostnameLabelKey] = d.node.Hostname
+	return labels
+}
+
+//placement 端点所在节点不满足服务的调度条件
+type placement struct {
+	reason   string
+	reported bool
+}
 
+func (d *daemon) setMisplaced(name, reason string) {
+	if v, ok := d.misplaced.Load(name); ok && v.(*placement).reason == reason {
+		return
 	}
-	return err
+	d.misplaced.Store(name, &placement{reason: reason})
 }
 
-func (d *daemon) configNetwork() {
-	t := time.NewTicker(time.Second * 30)
+//reportMisplaced 保留已有容器，不再创建新容器，原因变化时产生一次事件
+func (d *daemon) reportMisplaced(svc *core.ContainerService, edp *core.Endpoint, p *placement) {
+	if p.reported {
+		return
+	}
+	p.reported = true
+	msg := "node no longer matches service placement: " + p.reason
+	if edp == nil {
+		edp = d.cserviceToEndpoint(svc)
+		msg += ", container not created"
+	} else {
+		msg += ", keeping existing container until drained"
+	}
+	logrus.Warnf("%s %s", svc.Name, msg)
+	d.addEvent(edp, core.ScheduleEventAction, core.FailEventStatus, msg)
+}
+
+//configNetwork 节点端点变化时同步到其他节点容器网段的路由
+func (d *daemon) configNetwork(trigger <-chan struct{}) {
+	t := time.NewTicker(resyncPeriod)
 	for {
 		select {
+		case <-trigger:
 		case <-t.C:
-			ress, ok := d.edpLister.List()
-			if !ok {
-				continue
-			}
-			cidrs := make([]core.Node, 0)
-			for _, res := range ress {
-				edp := res.(*core.Endpoint)
-				if edp.Service == "node" && edp.Namespace == "system" &&
-					edp.Name != d.node.Hostname && edp.Status.Node.ContainerCIDR != "" {
-					cidrs = append(cidrs, edp.Status.Node)
-				}
-			}
-			err := reconcileRouters(d.node.Interface, cidrs, d.node.ContainerRangeCIDR)
-			if err != nil {
-				logrus.Error(err)
+		}
+		ress, ok := d.edpLister.List()
+		if !ok {
+			continue
+		}
+		cidrs := make([]core.Node, 0)
+		for _, res := range ress {
+			edp := res.(*core.Endpoint)
+			if edp.Service == "node" && edp.Namespace == "system" &&
+				edp.Name != d.node.Hostname && edp.Status.Node.ContainerCIDR != "" {
+				cidrs = append(cidrs, edp.Status.Node)
 			}
 		}
+		err := reconcileRouters(d.node.Interface, cidrs, d.node.ContainerRangeCIDR)
+		if err != nil {
+			logrus.Error(err)
+		}
 	}
 }
 
 func (d *daemon) addEvent(r core.Resource, action, status, msg string) {
-	d.delEvent(r, action, status)
-	event := d.convEvent(r, action, status, msg)
-	_, err := d.eventstore.Put(context.Background(), event, &core.PutOptions{})
-	if err != nil {
-		logrus.Error(err)
-	}
+	d.addReasonEvent(r, action, status, "", msg)
 }
 
-func (d *daemon) delEvent(r core.Resource, action, status string) {
-	event := d.convEvent(r, action, status, "")
-	err := d.eventstore.Delete(context.Background(), event, &core.DeleteOptions{})
+//addReasonEvent 相同原因的事件合并为一条，消息为最后一次的内容
+func (d *daemon) addReasonEvent(r core.Resource, action, status, reason, msg string) {
+	event := d.convEvent(r, action, status, msg)
+	event.Reason = reason
+	err := resStore.RecordEvent(context.Background(), d.eventstore, event)
 	if err != nil {
 		logrus.Error(err)
 	}
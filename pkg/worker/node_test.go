@@ -0,0 +1,99 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//regKV 注册租约的kv，down 时模拟存储不可用
+type regKV struct {
+	core.KVStore
+	mu   sync.Mutex
+	down bool
+	regs chan *fakeRegister
+}
+
+func (s *regKV) Register(ctx context.Context, kv core.KV, lease int64) (core.KVRegister, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return nil, errors.New("etcdserver: request timed out")
+	}
+	r := &fakeRegister{done: make(chan struct{})}
+	s.regs <- r
+	return r, nil
+}
+
+func (s *regKV) setDown(down bool) {
+	s.mu.Lock()
+	s.down = down
+	s.mu.Unlock()
+}
+
+func TestRegisterNodeLeaseLost(t *testing.T) {
+	registerRetryDelay = 10 * time.Millisecond
+	d := newFakeDaemon(newFakeRuntime())
+	kv := &regKV{regs: make(chan *fakeRegister, 10)}
+	store := &recordStore{res: make(map[string]core.Resource)}
+	d.store = kv
+	d.edpstore = store
+	d.stopCh = make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		d.registerNode()
+		close(done)
+	}()
+	wait := func() *fakeRegister {
+		select {
+		case r := <-kv.regs:
+			return r
+		case <-time.After(5 * time.Second):
+			t.Fatal("node not registered")
+		}
+		return nil
+	}
+	first := wait()
+
+	//存储不可用期间租约过期，恢复后重新注册
+	kv.setDown(true)
+	store.mu.Lock()
+	delete(store.res, "namespaces/system/node/node1")
+	store.mu.Unlock()
+	close(first.done)
+	time.Sleep(50 * time.Millisecond)
+	kv.setDown(false)
+	second := wait()
+	if store.get("namespaces/system/node/node1") == nil {
+		t.Fatal("node endpoint not written again after lease lost")
+	}
+	recorded := func() bool {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		return d.nodeReg != nil && d.nodeReg.Done() == (<-chan struct{})(second.done)
+	}
+	for deadline := time.Now().Add(2 * time.Second); !recorded() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !recorded() {
+		t.Fatal("new lease not recorded")
+	}
+
+	//退出时撤销租约后不再注册
+	close(d.stopCh)
+	close(second.done)
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("registerNode did not return after stop")
+	}
+	select {
+	case <-kv.regs:
+		t.Fatal("registered again while stopping")
+	default:
+	}
+}
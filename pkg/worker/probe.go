@@ -0,0 +1,276 @@
+package worker
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	livenessProbe  = "liveness"
+	readinessProbe = "readiness"
+)
+
+//probeWorker 单个容器的一种健康检查
+type probeWorker struct {
+	d       *daemon
+	kind    string
+	id      string
+	ip      string
+	port    int
+	edp     *core.Endpoint
+	probe   *core.Probe
+	stopCh  chan struct{}
+	success int
+	failure int
+}
+
+//probeResult 就绪检查结果
+type probeResult struct {
+	ready   bool
+	message string
+	time    int64
+}
+
+//syncProbes 为运行中的容器启动健康检查，停止已不存在容器的检查
+func (d *daemon) syncProbes(edps map[string]*core.Endpoint) {
+	running := make(map[string]bool)
+	for _, edp := range edps {
+		if edp.Status.State != "running" {
+			continue
+		}
+		svc := d.getContainerSvc(d.containerNameByEdp(edp))
+		if svc == nil || svc.Labels[core.HashLabelKey] != edp.Labels[core.HashLabelKey] {
+			continue
+		}
+		probes := map[string]*core.Probe{
+			livenessProbe:  svc.LivenessProbe,
+			readinessProbe: svc.ReadinessProbe,
+		}
+		for kind, probe := range probes {
+			if probe == nil {
+				continue
+			}
+			key := edp.Status.ID + "/" + kind
+			running[key] = true
+			if _, ok := d.probes.Load(key); ok {
+				continue
+			}
+			port, _ := strconv.Atoi(edp.Labels[core.ServicePortLabelKey])
+			w := &probeWorker{
+				d:      d,
+				kind:   kind,
+				id:     edp.Status.ID,
+				ip:     edp.Status.IP,
+				port:   port,
+				edp:    edp,
+				probe:  probe,
+				stopCh: make(chan struct{}),
+			}
+			d.probes.Store(key, w)
+			go w.run()
+		}
+	}
+	d.probes.Range(func(k, v interface{}) bool {
+		if !running[k.(string)] {
+			close(v.(*probeWorker).stopCh)
+			d.probes.Delete(k)
+			d.readiness.Delete(v.(*probeWorker).id)
+		}
+		return true
+	})
+}
+
+//setReadyCondition 根据就绪检查结果设置端点Ready 状态
+func (d *daemon) setReadyCondition(edp *core.Endpoint) {
+	cond := core.EndpointCondition{
+		Type:   core.ReadyCondition,
+		Status: edp.Status.State == "running",
+	}
+	if !cond.Status {
+		cond.Reason = "ContainerNotRunning"
+	} else if svc := d.getContainerSvc(d.containerNameByEdp(edp)); svc != nil && svc.ReadinessProbe != nil {
+		cond.Status = false
+		cond.Reason = "ReadinessProbePending"
+		if v, ok := d.readiness.Load(edp.Status.ID); ok {
+			res := v.(probeResult)
+			cond.Status = res.ready
+			cond.Message = res.message
+			cond.LastTransitionTime = res.time
+			cond.Reason = ""
+			if !res.ready {
+				cond.Reason = "ReadinessProbeFailed"
+			}
+		}
+	}
+	edp.Status.SetCondition(cond)
+}
+
+func (w *probeWorker) run() {
+	delay := time.Duration(w.probe.InitialDelaySeconds) * time.Second
+	period := time.Duration(w.probe.PeriodSeconds) * time.Second
+	if period <= 0 {
+		period = 10 * time.Second
+	}
+	select {
+	case <-time.After(delay):
+	case <-w.stopCh:
+		return
+	}
+	t := time.NewTicker(period)
+	defer t.Stop()
+	for {
+		w.check()
+		select {
+		case <-t.C:
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+func (w *probeWorker) check() {
+	successThreshold := w.probe.SuccessThreshold
+	if successThreshold <= 0 {
+		successThreshold = 1
+	}
+	failureThreshold := w.probe.FailureThreshold
+	if failureThreshold <= 0 {
+		failureThreshold = 3
+	}
+	err := w.d.runProbe(w.probe, w.id, w.ip, w.port)
+	if err == nil {
+		w.success++
+		w.failure = 0
+	} else {
+		w.failure++
+		w.success = 0
+	}
+
+	if w.kind == readinessProbe {
+		var res probeResult
+		switch {
+		case w.success >= successThreshold:
+			res.ready = true
+		case w.failure >= failureThreshold:
+			res.message = err.Error()
+		default:
+			return
+		}
+		if old, ok := w.d.readiness.Load(w.id); ok && old.(probeResult).ready == res.ready {
+			return
+		}
+		res.time = time.Now().Unix()
+		w.d.readiness.Store(w.id, res)
+		w.d.refresh()
+		return
+	}
+
+	if w.failure >= failureThreshold && !w.d.stopping() {
+		msg := "liveness probe failed: " + err.Error()
+		logrus.Warnf("%s %s", w.edp.Name, msg)
+		w.d.addEvent(w.edp, core.RestartEventAction, core.InProgressEventStatus, msg)
+		err = w.d.rt.Restart(context.Background(), w.id)
+		if err != nil {
+			logrus.Error(err)
+			w.d.addEvent(w.edp, core.RestartEventAction, core.FailEventStatus, err.Error())
+		} else {
+			w.d.addEvent(w.edp, core.RestartEventAction, core.SuccessEventStatus, msg)
+		}
+		w.failure = 0
+		select {
+		case <-time.After(time.Duration(w.probe.InitialDelaySeconds) * time.Second):
+		case <-w.stopCh:
+		}
+	}
+}
+
+func (d *daemon) runProbe(probe *core.Probe, id, ip string, defaultPort int) error {
+	timeout := time.Duration(probe.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	switch {
+	case probe.HTTPGet != nil:
+		port := probe.HTTPGet.Port
+		if port == 0 {
+			port = defaultPort
+		}
+		scheme := strings.ToLower(probe.HTTPGet.Scheme)
+		if scheme == "" {
+			scheme = "http"
+		}
+		path := probe.HTTPGet.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(ip, strconv.Itoa(port)), path), nil)
+		if err != nil {
+			return err
+		}
+		for k, v := range probe.HTTPGet.Headers {
+			req.Header.Set(k, v)
+		}
+		cli := &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+		}
+		resp, err := cli.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return fmt.Errorf("http probe status %d", resp.StatusCode)
+		}
+		return nil
+	case probe.TCPSocket != nil:
+		port := probe.TCPSocket.Port
+		if port == 0 {
+			port = defaultPort
+		}
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case probe.Exec != nil:
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		code, out, err := d.rt.ExecRun(ctx, id, probe.Exec.Command)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return fmt.Errorf("exec probe exit code %d: %s", code, strings.TrimSpace(out))
+		}
+		return nil
+	}
+	return errors.New("probe has no handler")
+}
+
+//getContainerSvc 当前节点的容器服务
+func (d *daemon) getContainerSvc(name string) *core.ContainerService {
+	var res *core.ContainerService
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		if svc.Name == name {
+			res = svc
+			return false
+		}
+		return true
+	})
+	return res
+}
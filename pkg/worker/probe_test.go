@@ -0,0 +1,158 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//dnsRecorder 记录dns 应答
+type dnsRecorder struct {
+	dns.ResponseWriter
+	msg *dns.Msg
+}
+
+func (w *dnsRecorder) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	return nil
+}
+
+//newProbeDaemon 运行一个带健康检查的web 容器
+func newProbeDaemon(t *testing.T, readiness, liveness *core.Probe) (*fakeRuntime, *daemon, *core.Endpoint) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	svc := &core.ContainerService{
+		Name:           "oars_default_web_web-0",
+		Image:          "nginx:latest",
+		ReadinessProbe: readiness,
+		LivenessProbe:  liveness,
+		Labels:         map[string]string{core.CreatorLabelKey: "oars", core.HashLabelKey: "v1"},
+	}
+	d.svcCache.Store("web", svc)
+	syncAll(t, d)
+	cs, _ := rt.List(context.Background())
+	rt.Start(context.Background(), cs[0].ID)
+	cs, _ = rt.List(context.Background())
+	edp := d.cantainerToEndpoint(cs[0])
+	edp.Status.IP = "172.17.0.2"
+	return rt, d, edp
+}
+
+func newProbeWorker(d *daemon, kind string, edp *core.Endpoint, probe *core.Probe) *probeWorker {
+	return &probeWorker{d: d, kind: kind, id: edp.Status.ID, ip: edp.Status.IP, edp: edp, probe: probe, stopCh: make(chan struct{})}
+}
+
+func TestReadinessProbe(t *testing.T) {
+	probe := &core.Probe{Exec: &core.ExecAction{Command: []string{"true"}}, SuccessThreshold: 2, FailureThreshold: 2}
+	rt, d, edp := newProbeDaemon(t, probe, nil)
+	w := newProbeWorker(d, readinessProbe, edp, probe)
+	svc := &core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "web"}}
+	lookup := func() []string {
+		d.edpLister = fakeLister{edp}
+		req := new(dns.Msg)
+		req.SetQuestion("web.default.", dns.TypeA)
+		rec := new(dnsRecorder)
+		d.dnsHandle(rec, req)
+		ips := make([]string, 0)
+		for _, rr := range rec.msg.Answer {
+			ips = append(ips, rr.(*dns.A).A.String())
+		}
+		return ips
+	}
+	expectReady := func(ready bool, reason string) {
+		t.Helper()
+		d.setReadyCondition(edp)
+		if edp.Status.IsReady() != ready {
+			t.Fatalf("expect ready %v, got %+v", ready, edp.Status.Conditions)
+		}
+		if cond := edp.Status.Conditions[0]; cond.Reason != reason {
+			t.Fatalf("expect reason %q, got %q", reason, cond.Reason)
+		}
+		//未就绪的端点不加入dns、ipvs，ingress 通过dns 访问服务
+		dnsIPs, vsIPs := lookup(), readyEndpointIPs([]core.Resource{edp}, svc)
+		if ready != (len(dnsIPs) == 1) || ready != (len(vsIPs) == 1) {
+			t.Fatalf("expect endpoint routed %v, got dns %v ipvs %v", ready, dnsIPs, vsIPs)
+		}
+	}
+
+	//检查结果出来前不接收流量
+	expectReady(false, "ReadinessProbePending")
+	w.check()
+	expectReady(false, "ReadinessProbePending")
+	w.check()
+	expectReady(true, "")
+
+	//连续失败达到阈值后摘除
+	rt.execCode = 1
+	w.check()
+	expectReady(true, "")
+	w.check()
+	expectReady(false, "ReadinessProbeFailed")
+
+	//容器停止后检查结果失效
+	edp.Status.State = "exited"
+	expectReady(false, "ContainerNotRunning")
+}
+
+func TestLivenessProbe(t *testing.T) {
+	probe := &core.Probe{Exec: &core.ExecAction{Command: []string{"true"}}, FailureThreshold: 3}
+	rt, d, edp := newProbeDaemon(t, nil, probe)
+	w := newProbeWorker(d, livenessProbe, edp, probe)
+	rt.execCode = 1
+	w.check()
+	w.check()
+	if rt.restarts != 0 {
+		t.Fatal("restarted before failure threshold")
+	}
+	w.check()
+	if rt.restarts != 1 {
+		t.Fatalf("expect restart at failure threshold, got %d", rt.restarts)
+	}
+	//重启后重新计数
+	w.check()
+	rt.execCode = 0
+	w.check()
+	rt.execCode = 1
+	w.check()
+	w.check()
+	if rt.restarts != 1 {
+		t.Fatalf("expect failures reset by success, got %d restarts", rt.restarts)
+	}
+
+	//worker 停止时不重启
+	d.stopCh = make(chan struct{})
+	close(d.stopCh)
+	w.check()
+	if rt.restarts != 1 {
+		t.Fatal("restarted while worker stopping")
+	}
+}
+
+func TestProbeDelayAndPeriod(t *testing.T) {
+	probe := &core.Probe{Exec: &core.ExecAction{Command: []string{"true"}}, InitialDelaySeconds: 1, PeriodSeconds: 1}
+	rt, d, edp := newProbeDaemon(t, probe, nil)
+	w := newProbeWorker(d, readinessProbe, edp, probe)
+	runs := func() int {
+		rt.mu.Lock()
+		defer rt.mu.Unlock()
+		return rt.execRuns
+	}
+	go w.run()
+	defer close(w.stopCh)
+	time.Sleep(500 * time.Millisecond)
+	if runs() != 0 {
+		t.Fatal("probe ran before initial delay")
+	}
+	time.Sleep(time.Second)
+	if runs() != 1 {
+		t.Fatalf("expect first probe after initial delay, got %d", runs())
+	}
+	time.Sleep(time.Second)
+	if runs() != 2 {
+		t.Fatalf("expect one probe per period, got %d", runs())
+	}
+}
@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+)
+
+//manifestMediaTypes 与docker pull 一致，优先返回多架构清单的digest
+var manifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+//registryDigest 通过registry v2 接口查询镜像标签当前的digest，auth 为registryAuth 生成的凭证
+func registryDigest(ctx context.Context, image, auth string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest().String(), nil
+	}
+	named = reference.TagNameOnly(named)
+	ref := named.(reference.Tagged).Tag()
+	domain := reference.Domain(named)
+	if domain == "docker.io" {
+		domain = "registry-1.docker.io"
+	}
+	username, password, err := decodeRegistryAuth(auth)
+	if err != nil {
+		return "", err
+	}
+	u := fmt.Sprintf("https://%s/v2/%s/manifests/%s", domain, reference.Path(named), ref)
+	resp, err := manifestHead(ctx, u, "")
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		authorization := ""
+		for _, c := range challenge.ResponseChallenges(resp) {
+			switch strings.ToLower(c.Scheme) {
+			case "bearer":
+				token, err := registryToken(ctx, c.Parameters, username, password)
+				if err != nil {
+					return "", err
+				}
+				authorization = "Bearer " + token
+			case "basic":
+				if username != "" {
+					authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+				}
+			}
+			if authorization != "" {
+				break
+			}
+		}
+		if authorization == "" {
+			return "", fmt.Errorf("%s: unauthorized", image)
+		}
+		resp, err = manifestHead(ctx, u, authorization)
+		if err != nil {
+			return "", err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: registry returned %s", image, resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("%s: registry returned no digest", image)
+	}
+	return digest, nil
+}
+
+func manifestHead(ctx context.Context, u, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodHead, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+//registryToken 按bearer 认证挑战获取拉取token
+func registryToken(ctx context.Context, params map[string]string, username, password string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return "", err
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	if params["scope"] != "" {
+		q.Set("scope", params["scope"])
+	}
+	realm.RawQuery = q.Encode()
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token: %s", resp.Status)
+	}
+	var v struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&v)
+	if err != nil {
+		return "", err
+	}
+	if v.Token != "" {
+		return v.Token, nil
+	}
+	return v.AccessToken, nil
+}
+
+//decodeRegistryAuth 解析registryAuth 生成的凭证
+func decodeRegistryAuth(auth string) (string, string, error) {
+	if auth == "" {
+		return "", "", nil
+	}
+	data, err := base64.URLEncoding.DecodeString(auth)
+	if err != nil {
+		return "", "", err
+	}
+	v := struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}{}
+	err = json.Unmarshal(data, &v)
+	return v.Username, v.Password, err
+}
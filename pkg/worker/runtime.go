@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/docker/distribution/reference"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	"github.com/oars-sigs/oars-cloud/pkg/worker/metrics"
+)
+
+const (
+	//DockerRuntime docker 运行时
+	DockerRuntime = "docker"
+	//ContainerdRuntime containerd 运行时
+	ContainerdRuntime = "containerd"
+)
+
+//defaultStopTimeout 停止容器时等待StopSignal 生效的默认时间
+const defaultStopTimeout = 10 * time.Second
+
+//Runtime 容器运行时
+type Runtime interface {
+	Create(ctx context.Context, spec *ContainerSpec) (string, error)
+	Start(ctx context.Context, id string) error
+	Stop(ctx context.Context, id string, timeout time.Duration) error //发送StopSignal，超过timeout 后强制结束
+	Remove(ctx context.Context, id string) error
+	Restart(ctx context.Context, id string) error
+	List(ctx context.Context) ([]Container, error)
+	Inspect(ctx context.Context, id string) (*ContainerState, error)
+	InspectConfig(ctx context.Context, id string) (*ContainerConfig, error)
+	Events(ctx context.Context, out func(ContainerEvent)) error //持续监听容器事件，直到ctx 结束或连接断开
+	ImagePull(ctx context.Context, image, auth string, progress func(PullProgress)) error
+	ImageExist(ctx context.Context, image string) (bool, error)
+	ImageDigest(ctx context.Context, image string) (string, error)
+	RemoteDigest(ctx context.Context, image, auth string) (string, error)
+	ImageList(ctx context.Context) ([]Image, error)
+	ImageRemove(ctx context.Context, id string) error
+	ImageRoot(ctx context.Context) (string, error)
+	Log(ctx context.Context, id, tail, since string) (string, error)
+	LogStream(ctx context.Context, id string, opt *core.EndpointLogOpt, out func(*core.EndpointLogLine) error) error
+	Exec(ctx context.Context, id string, opt *core.EndpointExecOpt) (ExecConn, error)
+	ExecRun(ctx context.Context, id string, cmd []string) (int, string, error)
+	CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, int64, error) //返回tar 包和文件大小，目录或未知时为-1
+	CopyTo(ctx context.Context, id, path string, content io.Reader) error        //tar 包解压到path 目录
+	CreateNetwork(ctx context.Context, name, driver, subnet string) error
+	ListNetworks(ctx context.Context) ([]string, error)
+	IsNotFound(err error) bool
+	Stats(ctx context.Context) ([]*metrics.ContainerMetrics, error) //运行中容器的资源统计，用于prometheus 指标
+}
+
+//ContainerSpec 创建容器的参数，卷和日志等已由daemon 处理
+type ContainerSpec struct {
+	*core.ContainerService
+	Mounts     []Mount
+	DNS        []string
+	LogDriver  string
+	LogOptions map[string]string
+}
+
+//repoDigest 选择与镜像同仓库的digest 引用
+func repoDigest(image string, digests []string) string {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err == nil {
+		for _, d := range digests {
+			if strings.HasPrefix(d, named.Name()+"@") || strings.HasPrefix(d, reference.FamiliarName(named)+"@") {
+				return d
+			}
+		}
+	}
+	if len(digests) > 0 {
+		return digests[0]
+	}
+	return ""
+}
+
+//PullProgress 镜像拉取进度
+type PullProgress struct {
+	Status  string
+	Current int64 //已下载字节
+	Total   int64 //已知层的总字节
+}
+
+//Image 本地镜像
+type Image struct {
+	ID       string
+	RepoTags []string
+	Size     int64
+	Created  time.Time
+}
+
+//Mount 挂载
+type Mount struct {
+	Source string
+	Target string
+}
+
+//Container 运行时中的容器
+type Container struct {
+	ID       string
+	Name     string
+	Image    string
+	ImageID  string
+	Labels   map[string]string
+	State    string
+	Status   string
+	Networks map[string]ContainerNetwork
+	Detail   *ContainerState //List 已inspect 时的状态详情，否则为nil
+}
+
+//ContainerState 容器运行状态详情
+type ContainerState struct {
+	Status       string
+	ExitCode     int
+	OOMKilled    bool
+	RestartCount int
+	StartedAt    time.Time
+	FinishedAt   time.Time
+}
+
+//ContainerConfig 容器的实际配置，用于检查漂移
+type ContainerConfig struct {
+	Image    string
+	Env      []string //包含镜像中的环境变量
+	Labels   map[string]string
+	Mounts   []Mount //bind 挂载
+	Memory   int64
+	CPUQuota int64
+}
+
+//ContainerEvent 容器事件，Action 使用docker 的事件名称
+type ContainerEvent struct {
+	ID     string
+	Name   string
+	Action string
+}
+
+//ContainerNetwork 容器网络
+type ContainerNetwork struct {
+	IP      string
+	Gateway string
+}
+
+//ExecConn 交互式执行的连接
+type ExecConn interface {
+	io.ReadWriteCloser
+	Resize(rows, cols uint) error
+	Signal(sig syscall.Signal) error
+	ExitCode() (int, error) //输出结束后获取退出码
+}
+
+//newRuntime 根据节点配置创建运行时
+func newRuntime(node *core.NodeConfig) (Runtime, error) {
+	switch node.Runtime {
+	case "", DockerRuntime:
+		rt, err := newDockerRuntime()
+		if err != nil {
+			return nil, err
+		}
+		return rt, nil
+	case ContainerdRuntime:
+		rt, err := newContainerdRuntime(node.Containerd)
+		if err != nil {
+			return nil, err
+		}
+		return rt, nil
+	}
+	return nil, fmt.Errorf("unsupported runtime %s", node.Runtime)
+}
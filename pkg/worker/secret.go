@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+)
+
+//cacheSecret 未配置加密口令时不缓存，引用密钥的容器将创建失败
+func (d *daemon) cacheSecret() error {
+	if d.secretKey == "" {
+		return nil
+	}
+	secretLister, err := resStore.NewCipherLister(d.store, new(core.Secret), d.secretKey, &core.ResourceEventHandle{})
+	if err != nil {
+		return err
+	}
+	d.secretLister = secretLister
+	return nil
+}
+
+func (d *daemon) getSecret(namespace, name string) (*core.Secret, error) {
+	if d.secretLister == nil {
+		return nil, resStore.ErrSecretKeyRequired
+	}
+	ress, ok := d.secretLister.List()
+	if !ok {
+		return nil, fmt.Errorf("secret lister not ready")
+	}
+	for _, res := range ress {
+		secret := res.(*core.Secret)
+		if secret.Namespace == namespace && secret.Name == name {
+			return secret, nil
+		}
+	}
+	return nil, fmt.Errorf("secret %s.%s not found", name, namespace)
+}
+
+func (d *daemon) getSecretValue(namespace, name, key string) (string, error) {
+	secret, err := d.getSecret(namespace, name)
+	if err != nil {
+		return "", err
+	}
+	v, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s.%s", key, name, namespace)
+	}
+	return v, nil
+}
+
+//secretEnv 从密钥读取环境变量
+func (d *daemon) secretEnv(edp *core.Endpoint, svc *core.ContainerService) ([]string, error) {
+	env := make([]string, 0, len(svc.SecretEnv))
+	for _, s := range svc.SecretEnv {
+		v, err := d.getSecretValue(edp.Namespace, s.Secret, s.Key)
+		if err != nil {
+			return nil, err
+		}
+		env = append(env, s.Name+"="+v)
+	}
+	return env, nil
+}
+
+func (d *daemon) secretDir(edp *core.Endpoint) string {
+	return filepath.Join(d.node.WorkDir, "secret", edp.Namespace, edp.Service, edp.Name)
+}
+
+//secretMounts 将密钥写入端点目录，文件权限0600
+func (d *daemon) secretMounts(edp *core.Endpoint, svc *core.ContainerService) ([]Mount, error) {
+	mounts := make([]Mount, 0, len(svc.Secrets))
+	for _, s := range svc.Secrets {
+		secret, err := d.getSecret(edp.Namespace, s.Secret)
+		if err != nil {
+			return nil, err
+		}
+		dir := filepath.Join(d.secretDir(edp), s.Secret)
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{s.Key}
+		if s.Key == "" {
+			keys = make([]string, 0, len(secret.Data))
+			for k := range secret.Data {
+				keys = append(keys, k)
+			}
+		}
+		for _, k := range keys {
+			v, ok := secret.Data[k]
+			if !ok {
+				return nil, fmt.Errorf("key %s not found in secret %s.%s", k, s.Secret, edp.Namespace)
+			}
+			err = writeSecretFile(filepath.Join(dir, filepath.Base(k)), v)
+			if err != nil {
+				return nil, err
+			}
+		}
+		source := dir
+		if s.Key != "" {
+			source = filepath.Join(dir, filepath.Base(s.Key))
+		}
+		mounts = append(mounts, Mount{Source: source, Target: s.Path})
+	}
+	return mounts, nil
+}
+
+func writeSecretFile(path, data string) error {
+	err := ioutil.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		return err
+	}
+	//WriteFile 不修改已存在文件的权限
+	return os.Chmod(path, 0600)
+}
+
+//removeSecretFiles 删除端点的密钥文件
+func (d *daemon) removeSecretFiles(edp *core.Endpoint) {
+	os.RemoveAll(d.secretDir(edp))
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//shutdownStoppedFile 退出时停止的容器，worker 重新启动后恢复运行
+const shutdownStoppedFile = "shutdown-stopped.json"
+
+//stopping worker 是否正在退出
+func (d *daemon) stopping() bool {
+	select {
+	case <-d.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+//shutdown 停止同步，标记节点为stopping，按配置停止容器，最后撤销节点注册租约
+func (d *daemon) shutdown() error {
+	close(d.stopCh)
+	d.queue.shutDown()
+	d.syncProbes(nil)
+	err := d.markNodeStopping()
+	if err != nil {
+		logrus.Errorf("mark node stopping: %v", err)
+	}
+	if d.node.StopContainers {
+		d.stopContainers()
+	}
+	d.mu.Lock()
+	reg := d.nodeReg
+	d.nodeReg = nil
+	d.mu.Unlock()
+	if reg == nil {
+		return nil
+	}
+	return reg.Close()
+}
+
+//markNodeStopping 将节点端点状态改为stopping，调度器不再向该节点调度
+func (d *daemon) markNodeStopping() error {
+	arg := &core.Endpoint{
+		ResourceMeta: &core.ResourceMeta{
+			Name:      d.node.Hostname,
+			Namespace: "system",
+		},
+		Service: "node",
+	}
+	res, err := d.edpstore.Get(context.Background(), arg, &core.GetOptions{})
+	if err != nil {
+		return err
+	}
+	edp := res.(*core.Endpoint)
+	if edp.Status == nil {
+		edp.Status = new(core.EndpointStatus)
+	}
+	edp.Status.State = core.NodeStoppingState
+	edp.Status.StateDetail = "worker is shutting down"
+	_, err = d.edpstore.Put(context.Background(), edp, &core.PutOptions{})
+	return err
+}
+
+//stopContainers 并发停止运行中的容器，等待StopSignal 生效，超过宽限期后强制结束
+func (d *daemon) stopContainers() {
+	d.mu.Lock()
+	edps := make([]*core.Endpoint, 0, len(d.endpointCache))
+	for _, edp := range d.endpointCache {
+		if edp.Status.ID != "" && edp.Status.State == "running" {
+			edps = append(edps, edp)
+		}
+	}
+	d.mu.Unlock()
+	logrus.Infof("stopping %d containers, grace period %s", len(edps), d.node.StopGracePeriod)
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		stopped = make([]string, 0, len(edps))
+	)
+	for _, edp := range edps {
+		wg.Add(1)
+		go func(edp *core.Endpoint) {
+			defer wg.Done()
+			d.addEvent(edp, core.StopEventAction, core.InProgressEventStatus, "worker is shutting down")
+			err := d.rt.Stop(context.Background(), edp.Status.ID, d.node.StopGracePeriod)
+			if err != nil {
+				logrus.Error(err)
+				d.addEvent(edp, core.StopEventAction, core.FailEventStatus, err.Error())
+				return
+			}
+			mu.Lock()
+			stopped = append(stopped, edp.Status.ID)
+			mu.Unlock()
+			d.addEvent(edp, core.StopEventAction, core.SuccessEventStatus, "")
+		}(edp)
+	}
+	wg.Wait()
+	err := d.saveShutdownStopped(stopped)
+	if err != nil {
+		logrus.Error(err)
+	}
+}
+
+func (d *daemon) saveShutdownStopped(ids []string) error {
+	data, _ := json.Marshal(ids)
+	err := os.MkdirAll(d.node.WorkDir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(d.node.WorkDir, shutdownStoppedFile), data, 0644)
+}
+
+//startShutdownStopped 启动上次退出时停止的容器
+func (d *daemon) startShutdownStopped() {
+	file := filepath.Join(d.node.WorkDir, shutdownStoppedFile)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	ids := make([]string, 0)
+	err = json.Unmarshal(data, &ids)
+	if err != nil {
+		logrus.Errorf("load shutdown stopped containers: %v", err)
+	}
+	ctx := context.Background()
+	for _, id := range ids {
+		state, err := d.rt.Inspect(ctx, id)
+		if err != nil {
+			if !d.rt.IsNotFound(err) {
+				logrus.Error(err)
+			}
+			continue
+		}
+		if state.Status == "running" {
+			continue
+		}
+		err = d.rt.Start(ctx, id)
+		if err != nil {
+			logrus.Error(err)
+		}
+	}
+	os.Remove(file)
+}
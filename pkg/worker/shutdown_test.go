@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+//fakeRegister 记录是否已撤销，关闭done 模拟租约过期
+type fakeRegister struct {
+	closed bool
+	done   chan struct{}
+}
+
+func (r *fakeRegister) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (r *fakeRegister) Done() <-chan struct{} {
+	return r.done
+}
+
+func TestShutdown(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	dir, err := ioutil.TempDir("", "oars-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d.node.WorkDir = dir
+	d.node.StopContainers = true
+	d.queue = newWorkQueue(retryDelay, resyncPeriod)
+	d.stopCh = make(chan struct{})
+	reg := new(fakeRegister)
+	d.nodeReg = reg
+
+	id, err := rt.Create(context.Background(), &ContainerSpec{ContainerService: &core.ContainerService{
+		Name:   "oars_default_web_web-0",
+		Labels: map[string]string{core.CreatorLabelKey: "oars"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt.Start(context.Background(), id)
+	syncContainers(t, d)
+
+	err = d.shutdown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.stopping() || !reg.closed {
+		t.Fatalf("stopping %v, lease revoked %v", d.stopping(), reg.closed)
+	}
+	if _, ok := d.queue.get(); ok {
+		t.Fatal("queue not shut down")
+	}
+	state, _ := rt.Inspect(context.Background(), id)
+	if state.Status != "exited" {
+		t.Fatalf("container %s after shutdown", state.Status)
+	}
+
+	//重新启动后恢复退出时停止的容器
+	d = newFakeDaemon(rt)
+	d.node.WorkDir = dir
+	d.startShutdownStopped()
+	state, _ = rt.Inspect(context.Background(), id)
+	if state.Status != "running" {
+		t.Fatalf("container %s after restart", state.Status)
+	}
+	if _, err := os.Stat(dir + "/" + shutdownStoppedFile); !os.IsNotExist(err) {
+		t.Fatalf("%s not removed", shutdownStoppedFile)
+	}
+}
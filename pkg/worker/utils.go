@@ -11,8 +11,6 @@ import (
 	"time"
 
 	"github.com/oars-sigs/oars-cloud/core"
-
-	"github.com/docker/docker/api/types"
 )
 
 func getFreePort() (int, error) {
@@ -29,10 +27,18 @@ func getFreePort() (int, error) {
 	return l.Addr().(*net.TCPAddr).Port, nil
 }
 
-func md5V(svc *core.ContainerService) string {
-	s, _ := json.Marshal(svc)
+//md5V 容器配置的摘要，extra 为不在容器配置中但变更后需重建的参数
+func md5V(svc *core.ContainerService, extra ...interface{}) string {
+	return md5Values(append([]interface{}{svc}, extra...)...)
+}
+
+//md5Values 多个值json 序列化后的摘要
+func md5Values(values ...interface{}) string {
 	h := md5.New()
-	h.Write(s)
+	for _, v := range values {
+		d, _ := json.Marshal(v)
+		h.Write(d)
+	}
 	return hex.EncodeToString(h.Sum(nil))
 }
 
@@ -64,24 +70,24 @@ func (d *daemon) getEndpointByContainerName(s string) *core.Endpoint {
 	}
 }
 
-func (d *daemon) cantainerToEndpoint(cn types.Container) *core.Endpoint {
-	cname := strings.TrimPrefix(cn.Names[0], "/")
-	edp := d.getEndpointByContainerName(cname)
+func (d *daemon) cantainerToEndpoint(cn Container) *core.Endpoint {
+	edp := d.getEndpointByContainerName(cn.Name)
 	edp.Labels = cn.Labels
 	status := &core.EndpointStatus{
 		ID:          cn.ID,
 		State:       cn.State,
 		StateDetail: cn.Status,
+		ImageDigest: cn.Labels[core.ImageDigestLabelKey],
 		Node: core.Node{
 			Hostname: d.node.Hostname,
 			IP:       d.node.IP,
 		},
 	}
-	for name, netw := range cn.NetworkSettings.Networks {
+	for name, netw := range cn.Networks {
 		if name == "host" {
 			status.IP = d.node.IP
 		} else {
-			status.IP = netw.IPAddress
+			status.IP = netw.IP
 			status.Gateway = netw.Gateway
 		}
 	}
@@ -98,18 +104,32 @@ func (d *daemon) cserviceToEndpoint(cservice *core.ContainerService) *core.Endpo
 			IP:       d.node.IP,
 		},
 	}
+	if v, ok := d.pulls.Load(cservice.Name); ok {
+		status.StateDetail = v.(*pullState).detail()
+	}
 	edp.Status = status
 	edp.Labels = cservice.Labels
 	return edp
 }
 
+//readyEndpointIPs 服务就绪端点的IP，未通过就绪检查的端点不接收流量
+func readyEndpointIPs(edpRess []core.Resource, svc *core.Service) []string {
+	ips := make([]string, 0)
+	for _, res := range edpRess {
+		edp := res.(*core.Endpoint)
+		if edp.Service == svc.Name && edp.Status.IsReady() {
+			ips = append(ips, edp.Status.IP)
+		}
+	}
+	return ips
+}
+
 func (d *daemon) convEvent(r core.Resource, action, status, message string) *core.Event {
 	event := &core.Event{
 		Action:  action,
 		Status:  status,
 		From:    "worker-" + d.node.Hostname,
 		Message: message,
-		Number:  time.Now().UnixNano(),
 	}
 	event.GenName(r)
 	return event
@@ -145,3 +165,20 @@ func registryAuth(username, password string) string {
 	buf, _ := json.Marshal(&v)
 	return base64.URLEncoding.EncodeToString(buf)
 }
+
+const (
+	backoffBase = 10 * time.Second
+	backoffMax  = 5 * time.Minute
+)
+
+//expBackoff 失败重试间隔，指数增长
+func expBackoff(failed int) time.Duration {
+	backoff := backoffBase
+	for i := 1; i < failed && backoff < backoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > backoffMax {
+		backoff = backoffMax
+	}
+	return backoff
+}
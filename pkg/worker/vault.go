@@ -1,35 +1,279 @@
 package worker
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/sirupsen/logrus"
+
+	"github.com/oars-sigs/oars-cloud/core"
 )
 
+//vaultMinLoginInterval 两次登录的最小间隔
+var vaultMinLoginInterval = 30 * time.Second
+
+//vaultRefRegex 匹配core.VaultRef 生成的引用
+var vaultRefRegex = regexp.MustCompile(`\$\{oars_vault:([^:}]+):([^}]+)\}`)
+
 // VaultClient vault client
 type VaultClient struct {
-	client *api.Client
+	client   *api.Client
+	cfg      core.VaultConfig
+	mu       sync.Mutex
+	leases   map[string]*api.Secret //动态密钥，按路径缓存，由renewer 续期
+	kvMounts map[string]string      //路径对应的KV v2 挂载点，非v2 时为空
+	minLogin time.Duration          //两次登录的最小间隔，创建时取vaultMinLoginInterval
 }
 
 // newVault new vault client
-func newVault(addr, token string) (*VaultClient, error) {
+func newVault(cfg core.VaultConfig) (*VaultClient, error) {
 	client, err := api.NewClient(&api.Config{
-		Address: addr,
+		Address: cfg.Address,
 	})
 	if err != nil {
 		return nil, err
 	}
-	client.SetToken(token)
-	return &VaultClient{client}, nil
+	v := &VaultClient{
+		client:   client,
+		cfg:      cfg,
+		leases:   make(map[string]*api.Secret),
+		kvMounts: make(map[string]string),
+		minLogin: vaultMinLoginInterval,
+	}
+	if cfg.AuthMethod == "" || cfg.AuthMethod == "token" {
+		client.SetToken(cfg.TOKEN)
+		return v, nil
+	}
+	secret, err := v.login()
+	if err != nil {
+		return nil, err
+	}
+	go v.keepAuth(secret)
+	return v, nil
+}
+
+//login 使用AppRole 或JWT 登录
+func (v *VaultClient) login() (*api.Secret, error) {
+	data := make(map[string]interface{})
+	switch v.cfg.AuthMethod {
+	case "approle":
+		secretID := v.cfg.SecretID
+		if v.cfg.SecretIDFile != "" {
+			b, err := ioutil.ReadFile(v.cfg.SecretIDFile)
+			if err != nil {
+				return nil, err
+			}
+			secretID = strings.TrimSpace(string(b))
+		}
+		data["role_id"] = v.cfg.RoleID
+		data["secret_id"] = secretID
+	case "jwt":
+		b, err := ioutil.ReadFile(v.cfg.JWTFile)
+		if err != nil {
+			return nil, err
+		}
+		data["role"] = v.cfg.Role
+		data["jwt"] = strings.TrimSpace(string(b))
+	default:
+		return nil, fmt.Errorf("unsupported vault auth method %s", v.cfg.AuthMethod)
+	}
+	mount := v.cfg.AuthMount
+	if mount == "" {
+		mount = v.cfg.AuthMethod
+	}
+	secret, err := v.client.Logical().Write("auth/"+mount+"/login", data)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Auth == nil {
+		return nil, errors.New("vault login returned no token")
+	}
+	v.client.SetToken(secret.Auth.ClientToken)
+	return secret, nil
+}
+
+//keepAuth 续期登录token，无法续期时重新登录
+func (v *VaultClient) keepAuth(secret *api.Secret) {
+	for {
+		start := time.Now()
+		if secret.Auth.Renewable {
+			renewer, err := v.client.NewRenewer(&api.RenewerInput{Secret: secret})
+			if err != nil {
+				logrus.Error(err)
+			} else {
+				go renewer.Renew()
+				err = <-renewer.DoneCh()
+				renewer.Stop()
+				if err != nil {
+					logrus.Errorf("vault token renew: %v", err)
+				}
+			}
+		} else {
+			time.Sleep(time.Duration(secret.Auth.LeaseDuration) * time.Second * 2 / 3)
+		}
+		//有效期为0 或续期立即结束时避免连续登录
+		if wait := v.minLogin - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+		secret = v.relogin()
+	}
+}
+
+//relogin 重新登录，失败时指数退避
+func (v *VaultClient) relogin() *api.Secret {
+	for failed := 1; ; failed++ {
+		s, err := v.login()
+		if err == nil {
+			return s
+		}
+		backoff := expBackoff(failed)
+		logrus.Errorf("vault login: %v, retry in %s", err, backoff)
+		time.Sleep(backoff)
+	}
 }
 
+//kvPath KV v2 挂载下的路径需要加上data/，与vault CLI 一样通过挂载信息判断版本
+func (v *VaultClient) kvPath(path string) string {
+	path = strings.TrimPrefix(path, "/")
+	v.mu.Lock()
+	mount, ok := v.kvMounts[path]
+	v.mu.Unlock()
+	if !ok {
+		mount = v.kvV2Mount(path)
+		v.mu.Lock()
+		v.kvMounts[path] = mount
+		v.mu.Unlock()
+	}
+	if mount == "" || strings.HasPrefix(path, mount+"data/") {
+		return path
+	}
+	return mount + "data/" + strings.TrimPrefix(path, mount)
+}
+
+//kvV2Mount 返回路径所在的KV v2 挂载点，查询失败或非v2 时为空
+func (v *VaultClient) kvV2Mount(path string) string {
+	r := v.client.NewRequest("GET", "/v1/sys/internal/ui/mounts/"+path)
+	resp, err := v.client.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return ""
+	}
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil || secret == nil {
+		return ""
+	}
+	options, _ := secret.Data["options"].(map[string]interface{})
+	if options == nil || fmt.Sprint(options["version"]) != "2" {
+		return ""
+	}
+	mount, _ := secret.Data["path"].(string)
+	return mount
+}
+
+//read 读取密钥，动态密钥在租约有效期内复用并续期
+func (v *VaultClient) read(path string) (*api.Secret, error) {
+	path = v.kvPath(path)
+	v.mu.Lock()
+	secret, ok := v.leases[path]
+	v.mu.Unlock()
+	if ok {
+		return secret, nil
+	}
+	secret, err := v.client.Logical().Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("vault secret %s not found", path)
+	}
+	if secret.LeaseID != "" {
+		v.mu.Lock()
+		v.leases[path] = secret
+		v.mu.Unlock()
+		go v.keepLease(path, secret)
+	}
+	return secret, nil
+}
+
+//keepLease 续期动态密钥，租约结束后移出缓存，下次使用时重新读取
+func (v *VaultClient) keepLease(path string, secret *api.Secret) {
+	defer func() {
+		v.mu.Lock()
+		delete(v.leases, path)
+		v.mu.Unlock()
+	}()
+	if !secret.Renewable {
+		time.Sleep(time.Duration(secret.LeaseDuration) * time.Second * 2 / 3)
+		return
+	}
+	renewer, err := v.client.NewRenewer(&api.RenewerInput{Secret: secret})
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	go renewer.Renew()
+	defer renewer.Stop()
+	err = <-renewer.DoneCh()
+	if err != nil {
+		logrus.Errorf("vault lease %s renew: %v", secret.LeaseID, err)
+	}
+}
+
+//Get 读取密钥的字段，支持KV v1、v2 和动态密钥
 func (v *VaultClient) Get(path, key string) (string, error) {
-	s, err := v.client.Logical().Read(path)
+	s, err := v.read(path)
 	if err != nil {
 		return "", err
 	}
-	if v, ok := s.Data[key]; ok {
-		return fmt.Sprint(v), nil
+	data := s.Data
+	//KV v2 的值在data 字段中
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in vault secret %s", key, path)
 	}
-	return "", nil
+	return fmt.Sprint(value), nil
+}
+
+//resolveVault 替换字符串中的vault 引用，兼容环境变量中KEY=$oars_vault:path:key 的写法
+func (d *daemon) resolveVault(s string) (string, error) {
+	if !strings.Contains(s, "oars_vault:") {
+		return s, nil
+	}
+	if d.vault == nil {
+		return "", errors.New("vault is not configured")
+	}
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) == 2 && strings.HasPrefix(kv[1], "$oars_vault:") {
+		keys := strings.Split(kv[1], ":")
+		if len(keys) == 3 {
+			value, err := d.vault.Get(keys[1], keys[2])
+			if err != nil {
+				return "", err
+			}
+			return kv[0] + "=" + value, nil
+		}
+	}
+	var err error
+	res := vaultRefRegex.ReplaceAllStringFunc(s, func(ref string) string {
+		m := vaultRefRegex.FindStringSubmatch(ref)
+		value, e := d.vault.Get(m[1], m[2])
+		if e != nil && err == nil {
+			err = e
+		}
+		return value
+	})
+	return res, err
 }
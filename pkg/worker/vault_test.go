@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+)
+
+func TestResolveVault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			w.Write([]byte(`{"auth":{"client_token":"t1","lease_duration":3600}}`))
+		case "/v1/sys/internal/ui/mounts/secret/db":
+			w.Write([]byte(`{"data":{"path":"secret/","options":{"version":"2"}}}`))
+		case "/v1/secret/data/db":
+			if r.Header.Get("X-Vault-Token") != "t1" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"data":{"data":{"password":"pw"},"metadata":{"version":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c, err := newVault(core.VaultConfig{Address: srv.URL, AuthMethod: "approle", RoleID: "r", SecretID: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &daemon{vault: c}
+	for in, expect := range map[string]string{
+		"DB_PASSWORD=$oars_vault:secret/db:password":          "DB_PASSWORD=pw",
+		"url: db://admin:${oars_vault:secret/db:password}@db": "url: db://admin:pw@db",
+		"plain": "plain",
+	} {
+		out, err := d.resolveVault(in)
+		if err != nil || out != expect {
+			t.Fatalf("resolve %q: expect %q, got %q %v", in, expect, out, err)
+		}
+	}
+	if _, err := d.resolveVault("${oars_vault:secret/db:missing}"); err == nil {
+		t.Fatal("expect error for missing key")
+	}
+}
+
+func TestVaultKeepAuth(t *testing.T) {
+	var logins int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&logins, 1)
+		//不可续期且有效期为0
+		w.Write([]byte(`{"auth":{"client_token":"t1","lease_duration":0}}`))
+	}))
+	defer srv.Close()
+	old := vaultMinLoginInterval
+	vaultMinLoginInterval = 100 * time.Millisecond
+	defer func() { vaultMinLoginInterval = old }()
+	_, err := newVault(core.VaultConfig{Address: srv.URL, AuthMethod: "approle", RoleID: "r", SecretID: "s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(350 * time.Millisecond)
+	if n := atomic.LoadInt32(&logins); n > 5 {
+		t.Fatalf("expect logins limited by min interval, got %d", n)
+	}
+}
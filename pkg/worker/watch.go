@@ -2,8 +2,10 @@ package worker
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/oars-sigs/oars-cloud/core"
@@ -12,26 +14,134 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+const (
+	//resyncPeriod 事件遗漏时的兜底同步间隔
+	resyncPeriod = time.Minute
+	//retryDelay 运行时不可用时的重试间隔
+	retryDelay = 5 * time.Second
+	//syncWorkers 并发同步容器的协程数
+	syncWorkers = 4
+)
+
+//containerEventActions 影响容器状态的运行时事件，忽略exec 等频繁事件
+var containerEventActions = map[string]bool{
+	"create":  true,
+	"start":   true,
+	"restart": true,
+	"die":     true,
+	"oom":     true,
+	"destroy": true,
+	"pause":   true,
+	"unpause": true,
+	"rename":  true,
+	"update":  true,
+}
+
 func (d *daemon) run() {
 	go d.cacheContainers()
-	t := time.NewTicker(time.Second * 5)
+	go d.watchRuntimeEvents()
+	go d.watchWaiting(d.edpEvents.subscribe())
+	//等待服务和容器缓存就绪后开始同步
 	for {
-		select {
-		case <-t.C:
-			_, ok := d.svcLister.List()
-			if !ok {
-				logrus.Error("svc lister not ready")
-				continue
-			}
-			if !d.ready {
-				logrus.Error("container lister not ready")
-				continue
+		_, ok := d.svcLister.List()
+		if ok && d.containersReady() {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i := 0; i < syncWorkers; i++ {
+		go d.syncWorker()
+	}
+	d.enqueueAll()
+	t := time.NewTicker(resyncPeriod)
+	for range t.C {
+		d.enqueueAll()
+	}
+}
+
+//containersReady 容器缓存是否已刷新过
+func (d *daemon) containersReady() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.ready
+}
+
+//syncWorker 从队列取出容器名同步，失败后限速重试
+func (d *daemon) syncWorker() {
+	for {
+		name, ok := d.queue.get()
+		if !ok || d.stopping() {
+			return
+		}
+		err := d.syncContainer(name)
+		if err != nil {
+			logrus.Errorf("sync container %s failed %d times: %v", name, d.queue.retries(name)+1, err)
+			d.queue.addRateLimited(name)
+		} else {
+			d.queue.forget(name)
+		}
+		d.queue.done(name)
+	}
+}
+
+//enqueue 将容器加入同步队列
+func (d *daemon) enqueue(name string) {
+	if d.queue != nil {
+		d.queue.add(name)
+	}
+}
+
+//enqueueAfter 延迟将容器加入同步队列
+func (d *daemon) enqueueAfter(name string, delay time.Duration) {
+	if d.queue != nil {
+		d.queue.addAfter(name, delay)
+	}
+}
+
+//enqueueAll 将全部容器按依赖顺序加入同步队列
+func (d *daemon) enqueueAll() {
+	for _, name := range d.containerNames() {
+		d.enqueue(name)
+	}
+}
+
+//refresh 触发刷新容器状态
+func (d *daemon) refresh() {
+	notify(d.stateTrigger)
+}
+
+//watchRuntimeEvents 容器事件触发刷新状态，断开后重连并刷新以补上遗漏的事件
+func (d *daemon) watchRuntimeEvents() {
+	for {
+		err := d.rt.Events(context.Background(), func(ev ContainerEvent) {
+			action := strings.SplitN(ev.Action, ":", 2)[0]
+			if containerEventActions[action] {
+				d.refresh()
 			}
-			d.syncDockerSvc()
+		})
+		if err != nil {
+			logrus.Errorf("watch runtime events: %v", err)
 		}
+		time.Sleep(retryDelay)
+		d.refresh()
+	}
+}
+
+//watchWaiting 端点变化时重新同步等待依赖的容器
+func (d *daemon) watchWaiting(trigger <-chan struct{}) {
+	for range trigger {
+		d.waiting.Range(func(k, v interface{}) bool {
+			d.enqueue(k.(string))
+			return true
+		})
 	}
 }
 
+//cacheFile 存储不可用时恢复资源的缓存文件，不缓存Secret 以免明文落盘
+func (d *daemon) cacheFile(name string) string {
+	return filepath.Join(d.node.WorkDir, "cache", name+".json")
+}
+
 func (d *daemon) cacheConfig() error {
 	interceptor := func(put bool, r, prer core.Resource) (core.Resource, bool, error) {
 		if put {
@@ -48,20 +158,29 @@ func (d *daemon) cacheConfig() error {
 		}
 		return nil, true, nil
 	}
-	cfgLister, err := resStore.NewLister(d.store, new(core.ConfigMap), &core.ResourceEventHandle{Interceptor: interceptor})
+	d.cfgTrigger = make(chan struct{}, 1)
+	cfgLister, err := resStore.NewCachedLister(d.store, new(core.ConfigMap), &core.ResourceEventHandle{Interceptor: interceptor, Trigger: d.cfgTrigger}, d.cacheFile("configmaps"))
 	if err != nil {
 		return err
 	}
 	d.cfgLister = cfgLister
-	return nil
+	//容器哈希包含引用的配置，解析服务前需等待配置缓存就绪
+	for {
+		if _, ok := cfgLister.List(); ok {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
 }
 
 func (d *daemon) cacheEndpoint() error {
-	edpLister, err := resStore.NewLister(d.store, &core.Endpoint{}, &core.ResourceEventHandle{})
+	trigger := make(chan struct{}, 1)
+	edpLister, err := resStore.NewCachedLister(d.store, &core.Endpoint{}, &core.ResourceEventHandle{Trigger: trigger}, d.cacheFile("endpoints"))
 	if err != nil {
 		return err
 	}
 	d.edpLister = edpLister
+	go d.edpEvents.run(trigger)
 	interceptor := func(put bool, r, prer core.Resource) (core.Resource, bool, error) {
 		res := false
 		if r != nil {
@@ -76,7 +195,7 @@ func (d *daemon) cacheEndpoint() error {
 		}
 		return nil, res, nil
 	}
-	nodeEdpLister, err := resStore.NewLister(d.store, &core.Endpoint{}, &core.ResourceEventHandle{Interceptor: interceptor})
+	nodeEdpLister, err := resStore.NewCachedLister(d.store, &core.Endpoint{}, &core.ResourceEventHandle{Interceptor: interceptor}, d.cacheFile("node-endpoints"))
 	if err != nil {
 		return err
 	}
@@ -94,44 +213,57 @@ func (d *daemon) cacheService() error {
 		if prer != nil {
 			preCSvcs = d.parseContainerSvc(prer.(*core.Service))
 		}
+		changed := make(map[string]bool)
 		for _, nowCSvc := range nowCSvcs {
 			isExist := false
 			for _, preCSvc := range preCSvcs {
-				if nowCSvc.Name == preCSvc.Name && preCSvc.Labels[core.HashLabelKey] == nowCSvc.Labels[core.HashLabelKey] {
+				if nowCSvc.Name == preCSvc.Name && preCSvc.SpecHash == nowCSvc.SpecHash &&
+					nowCSvc.Hold == preCSvc.Hold {
 					isExist = true
 				}
 			}
 			if !isExist {
-				d.svcCache.Store(nowCSvc.Name+"_"+nowCSvc.Labels[core.HashLabelKey], nowCSvc)
+				d.svcCache.Store(nowCSvc.Name+"_"+nowCSvc.SpecHash, nowCSvc)
+				changed[nowCSvc.Name] = true
 			}
 		}
 		for _, preCSvc := range preCSvcs {
 			isExist := false
 			for _, nowCSvc := range nowCSvcs {
-				if nowCSvc.Name == preCSvc.Name && preCSvc.Labels[core.HashLabelKey] == nowCSvc.Labels[core.HashLabelKey] {
+				if nowCSvc.Name == preCSvc.Name && preCSvc.SpecHash == nowCSvc.SpecHash {
 					isExist = true
 				}
 			}
 			if !isExist {
-				d.svcCache.Delete(preCSvc.Name + "_" + preCSvc.Labels[core.HashLabelKey])
+				d.svcCache.Delete(preCSvc.Name + "_" + preCSvc.SpecHash)
+				changed[preCSvc.Name] = true
 			}
 		}
+		for name := range changed {
+			d.enqueue(name)
+		}
+		if len(changed) > 0 {
+			d.refresh()
+		}
 		return nil, true, nil
 	}
+	trigger := make(chan struct{}, 1)
 	handle := &core.ResourceEventHandle{
 		Interceptor: interceptor,
+		Trigger:     trigger,
 	}
-	svcLister, err := resStore.NewLister(d.store, &core.Service{}, handle)
+	svcLister, err := resStore.NewCachedLister(d.store, &core.Service{}, handle, d.cacheFile("services"))
 	if err != nil {
 		return err
 	}
 	d.svcLister = svcLister
+	go d.svcEvents.run(trigger)
 	return nil
 }
 
 func (d *daemon) parseContainerSvc(svc *core.Service) []*core.ContainerService {
 	cSvcs := make([]*core.ContainerService, 0)
-	if svc.Kind != "docker" {
+	if !svc.IsContainer() {
 		return cSvcs
 	}
 	ename := ""
@@ -144,6 +276,7 @@ func (d *daemon) parseContainerSvc(svc *core.Service) []*core.ContainerService {
 		if ed.Hostname != d.node.Hostname {
 			continue
 		}
+		misplaced := svc.MatchNode(d.nodeLabels())
 		if ed.Name == "" {
 			if ename != "" {
 				ed.Name = ename
@@ -168,8 +301,30 @@ func (d *daemon) parseContainerSvc(svc *core.Service) []*core.ContainerService {
 		if container.Labels == nil {
 			container.Labels = make(map[string]string)
 		}
-		container.Labels[core.HashLabelKey] = md5V(container)
+		if svc.IsJob() {
+			//任务退出后由worker 决定是否重新运行
+			container.Restart = "no"
+			container.SpecHash = md5V(container, svc.Kind, svc.Job, svc.CronJob)
+		} else {
+			container.SpecHash = md5V(container)
+		}
+		container.Labels[core.HashLabelKey] = d.configHash(container)
+		container.Kind = svc.Kind
+		container.Job = svc.Job
+		container.CronJob = svc.CronJob
+		container.DriftPolicy = svc.DriftPolicy
 		container.Labels[core.CreatorLabelKey] = "oars"
+		if svc.Revision != "" {
+			container.Labels[core.RevisionLabelKey] = svc.Revision
+		}
+		container.Hold = ed.Hold
+		if misplaced != nil {
+			//节点不再满足调度条件时保留已有容器，由drain 迁移
+			container.Hold = true
+			d.setMisplaced(container.Name, misplaced.Error())
+		} else {
+			d.misplaced.Delete(container.Name)
+		}
 		if container.NetworkMode == "" {
 			container.NetworkMode = d.node.ContainerNetwork
 		}
@@ -178,231 +333,351 @@ func (d *daemon) parseContainerSvc(svc *core.Service) []*core.ContainerService {
 	return cSvcs
 }
 
+//cacheContainers 收到事件或到达下次检查时间时刷新容器状态
 func (d *daemon) cacheContainers() {
-	t := time.NewTicker(time.Second * 2)
 	for {
+		t := time.NewTimer(d.refreshContainers())
 		select {
+		case <-d.stateTrigger:
 		case <-t.C:
-			//list docker containers and find container who status has updated
-			cs, err := d.List(context.Background())
-			if err != nil {
-				logrus.Error(err)
-				continue
+		case <-d.stopCh:
+			t.Stop()
+			return
+		}
+		t.Stop()
+	}
+}
+
+//refreshContainers 刷新容器状态并更新端点，返回距离下次刷新的时间
+func (d *daemon) refreshContainers() time.Duration {
+	//退出时不再按重启策略拉起容器
+	if d.stopping() {
+		return resyncPeriod
+	}
+	//list docker containers and find container who status has updated
+	cs, err := d.rt.List(context.Background())
+	if err != nil {
+		logrus.Error(err)
+		return retryDelay
+	}
+	edps := make(map[string]*core.Endpoint)
+	putEps := make([]*core.Endpoint, 0)
+	for _, cn := range cs {
+		if _, ok := cn.Labels[core.CreatorLabelKey]; !ok {
+			continue
+		}
+		edp := d.cantainerToEndpoint(cn)
+		d.setContainerDetail(edp, d.containerDetail(context.Background(), cn))
+		//替换容器前拉取镜像的进度
+		if v, ok := d.pulls.Load(d.containerNameByEdp(edp)); ok {
+			if detail := v.(*pullState).detail(); detail != "" {
+				edp.Status.StateDetail = detail
 			}
-			edps := make(map[string]*core.Endpoint)
-			putEps := make([]*core.Endpoint, 0)
-			for _, cn := range cs {
-				if _, ok := cn.Labels[core.CreatorLabelKey]; !ok {
-					continue
-				}
-				edp := d.cantainerToEndpoint(cn)
-				edps[edp.Status.ID] = edp
-				if oldedp, ok := d.endpointCache[edp.Status.ID]; ok {
-					if oldedp.Status.IP != edp.Status.IP || oldedp.Status.State != edp.Status.State || oldedp.Status.ID != edp.Status.ID {
-						edp.SetCreated(time.Now().Unix())
-						putEps = append(putEps, edp)
-					}
-					continue
-				}
+		}
+		edps[edp.Status.ID] = edp
+	}
+	d.syncRestarts(edps, time.Now())
+	d.pruneContainerStates(edps)
+	for _, edp := range edps {
+		d.setReadyCondition(edp)
+	}
+	d.syncJobs(edps)
+	//上次写入存储失败时重新写入全部端点
+	resync := d.edpUnsynced
+	for _, edp := range edps {
+		d.setJobStatus(edp)
+		if oldedp, ok := d.endpointCache[edp.Status.ID]; ok && !resync {
+			if oldedp.Status.IP != edp.Status.IP || oldedp.Status.State != edp.Status.State || oldedp.Status.ID != edp.Status.ID ||
+				oldedp.Status.IsReady() != edp.Status.IsReady() || !reflect.DeepEqual(oldedp.Status.Job, edp.Status.Job) ||
+				oldedp.Status.RestartCount != edp.Status.RestartCount || oldedp.Status.ExitCode != edp.Status.ExitCode {
+				edp.SetCreated(time.Now().Unix())
 				putEps = append(putEps, edp)
 			}
-			d.mu.Lock()
-			d.endpointCache = edps
-			d.mu.Unlock()
-			d.ready = true
-			//find new add endpoints and create these
-			d.svcCache.Range(func(k, v interface{}) bool {
-				svc := v.(*core.ContainerService)
-				edpExist := false
-				for _, edp := range edps {
-					if svc.Name == d.containerNameByEdp(edp) {
-						edpExist = true
-						break
-					}
-				}
-				if !edpExist {
-					putEps = append(putEps, d.cserviceToEndpoint(svc))
-				}
-				return true
-			})
-			//update endpoints status
-			for _, edp := range putEps {
-				_, err = d.edpstore.Put(context.Background(), edp, &core.PutOptions{})
-				if err != nil {
-					logrus.Error(err)
-				}
-			}
-			//gc endpoints that service had deleted
-			resources, _ := d.nodeEdpLister.List()
-			for _, resource := range resources {
-				endpoint := resource.(*core.Endpoint)
-				edpExist := false
-				d.svcCache.Range(func(k, v interface{}) bool {
-					svc := v.(*core.ContainerService)
-					if svc.Name == d.containerNameByEdp(endpoint) {
-						edpExist = true
-						return false
-					}
-					return true
-				})
-				if !edpExist {
-					for _, edp := range edps {
-						if d.containerNameByEdp(endpoint) == d.containerNameByEdp(edp) {
-							edpExist = true
-							break
-						}
-					}
-				}
-				if !edpExist {
-					err = d.edpstore.Delete(context.Background(), endpoint, &core.DeleteOptions{})
-					if err != nil {
-						logrus.Error(err)
-					}
-					d.delEvent(endpoint, "", "")
-				}
-			}
+			continue
 		}
+		putEps = append(putEps, edp)
 	}
-}
-
-func (d *daemon) syncDockerSvc() error {
 	d.mu.Lock()
-	svcs := make([]*core.ContainerService, 0)
+	d.endpointCache = edps
+	d.ready = true
+	d.mu.Unlock()
+	d.syncProbes(edps)
+	//find new add endpoints and create these
 	d.svcCache.Range(func(k, v interface{}) bool {
-		svcs = append(svcs, v.(*core.ContainerService))
-		return true
-	})
-	delList := make([]*core.Endpoint, 0)
-	for _, edp := range d.endpointCache {
+		svc := v.(*core.ContainerService)
 		edpExist := false
-		for _, svc := range svcs {
+		for _, edp := range edps {
 			if svc.Name == d.containerNameByEdp(edp) {
 				edpExist = true
 				break
 			}
-
 		}
 		if !edpExist {
-			delList = append(delList, edp)
+			edp := d.cserviceToEndpoint(svc)
+			d.setJobStatus(edp)
+			putEps = append(putEps, edp)
+		}
+		return true
+	})
+	//update endpoints status
+	d.edpUnsynced = false
+	for _, edp := range putEps {
+		_, err = d.edpstore.Put(context.Background(), edp, &core.PutOptions{})
+		if err != nil {
+			logrus.Error(err)
+			d.edpUnsynced = true
 		}
 	}
-	addList := make([]*core.ContainerService, 0)
-	for _, svc := range svcs {
+	//gc endpoints that service had deleted
+	resources, _ := d.nodeEdpLister.List()
+	for _, resource := range resources {
+		endpoint := resource.(*core.Endpoint)
 		edpExist := false
-		for _, edp := range d.endpointCache {
-			if svc.Name == d.containerNameByEdp(edp) {
-				if svc.Labels[core.HashLabelKey] != edp.Labels[core.HashLabelKey] {
-					svc.ID = edp.Status.ID
+		d.svcCache.Range(func(k, v interface{}) bool {
+			svc := v.(*core.ContainerService)
+			if svc.Name == d.containerNameByEdp(endpoint) {
+				edpExist = true
+				return false
+			}
+			return true
+		})
+		if !edpExist {
+			for _, edp := range edps {
+				if d.containerNameByEdp(endpoint) == d.containerNameByEdp(edp) {
+					edpExist = true
 					break
 				}
-				edpExist = true
-				break
 			}
 		}
 		if !edpExist {
-			addList = append(addList, svc)
+			err = d.edpstore.Delete(context.Background(), endpoint, &core.DeleteOptions{})
+			if err != nil {
+				logrus.Error(err)
+			}
 		}
 	}
-	d.mu.Unlock()
-	ctx := context.Background()
+	//状态变化的容器重新同步
+	for _, edp := range putEps {
+		d.enqueue(d.containerNameByEdp(edp))
+	}
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svc := v.(*core.ContainerService)
+		if isJob(svc) && d.jobPending(svc) {
+			d.enqueue(svc.Name)
+		}
+		return true
+	})
+	if d.edpUnsynced {
+		return retryDelay
+	}
+	return d.nextRefresh(time.Now())
+}
 
-	//删除容器
-	delGw := new(sync.WaitGroup)
-	delGw.Add(len(delList))
-	for _, endpoint := range delList {
-		go func(edp *core.Endpoint) {
-			d.addEvent(edp, core.DeleteEventAction, core.InProgressEventStatus, "")
-			err := d.Remove(ctx, edp.Status.ID)
-			if err != nil {
-				if d.dockerError(err) != errNotFound {
-					logrus.Error(err)
-					d.addEvent(edp, core.DeleteEventAction, core.FailEventStatus, err.Error())
-				}
-			}
-			d.addEvent(edp, core.DeleteEventAction, core.SuccessEventStatus, "")
-			delGw.Done()
-		}(endpoint)
+//nextRefresh 距离下次需要刷新的时间，退避重启和任务调度到期时需要提前刷新
+func (d *daemon) nextRefresh(now time.Time) time.Duration {
+	next := now.Add(resyncPeriod)
+	earlier := func(t time.Time) {
+		if !t.IsZero() && t.Before(next) {
+			next = t
+		}
 	}
+	d.restarts.Range(func(k, v interface{}) bool {
+		if rs := v.(*restartState); rs.waiting {
+			earlier(rs.next)
+		}
+		return true
+	})
+	d.jobs.Range(func(k, v interface{}) bool {
+		st := v.(*jobState)
+		st.mu.Lock()
+		if st.schedule != nil {
+			earlier(st.nextRun)
+		}
+		if st.pending && st.next.After(now) {
+			earlier(st.next)
+		}
+		st.mu.Unlock()
+		return true
+	})
+	//到期未处理完成时避免频繁刷新
+	if delay := next.Sub(now); delay > 2*time.Second {
+		return delay
+	}
+	return 2 * time.Second
+}
 
-	//TODO 并发？
-	//创建容器
-	for _, svc := range addList {
-		//如果有旧容器，先删除
-		edp := d.cserviceToEndpoint(svc)
-		if svc.ID != "" {
-			d.addEvent(edp, core.DeleteEventAction, core.InProgressEventStatus, "")
-			err := d.Remove(ctx, svc.ID)
-			if err != nil {
-				if d.dockerError(err) != errNotFound {
-					logrus.Error(err)
-					d.addEvent(edp, core.DeleteEventAction, core.FailEventStatus, err.Error())
-					continue
-				}
-			}
-			d.addEvent(edp, core.DeleteEventAction, core.SuccessEventStatus, "")
+//containerServices 本节点的容器服务
+func (d *daemon) containerServices() []*core.ContainerService {
+	svcs := make([]*core.ContainerService, 0)
+	d.svcCache.Range(func(k, v interface{}) bool {
+		svcs = append(svcs, v.(*core.ContainerService))
+		return true
+	})
+	return svcs
+}
+
+//containerNames 需要同步的容器名，待删除的在前，其余按依赖排序
+func (d *daemon) containerNames() []string {
+	svcs := d.containerServices()
+	sorted, cyclic := sortByDependencies(svcs)
+	exist := make(map[string]bool)
+	for _, svc := range svcs {
+		exist[svc.Name] = true
+	}
+	names := make([]string, 0, len(svcs))
+	d.mu.Lock()
+	for _, edp := range d.endpointCache {
+		if name := d.containerNameByEdp(edp); !exist[name] {
+			exist[name] = true
+			names = append(names, name)
 		}
+	}
+	d.mu.Unlock()
+	for _, svc := range append(sorted, cyclic...) {
+		names = append(names, svc.Name)
+	}
+	return names
+}
 
-		//vault
-		if d.vault != nil {
-			for i, v := range svc.Environment {
-				kv := strings.Split(v, "=")
-				if len(kv) < 2 {
-					continue
-				}
-				if strings.HasPrefix(kv[1], "$oars_vault:") {
-					keys := strings.Split(kv[1], ":")
-					if len(keys) != 3 {
-						continue
-					}
-					value, _ := d.vault.Get(keys[1], keys[2])
-					svc.Environment[i] = kv[0] + "=" + value
-				}
-			}
+//syncContainer 使容器与服务定义一致，返回错误时由队列限速重试
+func (d *daemon) syncContainer(name string) error {
+	ctx := context.Background()
+	d.mu.Lock()
+	svcs := d.containerServices()
+	var svc *core.ContainerService
+	for _, s := range svcs {
+		if s.Name == name {
+			svc = s
+			break
+		}
+	}
+	var key string
+	var edp *core.Endpoint
+	for k, e := range d.endpointCache {
+		if d.containerNameByEdp(e) == name {
+			key, edp = k, e
+			break
+		}
+	}
+	if svc == nil {
+		d.mu.Unlock()
+		d.waiting.Delete(name)
+		d.misplaced.Delete(name)
+		if edp == nil {
+			return nil
 		}
+		return d.removeContainer(ctx, key, edp)
+	}
+	if v, ok := d.misplaced.Load(name); ok {
+		d.mu.Unlock()
+		d.reportMisplaced(svc, edp, v.(*placement))
+		return nil
+	}
+	if edp != nil {
+		if svc.Labels[core.HashLabelKey] == edp.Labels[core.HashLabelKey] || svc.Hold {
+			//未变化，或滚动更新中等待controller 放开
+			d.mu.Unlock()
+			return nil
+		}
+		svc.ID = edp.Status.ID
+	}
+	d.mu.Unlock()
+	if !d.jobPending(svc) {
+		return nil
+	}
+	_, cyclic := sortByDependencies(svcs)
+	for _, c := range cyclic {
+		if c == svc {
+			d.setWaiting(d.cserviceToEndpoint(svc), svc.Name, core.FailEventStatus,
+				"dependency cycle: "+strings.Join(svc.DependsOn, ","))
+			return nil
+		}
+	}
+	return d.createContainer(ctx, svc, key)
+}
 
-		//registry auth
-		if svc.ImagePullAuth == "" && d.sysConfig != nil {
-			for _, registry := range d.sysConfig.ImageRegistry {
-				if strings.HasPrefix(svc.Image, registry.Address+"/") {
-					svc.ImagePullAuth = registryAuth(registry.Username, registry.Password)
-				}
-			}
+//removeContainer 删除服务已不存在的容器
+func (d *daemon) removeContainer(ctx context.Context, key string, edp *core.Endpoint) error {
+	d.addEvent(edp, core.DeleteEventAction, core.InProgressEventStatus, "")
+	err := d.rt.Remove(ctx, edp.Status.ID)
+	if err != nil && !d.rt.IsNotFound(err) {
+		d.addEvent(edp, core.DeleteEventAction, core.FailEventStatus, err.Error())
+		return err
+	}
+	d.removeSecretFiles(edp)
+	d.mu.Lock()
+	delete(d.endpointCache, key)
+	d.mu.Unlock()
+	d.addEvent(edp, core.DeleteEventAction, core.SuccessEventStatus, "")
+	return nil
+}
+
+//createContainer 拉取镜像并创建启动容器，有旧容器时先删除
+func (d *daemon) createContainer(ctx context.Context, svc *core.ContainerService, key string) error {
+	edp := d.cserviceToEndpoint(svc)
+	//等待依赖就绪，依赖端点变化时重新同步
+	if deps := d.unreadyDependencies(svc); len(deps) > 0 {
+		d.setWaiting(edp, svc.Name, core.InProgressEventStatus, "waiting for "+strings.Join(deps, ","))
+		return nil
+	}
+	d.waiting.Delete(svc.Name)
+	//pull image，失败后按指数间隔重试
+	if backoff := d.pullBackoff(svc); backoff > 0 {
+		d.enqueueAfter(svc.Name, backoff)
+		return nil
+	}
+	d.addEvent(edp, core.ImagePullEventAction, core.InProgressEventStatus, "")
+	err := d.ImagePull(ctx, svc)
+	if err != nil {
+		logrus.Error(err)
+		backoff := d.pullFailed(svc, err)
+		d.addReasonEvent(edp, core.ImagePullEventAction, core.FailEventStatus, core.BackOffEventReason, fmt.Sprintf("%s, retry in %s", err.Error(), backoff))
+		d.putPullStatus(svc)
+		d.enqueueAfter(svc.Name, backoff)
+		return nil
+	}
+	d.pullSucceeded(svc)
+	d.addEvent(edp, core.ImagePullEventAction, core.SuccessEventStatus, "")
+
+	//镜像就绪后再删除旧容器，拉取失败时旧容器继续运行
+	if svc.ID != "" {
+		d.addEvent(edp, core.DeleteEventAction, core.InProgressEventStatus, "")
+		err := d.rt.Remove(ctx, svc.ID)
+		if err != nil && !d.rt.IsNotFound(err) {
+			d.addEvent(edp, core.DeleteEventAction, core.FailEventStatus, err.Error())
+			return err
 		}
-		//pull image
-		d.addEvent(edp, core.ImagePullEventAction, core.InProgressEventStatus, "")
-		err := d.ImagePull(ctx, svc)
-		if err != nil {
-			logrus.Error(err)
-			d.addEvent(edp, core.ImagePullEventAction, core.FailEventStatus, err.Error())
-			continue
+		if key != "" {
+			d.mu.Lock()
+			delete(d.endpointCache, key)
+			d.mu.Unlock()
 		}
-		d.addEvent(edp, core.ImagePullEventAction, core.SuccessEventStatus, "")
+		d.addEvent(edp, core.DeleteEventAction, core.SuccessEventStatus, "")
+	}
 
-		//create
-		d.addEvent(edp, core.CreateEventAction, core.InProgressEventStatus, "")
-		id, err := d.Create(ctx, svc)
+	//create
+	d.addEvent(edp, core.CreateEventAction, core.InProgressEventStatus, "")
+	id, err := d.Create(ctx, svc)
+	if err != nil {
+		d.addEvent(edp, core.CreateEventAction, core.FailEventStatus, err.Error())
+		return err
+	}
+	d.addEvent(edp, core.CreateEventAction, core.SuccessEventStatus, "")
+	d.recordDriftBaseline(ctx, id)
+	//start
+	go func() {
+		d.addEvent(edp, core.StartEventAction, core.InProgressEventStatus, "")
+		err := d.rt.Start(ctx, id)
 		if err != nil {
+			d.addEvent(edp, core.StartEventAction, core.FailEventStatus, err.Error())
 			logrus.Error(err)
-			d.addEvent(edp, core.CreateEventAction, core.FailEventStatus, err.Error())
-			continue
+			return
 		}
-		d.addEvent(edp, core.CreateEventAction, core.SuccessEventStatus, "")
-		//start
-		go func() {
-			d.addEvent(edp, core.StartEventAction, core.InProgressEventStatus, "")
-			err = d.Start(ctx, id)
-			if err != nil {
-				d.addEvent(edp, core.StartEventAction, core.FailEventStatus, err.Error())
-				logrus.Error(err)
-				return
-			}
-			d.addEvent(edp, core.StartEventAction, core.SuccessEventStatus, "")
-		}()
-		//防止新建容器未同步，导致重复创建
-		d.mu.Lock()
-		d.endpointCache[d.containerNameByEdp(edp)] = edp
-		d.mu.Unlock()
-	}
-	delGw.Wait()
+		d.addEvent(edp, core.StartEventAction, core.SuccessEventStatus, "")
+	}()
+	//防止新建容器未同步，导致重复创建
+	d.mu.Lock()
+	d.endpointCache[d.containerNameByEdp(edp)] = edp
+	d.mu.Unlock()
 	return nil
 }
@@ -0,0 +1,1022 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oars-sigs/oars-cloud/core"
+	resStore "github.com/oars-sigs/oars-cloud/pkg/store/resources"
+	"github.com/oars-sigs/oars-cloud/pkg/worker/metrics"
+)
+
+//fakeRuntime 内存中的运行时
+type fakeRuntime struct {
+	mu         sync.Mutex
+	seq        int
+	images     map[string]bool
+	containers map[string]*Container
+	exitCodes  map[string]int
+	restartCnt map[string]int //按重启策略重启的次数
+	pullErr    error
+	digests    map[string]string //仓库中镜像标签的digest
+	created    map[string]time.Time
+	execConn   ExecConn
+	execOpt    *core.EndpointExecOpt
+	archive    []byte //CopyFrom 返回、CopyTo 写入的tar 包
+	configs    map[string]*ContainerConfig
+	execCode   int //ExecRun 的退出码
+	execRuns   int
+	restarts   int //Restart 调用次数
+}
+
+func newFakeRuntime() *fakeRuntime {
+	return &fakeRuntime{
+		images:     make(map[string]bool),
+		containers: make(map[string]*Container),
+		exitCodes:  make(map[string]int),
+		restartCnt: make(map[string]int),
+		digests:    make(map[string]string),
+		created:    make(map[string]time.Time),
+		configs:    make(map[string]*ContainerConfig),
+	}
+}
+
+func (r *fakeRuntime) Create(ctx context.Context, spec *ContainerSpec) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.containers {
+		if c.Name == spec.Name {
+			return "", fmt.Errorf("container name %s already in use", spec.Name)
+		}
+	}
+	r.seq++
+	id := fmt.Sprintf("c%d", r.seq)
+	labels := make(map[string]string)
+	for k, v := range spec.Labels {
+		labels[k] = v
+	}
+	r.containers[id] = &Container{
+		ID:       id,
+		Name:     spec.Name,
+		Image:    spec.Image,
+		Labels:   labels,
+		State:    "created",
+		Networks: map[string]ContainerNetwork{"bridge": {IP: "172.17.0.2"}},
+	}
+	cfg := &ContainerConfig{
+		Image:  spec.Image,
+		Env:    append([]string{"PATH=/usr/bin"}, spec.Environment...),
+		Labels: labels,
+		Mounts: spec.Mounts,
+	}
+	if spec.Resources != nil {
+		cfg.Memory = spec.Resources.MemoryBytes()
+		cfg.CPUQuota = int64(spec.Resources.CPU * float64(100000))
+	}
+	r.configs[id] = cfg
+	return id, nil
+}
+
+func (r *fakeRuntime) setState(id, state string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return errNoSuchContainer
+	}
+	c.State = state
+	return nil
+}
+
+func (r *fakeRuntime) Start(ctx context.Context, id string) error {
+	return r.setState(id, "running")
+}
+
+func (r *fakeRuntime) Stop(ctx context.Context, id string, timeout time.Duration) error {
+	return r.setState(id, "exited")
+}
+
+func (r *fakeRuntime) Restart(ctx context.Context, id string) error {
+	r.mu.Lock()
+	r.restarts++
+	r.mu.Unlock()
+	return r.setState(id, "running")
+}
+
+//exit 模拟容器退出
+func (r *fakeRuntime) exit(id string, code int) {
+	r.mu.Lock()
+	r.exitCodes[id] = code
+	r.mu.Unlock()
+	r.setState(id, "exited")
+}
+
+//crash 模拟容器退出后运行时按重启策略等待重启
+func (r *fakeRuntime) crash(id string, code int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exitCodes[id] = code
+	r.restartCnt[id]++
+	c := r.containers[id]
+	c.State = "restarting"
+	c.Status = fmt.Sprintf("Restarting (%d)", r.restartCnt[id])
+}
+
+func (r *fakeRuntime) InspectConfig(ctx context.Context, id string) (*ContainerConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg, ok := r.configs[id]
+	if !ok {
+		return nil, errNoSuchContainer
+	}
+	return cfg, nil
+}
+
+func (r *fakeRuntime) Events(ctx context.Context, out func(ContainerEvent)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (r *fakeRuntime) Inspect(ctx context.Context, id string) (*ContainerState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.containers[id]
+	if !ok {
+		return nil, errNoSuchContainer
+	}
+	return &ContainerState{Status: c.State, ExitCode: r.exitCodes[id], RestartCount: r.restartCnt[id]}, nil
+}
+
+func (r *fakeRuntime) Remove(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.containers[id]; !ok {
+		return errNoSuchContainer
+	}
+	delete(r.containers, id)
+	return nil
+}
+
+func (r *fakeRuntime) List(ctx context.Context) ([]Container, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]Container, 0, len(r.containers))
+	for _, c := range r.containers {
+		res = append(res, *c)
+	}
+	return res, nil
+}
+
+func (r *fakeRuntime) ImagePull(ctx context.Context, image, auth string, progress func(PullProgress)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pullErr != nil {
+		return r.pullErr
+	}
+	r.images[image] = true
+	return nil
+}
+
+func (r *fakeRuntime) ImageDigest(ctx context.Context, image string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if digest, ok := r.digests[image]; ok {
+		return image + "@" + digest, nil
+	}
+	return image + "@sha256:0000", nil
+}
+
+func (r *fakeRuntime) RemoteDigest(ctx context.Context, image, auth string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if digest, ok := r.digests[image]; ok {
+		return digest, nil
+	}
+	return "sha256:0000", nil
+}
+
+func (r *fakeRuntime) ImageExist(ctx context.Context, image string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.images[image], nil
+}
+
+func (r *fakeRuntime) ImageList(ctx context.Context) ([]Image, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	imgs := make([]Image, 0)
+	for image, ok := range r.images {
+		if ok {
+			imgs = append(imgs, Image{ID: "sha256:" + image, RepoTags: []string{image}, Size: 100, Created: r.created[image]})
+		}
+	}
+	return imgs, nil
+}
+
+func (r *fakeRuntime) ImageRemove(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.images, strings.TrimPrefix(id, "sha256:"))
+	return nil
+}
+
+func (r *fakeRuntime) Stats(ctx context.Context) ([]*metrics.ContainerMetrics, error) {
+	return nil, nil
+}
+
+func (r *fakeRuntime) ImageRoot(ctx context.Context) (string, error) {
+	return "/", nil
+}
+
+func (r *fakeRuntime) LogStream(ctx context.Context, id string, opt *core.EndpointLogOpt, out func(*core.EndpointLogLine) error) error {
+	return nil
+}
+
+func (r *fakeRuntime) Log(ctx context.Context, id, tail, since string) (string, error) {
+	return "", nil
+}
+
+func (r *fakeRuntime) Exec(ctx context.Context, id string, opt *core.EndpointExecOpt) (ExecConn, error) {
+	if r.execConn == nil {
+		return nil, errors.New("not supported")
+	}
+	r.execOpt = opt
+	return r.execConn, nil
+}
+
+func (r *fakeRuntime) ExecRun(ctx context.Context, id string, cmd []string) (int, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.execRuns++
+	return r.execCode, "", nil
+}
+
+func (r *fakeRuntime) CopyFrom(ctx context.Context, id, path string) (io.ReadCloser, int64, error) {
+	if r.archive == nil {
+		return nil, 0, errors.New("no such file")
+	}
+	return ioutil.NopCloser(bytes.NewReader(r.archive)), int64(len(r.archive)), nil
+}
+
+func (r *fakeRuntime) CopyTo(ctx context.Context, id, path string, content io.Reader) error {
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	r.archive = data
+	return nil
+}
+
+func (r *fakeRuntime) CreateNetwork(ctx context.Context, name, driver, subnet string) error {
+	return nil
+}
+
+func (r *fakeRuntime) ListNetworks(ctx context.Context) ([]string, error) {
+	return []string{"bridge"}, nil
+}
+
+var errNoSuchContainer = errors.New("no such container")
+
+func (r *fakeRuntime) IsNotFound(err error) bool {
+	return err == errNoSuchContainer
+}
+
+//fakeStore 丢弃写入的资源存储
+type fakeStore struct{}
+
+func (fakeStore) List(ctx context.Context, arg core.Resource, opts *core.ListOptions) ([]core.Resource, error) {
+	return nil, nil
+}
+
+func (fakeStore) ListWithRev(ctx context.Context, arg core.Resource, opts *core.ListOptions) ([]core.Resource, int64, error) {
+	return nil, 0, nil
+}
+
+func (fakeStore) Get(ctx context.Context, arg core.Resource, opts *core.GetOptions) (core.Resource, error) {
+	return arg, nil
+}
+
+func (fakeStore) GetWithRev(ctx context.Context, arg core.Resource, opts *core.GetOptions) (core.Resource, int64, error) {
+	return arg, 0, nil
+}
+
+func (fakeStore) Put(ctx context.Context, arg core.Resource, opts *core.PutOptions) (core.Resource, error) {
+	return arg, nil
+}
+
+func (fakeStore) Delete(ctx context.Context, arg core.Resource, opts *core.DeleteOptions) error {
+	return nil
+}
+
+//recordStore 记录写入的资源
+type recordStore struct {
+	fakeStore
+	mu  sync.Mutex
+	res map[string]core.Resource
+}
+
+func (s *recordStore) Put(ctx context.Context, arg core.Resource, opts *core.PutOptions) (core.Resource, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.res[arg.ResourceKey()] = arg
+	return arg, nil
+}
+
+func (s *recordStore) get(key string) *core.Endpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.res[key]; ok {
+		return r.(*core.Endpoint)
+	}
+	return nil
+}
+
+//lockKV 只实现TryLock，模拟集群内共享的锁
+type lockKV struct {
+	core.KVStore
+	mu    sync.Mutex
+	locks map[string]bool
+}
+
+func newLockKV() *lockKV {
+	return &lockKV{locks: make(map[string]bool)}
+}
+
+func (s *lockKV) TryLock(ctx context.Context, kv core.KV, lease int64) (core.KVRegister, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.locks[kv.Key] {
+		return nil, nil
+	}
+	s.locks[kv.Key] = true
+	return &kvLock{kv: s, key: kv.Key, done: make(chan struct{})}, nil
+}
+
+type kvLock struct {
+	kv   *lockKV
+	key  string
+	once sync.Once
+	done chan struct{}
+}
+
+func (l *kvLock) Close() error {
+	l.once.Do(func() {
+		l.kv.mu.Lock()
+		delete(l.kv.locks, l.key)
+		l.kv.mu.Unlock()
+		close(l.done)
+	})
+	return nil
+}
+
+func (l *kvLock) Done() <-chan struct{} {
+	return l.done
+}
+
+func newFakeDaemon(rt Runtime) *daemon {
+	return &daemon{
+		rt:            rt,
+		store:         newLockKV(),
+		node:          &core.NodeConfig{Hostname: "node1", IP: "10.0.0.1"},
+		mu:            new(sync.Mutex),
+		endpointCache: make(map[string]*core.Endpoint),
+		edpstore:      fakeStore{},
+		eventstore:    fakeStore{},
+	}
+}
+
+//syncContainers 模拟cacheContainers 刷新端点缓存
+func syncContainers(t *testing.T, d *daemon) {
+	cs, err := d.rt.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	edps := make(map[string]*core.Endpoint)
+	for _, cn := range cs {
+		edp := d.cantainerToEndpoint(cn)
+		edps[edp.Status.ID] = edp
+	}
+	d.mu.Lock()
+	d.endpointCache = edps
+	d.mu.Unlock()
+}
+
+//syncAll 按队列顺序同步全部容器
+func syncAll(t *testing.T, d *daemon) {
+	for _, name := range d.containerNames() {
+		if err := d.syncContainer(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncDockerSvc(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	newSvc := func(hash string, hold bool) *core.ContainerService {
+		return &core.ContainerService{
+			Name:  "oars_default_web_web-0",
+			Image: "nginx:latest",
+			Labels: map[string]string{
+				core.CreatorLabelKey: "oars",
+				core.HashLabelKey:    hash,
+			},
+			Hold: hold,
+		}
+	}
+	containers := func() []Container {
+		cs, _ := rt.List(context.Background())
+		return cs
+	}
+
+	d.svcCache.Store("web", newSvc("v1", false))
+	syncAll(t, d)
+	cs := containers()
+	if len(cs) != 1 || cs[0].Labels[core.HashLabelKey] != "v1" || !rt.images["nginx:latest"] {
+		t.Fatalf("expect container created with v1, got %+v", cs)
+	}
+
+	//配置不变，不应重建
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs2 := containers(); len(cs2) != 1 || cs2[0].ID != cs[0].ID {
+		t.Fatalf("container should not be recreated, got %+v", cs2)
+	}
+
+	//被hold 时不重建
+	d.svcCache.Store("web", newSvc("v2", true))
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs2 := containers(); len(cs2) != 1 || cs2[0].ID != cs[0].ID {
+		t.Fatalf("held container should not be recreated, got %+v", cs2)
+	}
+
+	//配置变更，替换容器
+	d.svcCache.Store("web", newSvc("v2", false))
+	syncContainers(t, d)
+	syncAll(t, d)
+	cs = containers()
+	if len(cs) != 1 || cs[0].Labels[core.HashLabelKey] != "v2" {
+		t.Fatalf("expect container replaced with v2, got %+v", cs)
+	}
+
+	//服务删除，清理容器
+	d.svcCache.Delete("web")
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs = containers(); len(cs) != 0 {
+		t.Fatalf("expect container removed, got %+v", cs)
+	}
+}
+
+func TestSyncMisplaced(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	svc := &core.Service{
+		ResourceMeta: &core.ResourceMeta{Name: "web", Namespace: "default"},
+		Kind:         core.DockerServiceKind,
+		Endpoints:    []core.ServiceEndpoint{{Name: "web-0", Hostname: "node1"}},
+		Docker:       core.ContainerService{Image: "nginx:latest"},
+	}
+	parse := func() {
+		for _, c := range d.parseContainerSvc(svc) {
+			d.svcCache.Store(c.Name, c)
+		}
+	}
+	containers := func() []Container {
+		cs, _ := rt.List(context.Background())
+		return cs
+	}
+	parse()
+	syncAll(t, d)
+	cs := containers()
+	if len(cs) != 1 {
+		t.Fatalf("expect container created, got %+v", cs)
+	}
+
+	//节点标签不再满足nodeSelector，保留已有容器
+	svc.NodeSelector = map[string]string{"disk": "ssd"}
+	parse()
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs2 := containers(); len(cs2) != 1 || cs2[0].ID != cs[0].ID {
+		t.Fatalf("misplaced container should be kept, got %+v", cs2)
+	}
+
+	//不再创建新容器
+	rt.Remove(context.Background(), cs[0].ID)
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs2 := containers(); len(cs2) != 0 {
+		t.Fatalf("misplaced container should not be created, got %+v", cs2)
+	}
+
+	d.node.Labels = map[string]string{"disk": "ssd"}
+	parse()
+	syncAll(t, d)
+	if cs2 := containers(); len(cs2) != 1 {
+		t.Fatalf("expect container created after node matches, got %+v", cs2)
+	}
+}
+
+func TestSyncJob(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	d.svcCache.Store("migrate", &core.ContainerService{
+		Name:  "oars_default_migrate_migrate-0",
+		Image: "migrate:latest",
+		Kind:  core.JobServiceKind,
+		Job:   &core.JobSpec{Completions: 2},
+		Labels: map[string]string{
+			core.CreatorLabelKey: "oars",
+			core.HashLabelKey:    "v1",
+		},
+	})
+	//创建容器，模拟运行结束，推进任务状态
+	run := func(code int) *core.JobStatus {
+		syncContainers(t, d)
+		syncAll(t, d)
+		cs, _ := rt.List(context.Background())
+		if len(cs) != 1 {
+			t.Fatalf("expect one job container, got %+v", cs)
+		}
+		//等待异步启动完成
+		for i := 0; i < 100 && cs[0].State != "running"; i++ {
+			time.Sleep(10 * time.Millisecond)
+			cs, _ = rt.List(context.Background())
+		}
+		rt.exit(cs[0].ID, code)
+		syncContainers(t, d)
+		d.syncJobs(d.endpointCache)
+		edp := d.cantainerToEndpoint(cs[0])
+		d.setJobStatus(edp)
+		return edp.Status.Job
+	}
+
+	status := run(1)
+	if status.Failed != 1 || status.Phase != core.JobPending {
+		t.Fatalf("expect one failure, got %+v", status)
+	}
+	//等待重试间隔
+	v, _ := d.jobs.Load("oars_default_migrate_migrate-0")
+	v.(*jobState).next = time.Time{}
+
+	status = run(0)
+	if status.Succeeded != 1 || status.Phase != core.JobPending {
+		t.Fatalf("expect one success, got %+v", status)
+	}
+	status = run(0)
+	if status.Succeeded != 2 || status.Phase != core.JobComplete {
+		t.Fatalf("expect job complete, got %+v", status)
+	}
+
+	//完成后保留容器，不再创建
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs, _ := rt.List(context.Background()); len(cs) != 1 || cs[0].State != "exited" {
+		t.Fatalf("completed job should keep its exited container, got %+v", cs)
+	}
+}
+
+//fakeLister 固定资源列表
+type fakeLister []core.Resource
+
+func (l fakeLister) List() ([]core.Resource, bool) {
+	return l, true
+}
+
+func (l fakeLister) ListWithRev() ([]core.Resource, int64, bool) {
+	return l, 0, true
+}
+
+func TestSyncCronJobWithoutSpec(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	d.svcCache.Store("backup", &core.ContainerService{
+		Name:  "oars_default_backup_backup-0",
+		Image: "backup:latest",
+		Kind:  core.CronJobServiceKind,
+		Labels: map[string]string{
+			core.CreatorLabelKey: "oars",
+			core.HashLabelKey:    "v1",
+		},
+	})
+	syncContainers(t, d)
+	syncAll(t, d)
+	d.syncJobs(map[string]*core.Endpoint{})
+	if cs, _ := rt.List(context.Background()); len(cs) != 0 {
+		t.Fatalf("cronjob without schedule should not run, got %+v", cs)
+	}
+}
+
+func TestSyncDependsOn(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	newSvc := func(name string, deps ...string) *core.ContainerService {
+		return &core.ContainerService{
+			Name:      "oars_default_" + name,
+			Image:     "app:latest",
+			DependsOn: deps,
+			Labels: map[string]string{
+				core.CreatorLabelKey: "oars",
+				core.HashLabelKey:    "v1",
+			},
+		}
+	}
+	d.svcCache.Store("app-1", newSvc("app_app-1", "app-0", "db.default"))
+	d.svcCache.Store("app-0", newSvc("app_app-0"))
+	d.svcCache.Store("a", newSvc("loop_a", "b"))
+	d.svcCache.Store("b", newSvc("loop_b", "a"))
+	d.svcLister = fakeLister{&core.Service{ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "db"}}}
+	d.edpLister = fakeLister{}
+	names := func() map[string]bool {
+		cs, _ := rt.List(context.Background())
+		res := make(map[string]bool)
+		for _, c := range cs {
+			res[c.Name] = true
+		}
+		return res
+	}
+
+	syncAll(t, d)
+	if cs := names(); len(cs) != 1 || !cs["oars_default_app_app-0"] {
+		t.Fatalf("expect only app-0 created, got %v", cs)
+	}
+
+	//依赖就绪后创建
+	readyEdp := func(service, name string) *core.Endpoint {
+		return &core.Endpoint{
+			ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: name},
+			Service:      service,
+			Status:       &core.EndpointStatus{State: "running"},
+		}
+	}
+	d.edpLister = fakeLister{readyEdp("app", "app-0")}
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs := names(); len(cs) != 1 {
+		t.Fatalf("app-1 should wait for db.default, got %v", cs)
+	}
+	d.edpLister = fakeLister{readyEdp("app", "app-0"), readyEdp("db", "db-0")}
+	syncContainers(t, d)
+	syncAll(t, d)
+	if cs := names(); len(cs) != 2 || !cs["oars_default_app_app-1"] {
+		t.Fatalf("expect app-1 created, got %v", cs)
+	}
+	if _, ok := d.waiting.Load("oars_default_loop_a"); !ok {
+		t.Fatal("expect dependency cycle recorded")
+	}
+}
+
+func TestSyncConfigMaps(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	dir, err := ioutil.TempDir("", "oars-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d.node.WorkDir = dir
+	cfg := &core.ConfigMap{
+		ResourceMeta: &core.ResourceMeta{Namespace: "default", Name: "app"},
+		Data:         map[string]string{"level": "info", "app.yaml": "a: 1"},
+	}
+	d.cfgLister = fakeLister{cfg}
+	svc := &core.ContainerService{
+		Name:     "oars_default_app_app-0",
+		Image:    "app:latest",
+		SpecHash: "v1",
+		ConfigMapRefs: []core.ConfigMapRef{
+			{Name: "app", Key: "level", Env: "LOG_LEVEL"},
+			{Name: "app", Path: "/etc/app"},
+		},
+		Labels: map[string]string{core.CreatorLabelKey: "oars"},
+	}
+	svc.Labels[core.HashLabelKey] = d.configHash(svc)
+	d.svcCache.Store("app", svc)
+	syncAll(t, d)
+	file := d.node.WorkDir + "/configmap/default/app/.refs/app/app.yaml"
+	if data, err := ioutil.ReadFile(file); err != nil || string(data) != "a: 1" {
+		t.Fatalf("expect configmap file written, got %q %v", data, err)
+	}
+
+	//只改挂载的文件，不重建
+	cfg.Data = map[string]string{"level": "info", "app.yaml": "a: 2"}
+	d.syncConfigMaps()
+	if data, _ := ioutil.ReadFile(file); string(data) != "a: 2" {
+		t.Fatalf("expect configmap file updated, got %q", data)
+	}
+	syncContainers(t, d)
+	syncAll(t, d)
+	cs, _ := rt.List(context.Background())
+	if len(cs) != 1 || cs[0].Labels[core.HashLabelKey] != svc.Labels[core.HashLabelKey] {
+		t.Fatalf("container should not be recreated, got %+v", cs)
+	}
+
+	//环境变量变更，重建容器
+	cfg.Data = map[string]string{"level": "debug", "app.yaml": "a: 2"}
+	done := make(chan struct{})
+	timeout := time.After(10 * time.Second)
+	go func() {
+		d.syncConfigMaps()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			cs, _ := rt.List(context.Background())
+			if len(cs) != 1 || cs[0].Labels[core.HashLabelKey] == svc.Labels[core.HashLabelKey] {
+				t.Fatalf("expect container recreated, got %+v", cs)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+			syncContainers(t, d)
+			syncAll(t, d)
+			cs, _ := rt.List(context.Background())
+			for _, c := range cs {
+				rt.Start(context.Background(), c.ID)
+			}
+			syncContainers(t, d)
+		case <-timeout:
+			t.Fatal("timeout waiting for configmap rollout")
+		}
+	}
+}
+
+func TestRefreshContainersReady(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	d.svcCache.Store("web", &core.ContainerService{
+		Name:   "oars_default_web_web-0",
+		Image:  "nginx:latest",
+		Labels: map[string]string{core.CreatorLabelKey: "oars", core.HashLabelKey: "v1"},
+	})
+	syncAll(t, d)
+	if d.containersReady() {
+		t.Fatal("ready before containers cached")
+	}
+	d.nodeEdpLister = fakeLister{}
+	//刷新容器与等待就绪并发进行，需通过-race 检查
+	done := make(chan struct{})
+	go func() {
+		d.refreshContainers()
+		close(done)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !d.containersReady() {
+		if time.Now().After(deadline) {
+			t.Fatal("containers not cached")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	<-done
+}
+
+func TestRollingRecreate(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	old := configRolloutTimeout
+	configRolloutTimeout = 3 * time.Second
+	defer func() { configRolloutTimeout = old }()
+	restarts := make([]recreate, 0)
+	for _, name := range []string{"a", "b"} {
+		svc := &core.ContainerService{
+			Name:     "oars_default_" + name + "_" + name + "-0",
+			Image:    name + ":latest",
+			SpecHash: "v2",
+			Labels:   map[string]string{core.CreatorLabelKey: "oars", core.HashLabelKey: "v1"},
+		}
+		d.svcCache.Store(name, svc)
+		restarts = append(restarts, recreate{name, svc})
+	}
+	syncAll(t, d)
+	cs, _ := rt.List(context.Background())
+	for _, c := range cs {
+		rt.Start(context.Background(), c.ID)
+	}
+	syncContainers(t, d)
+
+	done := make(chan struct{})
+	go func() {
+		d.rollingRecreate(restarts, core.ConfigEventAction, "recreating")
+		close(done)
+	}()
+	//a 的新容器一直未就绪，不影响b 的重建
+	deadline := time.After(2 * time.Second)
+	for {
+		syncContainers(t, d)
+		syncAll(t, d)
+		cs, _ := rt.List(context.Background())
+		ready := false
+		for _, c := range cs {
+			if c.Name == "oars_default_b_b-0" && c.Labels[core.HashLabelKey] == "v2" {
+				rt.Start(context.Background(), c.ID)
+				ready = true
+			}
+		}
+		if ready {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("b should be recreated while a is not ready")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("rolling recreate should stop at the shared deadline")
+	}
+}
+
+func TestRollingRecreateLock(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	old := recreateLockRetry
+	recreateLockRetry = 10 * time.Millisecond
+	defer func() { recreateLockRetry = old }()
+	svc := &core.ContainerService{
+		Name:     "oars_default_web_web-0",
+		Image:    "nginx:latest",
+		SpecHash: "v2",
+		Labels:   map[string]string{core.CreatorLabelKey: "oars", core.HashLabelKey: "v1"},
+	}
+	d.svcCache.Store("web", svc)
+	syncAll(t, d)
+	cs, _ := rt.List(context.Background())
+	rt.Start(context.Background(), cs[0].ID)
+	syncContainers(t, d)
+
+	//其他节点正在重建该服务
+	other, _ := resStore.TryLock(d.store, d.recreateLock(svc), recreateLockLease)
+	if other == nil {
+		t.Fatal("lock not acquired")
+	}
+	done := make(chan struct{})
+	go func() {
+		d.rollingRecreate([]recreate{{"web", svc}}, core.ConfigEventAction, "recreating")
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	syncAll(t, d)
+	if cs, _ := rt.List(context.Background()); cs[0].Labels[core.HashLabelKey] != "v1" {
+		t.Fatal("recreated while another node holds the lock")
+	}
+
+	//其他节点完成后重建
+	other.Close()
+	deadline := time.After(2 * time.Second)
+	for {
+		syncContainers(t, d)
+		syncAll(t, d)
+		cs, _ := rt.List(context.Background())
+		if len(cs) == 1 && cs[0].Labels[core.HashLabelKey] == "v2" {
+			rt.Start(context.Background(), cs[0].ID)
+			syncContainers(t, d)
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("not recreated after lock released")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rolling recreate did not finish")
+	}
+	if l, _ := resStore.TryLock(d.store, d.recreateLock(svc), recreateLockLease); l == nil {
+		t.Fatal("recreate lock not released")
+	}
+}
+
+func TestImagePullBackoff(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	svc := &core.ContainerService{
+		Name:  "oars_default_web_web-0",
+		Image: "nginx:latest",
+		Labels: map[string]string{
+			core.CreatorLabelKey: "oars",
+			core.HashLabelKey:    "v1",
+		},
+	}
+	d.svcCache.Store("web", svc)
+	rt.pullErr = errors.New("manifest unknown")
+	syncAll(t, d)
+	if detail := d.cserviceToEndpoint(svc).Status.StateDetail; !strings.HasPrefix(detail, "ImagePullBackOff") {
+		t.Fatalf("expect ImagePullBackOff, got %q", detail)
+	}
+	//等待重试间隔内不再拉取
+	rt.pullErr = nil
+	syncAll(t, d)
+	if cs, _ := rt.List(context.Background()); len(cs) != 0 {
+		t.Fatalf("expect pull backoff, got %+v", cs)
+	}
+	v, _ := d.pulls.Load(svc.Name)
+	v.(*pullState).next = time.Time{}
+	syncAll(t, d)
+	cs, _ := rt.List(context.Background())
+	if len(cs) != 1 {
+		t.Fatalf("expect container created after backoff, got %+v", cs)
+	}
+	syncContainers(t, d)
+	if edp := d.cantainerToEndpoint(cs[0]); edp.Status.ImageDigest != "nginx:latest@sha256:0000" {
+		t.Fatalf("expect image digest recorded, got %q", edp.Status.ImageDigest)
+	}
+
+	//新镜像拉取失败时保留旧容器，退避原因写入端点
+	store := &recordStore{res: make(map[string]core.Resource)}
+	d.edpstore = store
+	d.svcCache.Store("web", &core.ContainerService{
+		Name:   svc.Name,
+		Image:  "nginx:bad",
+		Labels: map[string]string{core.CreatorLabelKey: "oars", core.HashLabelKey: "v2"},
+	})
+	rt.pullErr = errors.New("manifest unknown")
+	syncAll(t, d)
+	if cs2, _ := rt.List(context.Background()); len(cs2) != 1 || cs2[0].ID != cs[0].ID {
+		t.Fatalf("expect old container kept, got %+v", cs2)
+	}
+	edp := store.get("namespaces/default/web/web-0")
+	if edp == nil || !strings.HasPrefix(edp.Status.StateDetail, "ImagePullBackOff") || edp.Status.ID != cs[0].ID {
+		t.Fatalf("expect ImagePullBackOff written to endpoint, got %+v", edp)
+	}
+}
+
+func TestSyncImageUpdates(t *testing.T) {
+	rt := newFakeRuntime()
+	d := newFakeDaemon(rt)
+	dir, err := ioutil.TempDir("", "oars-worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d.node.WorkDir = dir
+	svc := &core.ContainerService{
+		Name:            "oars_default_app_app-0",
+		Image:           "app:latest",
+		ImagePullPolicy: core.ImagePullAlways,
+		AutoUpdate:      true,
+		SpecHash:        "v1",
+		Labels:          map[string]string{core.CreatorLabelKey: "oars"},
+	}
+	svc.Labels[core.HashLabelKey] = d.configHash(svc)
+	d.svcCache.Store("app", svc)
+	syncAll(t, d)
+	syncContainers(t, d)
+
+	//digest 未变化，不重建
+	d.syncImageUpdates()
+	if _, ok := d.imageUpdates.Load("app:latest"); ok {
+		t.Fatal("image should not be updated")
+	}
+
+	rt.mu.Lock()
+	rt.digests["app:latest"] = "sha256:1111"
+	rt.mu.Unlock()
+	done := make(chan struct{})
+	timeout := time.After(10 * time.Second)
+	go func() {
+		d.syncImageUpdates()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			cs, _ := rt.List(context.Background())
+			if len(cs) != 1 || cs[0].Labels[core.ImageDigestLabelKey] != "app:latest@sha256:1111" {
+				t.Fatalf("expect container recreated with new image, got %+v", cs)
+			}
+			//重启后哈希保持不变
+			d2 := newFakeDaemon(rt)
+			d2.node.WorkDir = dir
+			d2.loadImageUpdates()
+			if d2.configHash(svc) != cs[0].Labels[core.HashLabelKey] {
+				t.Fatal("expect image updates persisted")
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+			syncContainers(t, d)
+			syncAll(t, d)
+			cs, _ := rt.List(context.Background())
+			for _, c := range cs {
+				rt.Start(context.Background(), c.ID)
+			}
+			syncContainers(t, d)
+		case <-timeout:
+			t.Fatal("timeout waiting for image update rollout")
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+//workQueue 按key 去重的工作队列，同一key 不会被并发处理
+type workQueue struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	queue      []string
+	dirty      map[string]bool //等待处理的key
+	processing map[string]bool //正在处理的key
+	failures   map[string]int  //连续失败次数
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	shutdown   bool
+}
+
+func newWorkQueue(baseDelay, maxDelay time.Duration) *workQueue {
+	q := &workQueue{
+		dirty:      make(map[string]bool),
+		processing: make(map[string]bool),
+		failures:   make(map[string]int),
+		baseDelay:  baseDelay,
+		maxDelay:   maxDelay,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+//add 加入队列，已在队列中时忽略，处理中时待处理完成后重新入队
+func (q *workQueue) add(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shutdown || q.dirty[key] {
+		return
+	}
+	q.dirty[key] = true
+	if q.processing[key] {
+		return
+	}
+	q.queue = append(q.queue, key)
+	q.cond.Signal()
+}
+
+//addAfter 延迟加入队列
+func (q *workQueue) addAfter(key string, delay time.Duration) {
+	if delay <= 0 {
+		q.add(key)
+		return
+	}
+	time.AfterFunc(delay, func() {
+		q.add(key)
+	})
+}
+
+//addRateLimited 失败后按指数间隔重新加入队列
+func (q *workQueue) addRateLimited(key string) {
+	q.mu.Lock()
+	n := q.failures[key]
+	q.failures[key] = n + 1
+	q.mu.Unlock()
+	q.addAfter(key, q.backoff(n))
+}
+
+func (q *workQueue) backoff(failures int) time.Duration {
+	delay := q.baseDelay
+	for i := 0; i < failures && delay < q.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > q.maxDelay {
+		delay = q.maxDelay
+	}
+	return delay
+}
+
+//forget 处理成功后清除失败次数
+func (q *workQueue) forget(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.failures, key)
+}
+
+//retries 连续失败次数
+func (q *workQueue) retries(key string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failures[key]
+}
+
+//get 阻塞获取下一个key，队列关闭后返回false
+func (q *workQueue) get() (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.queue) == 0 && !q.shutdown {
+		q.cond.Wait()
+	}
+	if len(q.queue) == 0 {
+		return "", false
+	}
+	key := q.queue[0]
+	q.queue = q.queue[1:]
+	delete(q.dirty, key)
+	q.processing[key] = true
+	return key, true
+}
+
+//done 标记处理完成，处理期间再次加入的key 重新入队
+func (q *workQueue) done(key string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.processing, key)
+	if q.dirty[key] {
+		q.queue = append(q.queue, key)
+		q.cond.Signal()
+	}
+}
+
+//len 等待处理的key 数量
+func (q *workQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.queue)
+}
+
+//shutDown 关闭队列，唤醒等待的协程
+func (q *workQueue) shutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shutdown = true
+	q.cond.Broadcast()
+}
+
+//notify 非阻塞发送通知，接收方未处理时合并
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+//broadcaster 将lister 的变更通知分发给多个订阅者
+type broadcaster struct {
+	mu   sync.Mutex
+	subs []chan struct{}
+}
+
+//subscribe 订阅变更通知，订阅后立即收到一次通知
+func (b *broadcaster) subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+	b.mu.Lock()
+	b.subs = append(b.subs, ch)
+	b.mu.Unlock()
+	return ch
+}
+
+func (b *broadcaster) run(trigger <-chan struct{}) {
+	for range trigger {
+		b.mu.Lock()
+		for _, ch := range b.subs {
+			notify(ch)
+		}
+		b.mu.Unlock()
+	}
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWorkQueue(t *testing.T) {
+	q := newWorkQueue(10*time.Millisecond, 40*time.Millisecond)
+	q.add("a")
+	q.add("b")
+	q.add("a")
+	if n := q.len(); n != 2 {
+		t.Fatalf("expect duplicated key merged, got %d", n)
+	}
+	key, _ := q.get()
+	if key != "a" {
+		t.Fatalf("expect a, got %s", key)
+	}
+	//处理中再次加入，完成后才重新入队
+	q.add("a")
+	if n := q.len(); n != 1 {
+		t.Fatalf("processing key should not be queued, got %d", n)
+	}
+	q.done("a")
+	if n := q.len(); n != 2 {
+		t.Fatalf("expect a requeued after done, got %d", n)
+	}
+
+	for i, want := range []time.Duration{10, 20, 40, 40} {
+		if d := q.backoff(i); d != want*time.Millisecond {
+			t.Fatalf("backoff %d: expect %s, got %s", i, want*time.Millisecond, d)
+		}
+	}
+	q.addRateLimited("c")
+	q.addRateLimited("c")
+	if n := q.retries("c"); n != 2 {
+		t.Fatalf("expect 2 retries, got %d", n)
+	}
+	q.forget("c")
+	if n := q.retries("c"); n != 0 {
+		t.Fatalf("expect retries reset, got %d", n)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := q.len(); n != 3 {
+		t.Fatalf("expect c queued once after backoff, got %d", n)
+	}
+
+	q.shutDown()
+	for i := 0; i < 3; i++ {
+		q.get()
+	}
+	if _, ok := q.get(); ok {
+		t.Fatal("get should return false after shutdown")
+	}
+}